@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/eklmv/pdfcertificates/db/migrations"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const usage = `usage: pdfcertificates <command> [arguments]
+
+commands:
+  migrate [-database dsn] up            apply all pending migrations
+  migrate [-database dsn] down [n|-all] roll back n migrations, 1 by default
+  migrate [-database dsn] version       print current version of database
+  migrate [-database dsn] force v       set version without running migrations
+  rotate -storage dir -keys file -key id [-layout flat|sharded] [-compress]
+                                        re-encrypt stored certificates with key
+
+dsn defaults to DATABASE_URL environment variable, keys file has one
+"<id> <hex encoded key>" per line
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:], out)
+	case "rotate":
+		return runRotate(args[1:], out)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(args []string, out io.Writer) (err error) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dsn := fs.String("database", os.Getenv("DATABASE_URL"), "dsn of database")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w\n%s", err, usage)
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if *dsn == "" {
+		return errors.New("dsn of database is not set, use -database or DATABASE_URL")
+	}
+
+	m, err := migrations.New(*dsn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sErr, dErr := m.Close()
+		err = errors.Join(err, sErr, dErr)
+	}()
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "up":
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		fmt.Fprintln(out, "migrate up done")
+	case "down":
+		if err := down(m, args); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		fmt.Fprintln(out, "migrate down done")
+	case "version":
+		v, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Fprintln(out, "no migrations applied")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if dirty {
+			fmt.Fprintf(out, "%d (dirty)\n", v)
+		} else {
+			fmt.Fprintln(out, v)
+		}
+	case "force":
+		if len(args) != 1 {
+			return errors.New("force require version argument")
+		}
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := m.Force(v); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "version forced to %d\n", v)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", cmd, usage)
+	}
+	return nil
+}
+
+// down rolls back n migrations given by args, all of them for -all
+func down(m *migrate.Migrate, args []string) error {
+	switch {
+	case len(args) == 0:
+		return m.Steps(-1)
+	case len(args) == 1 && args[0] == "-all":
+		return m.Down()
+	case len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		return m.Steps(-n)
+	default:
+		return errors.New("down accept single argument")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrate(t *testing.T) {
+	migrate := func(t *testing.T, dsn string, args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		require.NoError(t, run(append([]string{"migrate", "-database", dsn}, args...), &out))
+		return out.String()
+	}
+	t.Run("sqlite database migrated up, forced and down", func(t *testing.T) {
+		dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+
+		assert.Equal(t, "no migrations applied\n", migrate(t, dsn, "version"))
+		migrate(t, dsn, "up")
+		assert.Equal(t, "1\n", migrate(t, dsn, "version"))
+		migrate(t, dsn, "up")
+		migrate(t, dsn, "force", "1")
+		assert.Equal(t, "1\n", migrate(t, dsn, "version"))
+		migrate(t, dsn, "down")
+		assert.Equal(t, "no migrations applied\n", migrate(t, dsn, "version"))
+		migrate(t, dsn, "down", "-all")
+	})
+	t.Run("dsn taken from environment", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "test.db"))
+		var out bytes.Buffer
+
+		require.NoError(t, run([]string{"migrate", "up"}, &out))
+		out.Reset()
+		require.NoError(t, run([]string{"migrate", "version"}, &out))
+
+		assert.Equal(t, "1\n", out.String())
+	})
+	t.Run("invalid arguments rejected", func(t *testing.T) {
+		dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+		t.Setenv("DATABASE_URL", "")
+
+		assert.Error(t, run(nil, &bytes.Buffer{}))
+		assert.ErrorContains(t, run([]string{"serve"}, &bytes.Buffer{}), "unknown command")
+		assert.ErrorContains(t, run([]string{"migrate", "up"}, &bytes.Buffer{}), "dsn of database is not set")
+		assert.ErrorContains(t, run([]string{"migrate", "-database", dsn, "sideways"}, &bytes.Buffer{}), "unknown migrate command")
+		assert.ErrorContains(t, run([]string{"migrate", "-database", dsn, "force"}, &bytes.Buffer{}), "require version")
+		assert.ErrorContains(t, run([]string{"migrate", "-database", dsn, "down", "0"}, &bytes.Buffer{}), "invalid number")
+	})
+}
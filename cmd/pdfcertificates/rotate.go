@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/eklmv/pdfcertificates/internal/storage"
+)
+
+func runRotate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("storage", "", "directory of file system storage")
+	layout := fs.String("layout", storage.FlatLayout.String(), "layout of files written to storage")
+	keysPath := fs.String("keys", "", "file with encryption keys")
+	keyID := fs.String("key", "", "id of current encryption key")
+	compress := fs.Bool("compress", false, "compress certificates before encryption")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w\n%s", err, usage)
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %q\n%s", fs.Args(), usage)
+	}
+	if *path == "" || *keysPath == "" || *keyID == "" {
+		return errors.New("rotate require -storage, -keys and -key to be set")
+	}
+	l, err := parseLayout(*layout)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*keysPath)
+	if err != nil {
+		return fmt.Errorf("failed to open keys: %w", err)
+	}
+	defer f.Close()
+	keys, err := parseKeys(f)
+	if err != nil {
+		return err
+	}
+
+	// all versions are kept, so loading never removes files
+	cfg := storage.FileSystemConfig{Layout: l, Versions: storage.VersionRetention{Keep: math.MaxInt}}
+	fsys, err := storage.NewFileSystemWithConfig(*path, cfg)
+	if err != nil {
+		return err
+	}
+	if err := fsys.Load(); err != nil {
+		return err
+	}
+	es, err := storage.NewEncryptedStorage(fsys, keys, *keyID, *compress)
+	if err != nil {
+		return err
+	}
+	rotated, err := es.Rotate()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "rotated %d certificates\n", rotated)
+	return nil
+}
+
+func parseLayout(name string) (storage.Layout, error) {
+	for _, l := range []storage.Layout{storage.FlatLayout, storage.ShardedLayout} {
+		if l.String() == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown layout %q", name)
+}
+
+// parseKeys reads keys in format of one "<id> <hex encoded key>" per line,
+// empty lines and lines starting with # are skipped
+func parseKeys(r io.Reader) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid key on line %d, expected <id> <hex key>", n)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key on line %d: %w", n, err)
+		}
+		if _, ok := keys[fields[0]]; ok {
+			return nil, fmt.Errorf("duplicate key %q on line %d", fields[0], n)
+		}
+		keys[fields[0]] = key
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eklmv/pdfcertificates/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRotate(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	t.Run("stored certificates re-encrypted with current key", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "storage")
+		keysPath := filepath.Join(dir, "keys")
+		keys := "# retired\nold 0101010101010101010101010101010101010101010101010101010101010101\n\n" +
+			"new 0202020202020202020202020202020202020202020202020202020202020202\n"
+		require.NoError(t, os.WriteFile(keysPath, []byte(keys), 0600))
+		fsys, err := storage.NewFileSystem(path)
+		require.NoError(t, err)
+		es, err := storage.NewEncryptedStorage(fsys, map[string][]byte{"old": oldKey}, "old", false)
+		require.NoError(t, err)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		require.NoError(t, es.Add("00000000", cert, timestamp))
+		var out bytes.Buffer
+
+		err = run([]string{"rotate", "-storage", path, "-keys", keysPath, "-key", "new"}, &out)
+
+		require.NoError(t, err)
+		assert.Equal(t, "rotated 1 certificates\n", out.String())
+		fsys, err = storage.NewFileSystem(path)
+		require.NoError(t, err)
+		require.NoError(t, fsys.Load())
+		es, err = storage.NewEncryptedStorage(fsys, map[string][]byte{"new": newKey}, "new", false)
+		require.NoError(t, err)
+		got, err := es.Get("00000000", timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, cert, got)
+	})
+	t.Run("invalid arguments rejected", func(t *testing.T) {
+		dir := t.TempDir()
+		keysPath := filepath.Join(dir, "keys")
+		require.NoError(t, os.WriteFile(keysPath, []byte("new zz\n"), 0600))
+
+		err := run([]string{"rotate", "-storage", dir}, &bytes.Buffer{})
+		assert.ErrorContains(t, err, "require -storage, -keys and -key")
+		err = run([]string{"rotate", "-storage", dir, "-keys", keysPath, "-key", "new", "-layout", "nested"}, &bytes.Buffer{})
+		assert.ErrorContains(t, err, "unknown layout")
+		err = run([]string{"rotate", "-storage", dir, "-keys", keysPath, "-key", "new"}, &bytes.Buffer{})
+		assert.ErrorContains(t, err, "invalid key on line 1")
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	t.Run("keys parsed, comments and empty lines skipped", func(t *testing.T) {
+		keys, err := parseKeys(strings.NewReader("# comment\n\na 0102\n b  ff \n"))
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": {1, 2}, "b": {0xff}}, keys)
+	})
+	t.Run("malformed and duplicate keys rejected", func(t *testing.T) {
+		_, err := parseKeys(strings.NewReader("a\n"))
+		assert.ErrorContains(t, err, "expected <id> <hex key>")
+		_, err = parseKeys(strings.NewReader("a 01\na 02\n"))
+		assert.ErrorContains(t, err, "duplicate key")
+	})
+}
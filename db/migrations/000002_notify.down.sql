@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS notify_change ON template;
+DROP TRIGGER IF EXISTS notify_change ON course;
+DROP TRIGGER IF EXISTS notify_change ON student;
+DROP TRIGGER IF EXISTS notify_change ON certificate;
+DROP FUNCTION IF EXISTS notify_change;
@@ -0,0 +1,41 @@
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $notify_change$
+    DECLARE
+        changed record;
+        id text;
+    BEGIN
+        IF TG_OP = 'DELETE' THEN
+            changed := OLD;
+        ELSE
+            changed := NEW;
+        END IF;
+        IF TG_TABLE_NAME = 'certificate' THEN
+            IF TG_OP = 'UPDATE' AND (OLD.template_id, OLD.course_id, OLD.student_id)
+                    IS DISTINCT FROM (NEW.template_id, NEW.course_id, NEW.student_id) THEN
+                PERFORM pg_notify('cache_invalidation', 'certificate:' || OLD.certificate_id || ':' ||
+                    OLD.template_id || ':' || OLD.course_id || ':' || OLD.student_id);
+            END IF;
+            id := changed.certificate_id || ':' || changed.template_id || ':' ||
+                changed.course_id || ':' || changed.student_id;
+        ELSIF TG_TABLE_NAME = 'course' THEN
+            id := changed.course_id;
+        ELSIF TG_TABLE_NAME = 'student' THEN
+            id := changed.student_id;
+        ELSIF TG_TABLE_NAME = 'template' THEN
+            id := changed.template_id;
+        END IF;
+        PERFORM pg_notify('cache_invalidation', TG_TABLE_NAME || ':' || id);
+        RETURN NULL;
+    END;
+$notify_change$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON certificate
+FOR EACH ROW EXECUTE FUNCTION notify_change();
+
+CREATE OR REPLACE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON student
+FOR EACH ROW EXECUTE FUNCTION notify_change();
+
+CREATE OR REPLACE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON course
+FOR EACH ROW EXECUTE FUNCTION notify_change();
+
+CREATE OR REPLACE TRIGGER notify_change AFTER INSERT OR UPDATE OR DELETE ON template
+FOR EACH ROW EXECUTE FUNCTION notify_change();
@@ -0,0 +1,82 @@
+// Package migrations embeds database migrations, so they are shipped within
+// binary instead of separate files
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// FS holds migrations of postgres in root and migrations of sqlite in sqlite
+// directory
+//
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
+
+// ErrNoMigrations is returned for databases which don't need migrations
+var ErrNoMigrations = errors.New("database has no migrations")
+
+// dir return directory of migrations for scheme of dsn
+func dir(dsn string) (string, error) {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return "", fmt.Errorf("invalid dsn, expected <scheme>://...")
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		return ".", nil
+	case "sqlite":
+		return "sqlite", nil
+	case "memory":
+		return "", ErrNoMigrations
+	default:
+		return "", fmt.Errorf("unsupported dsn scheme %q", scheme)
+	}
+}
+
+// New return migrate instance of database, migrations are selected by scheme
+// of dsn, caller should close it
+func New(dsn string) (*migrate.Migrate, error) {
+	d, err := dir(dsn)
+	if err != nil {
+		return nil, err
+	}
+	src, err := iofs.New(FS, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return m, nil
+}
+
+// AutoMigrate applies all pending migrations, it is meant to be called on
+// startup. Instances started concurrently are serialized by advisory lock
+// postgres driver holds for the whole run, so only the first one migrates.
+// Databases without migrations are skipped.
+func AutoMigrate(dsn string) (err error) {
+	m, err := New(dsn)
+	if errors.Is(err, ErrNoMigrations) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sErr, dErr := m.Close()
+		err = errors.Join(err, sErr, dErr)
+	}()
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+	return nil
+}
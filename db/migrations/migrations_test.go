@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	t.Run("migrations of both databases embedded", func(t *testing.T) {
+		postgres, err := fs.Glob(FS, "*.up.sql")
+		require.NoError(t, err)
+		sqlite, err := fs.Glob(FS, "sqlite/*.up.sql")
+		require.NoError(t, err)
+
+		assert.Contains(t, postgres, "000001_init.up.sql")
+		assert.Contains(t, sqlite, "sqlite/000001_init.up.sql")
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("unsupported scheme rejected", func(t *testing.T) {
+		_, err := New("mysql://localhost/db")
+		assert.ErrorContains(t, err, "unsupported")
+	})
+	t.Run("memory database has no migrations", func(t *testing.T) {
+		_, err := New("memory://")
+		assert.ErrorIs(t, err, ErrNoMigrations)
+		assert.NoError(t, AutoMigrate("memory://"))
+	})
+	t.Run("sqlite migrated up and down", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		m, err := New("sqlite://" + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { m.Close() })
+
+		require.NoError(t, m.Up())
+		v, dirty, err := m.Version()
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), v)
+		assert.False(t, dirty)
+		assert.True(t, tableExists(t, path, "certificate"))
+
+		require.NoError(t, m.Down())
+		_, _, err = m.Version()
+		assert.ErrorIs(t, err, migrate.ErrNilVersion)
+		assert.False(t, tableExists(t, path, "certificate"))
+	})
+}
+
+func TestAutoMigrate(t *testing.T) {
+	t.Run("repeated migration is no change", func(t *testing.T) {
+		dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+
+		require.NoError(t, AutoMigrate(dsn))
+		require.NoError(t, AutoMigrate(dsn))
+
+		m, err := New(dsn)
+		require.NoError(t, err)
+		defer m.Close()
+		v, _, err := m.Version()
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), v)
+	})
+}
+
+func tableExists(tb testing.TB, path string, table string) bool {
+	tb.Helper()
+	db, err := sql.Open("sqlite", path)
+	require.NoError(tb, err)
+	defer db.Close()
+	var name string
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	require.NoError(tb, err)
+	return true
+}
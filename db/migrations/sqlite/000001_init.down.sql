@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS certificate_student_id_idx;
+DROP INDEX IF EXISTS certificate_course_id_idx;
+DROP INDEX IF EXISTS certificate_template_id_idx;
+DROP TABLE IF EXISTS certificate;
+DROP TABLE IF EXISTS student;
+DROP TABLE IF EXISTS course;
+DROP TABLE IF EXISTS template;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS template (
+    template_id integer PRIMARY KEY AUTOINCREMENT,
+    content text NOT NULL CHECK (content != '')
+);
+
+CREATE TABLE IF NOT EXISTS course (
+    course_id integer PRIMARY KEY AUTOINCREMENT,
+    data text NOT NULL DEFAULT '{}' CHECK (json_valid(data))
+);
+
+CREATE TABLE IF NOT EXISTS student (
+    student_id integer PRIMARY KEY AUTOINCREMENT,
+    data text NOT NULL DEFAULT '{}' CHECK (json_valid(data))
+);
+
+-- certificate_id is generated and timestamp is maintained by application,
+-- timestamp is stored as microseconds since unix epoch
+CREATE TABLE IF NOT EXISTS certificate (
+    certificate_id text PRIMARY KEY CHECK (length(certificate_id) = 8),
+    template_id integer NOT NULL REFERENCES template ON DELETE RESTRICT,
+    course_id integer NOT NULL REFERENCES course ON DELETE RESTRICT,
+    student_id integer NOT NULL REFERENCES student ON DELETE RESTRICT,
+    timestamp integer NOT NULL,
+    data text NOT NULL DEFAULT '{}' CHECK (json_valid(data))
+);
+
+CREATE INDEX IF NOT EXISTS certificate_template_id_idx ON certificate (template_id);
+CREATE INDEX IF NOT EXISTS certificate_course_id_idx ON certificate (course_id);
+CREATE INDEX IF NOT EXISTS certificate_student_id_idx ON certificate (student_id);
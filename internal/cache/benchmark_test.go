@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	benchCapacity = 1000
+	benchKeys     = 100000
+)
+
+var benchPolicies = []struct {
+	name string
+	new  func(capacity uint64) Cache[string, testValue]
+}{
+	{"LRU", func(capacity uint64) Cache[string, testValue] {
+		return NewLRUCache[string, testValue](capacity)
+	}},
+	{"LFU", func(capacity uint64) Cache[string, testValue] {
+		return NewLFUCache[string, testValue](capacity)
+	}},
+	{"2Q", func(capacity uint64) Cache[string, testValue] {
+		return NewTwoQueueCache[string, testValue](capacity)
+	}},
+	{"TinyLFU", func(capacity uint64) Cache[string, testValue] {
+		return NewTinyLFUCache[string, testValue](capacity, capacity, testHasher)
+	}},
+}
+
+// zipfKeys generates skewed workload, a few keys are requested most of the
+// time, every scanEvery-th request is a one-time key if scanEvery is not zero
+func zipfKeys(n int, scanEvery int) []string {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, benchKeys-1)
+	keys := make([]string, n)
+	for i := range keys {
+		if scanEvery != 0 && i%scanEvery == 0 {
+			keys[i] = fmt.Sprintf("scan %d", i)
+			continue
+		}
+		keys[i] = fmt.Sprintf("key %d", zipf.Uint64())
+	}
+	return keys
+}
+
+func benchmarkPolicies(b *testing.B, scanEvery int) {
+	keys := zipfKeys(1<<16, scanEvery)
+	for _, p := range benchPolicies {
+		b.Run(p.name, func(b *testing.B) {
+			c := p.new(benchCapacity)
+			hits := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := keys[i%len(keys)]
+				if _, ok := c.Get(key); ok {
+					hits++
+					continue
+				}
+				c.Add(key, testValue{i})
+			}
+			b.ReportMetric(float64(hits)/float64(b.N), "hits/op")
+		})
+	}
+}
+
+func BenchmarkPolicyZipf(b *testing.B) {
+	benchmarkPolicies(b, 0)
+}
+
+func BenchmarkPolicyZipfWithScan(b *testing.B) {
+	benchmarkPolicies(b, 2)
+}
+
+var benchConcurrent = []struct {
+	name string
+	new  func(capacity uint64) Cache[string, testValue]
+}{
+	{"Safe", func(capacity uint64) Cache[string, testValue] {
+		return NewSafeCache[string, testValue](NewLRUCache[string, testValue](capacity))
+	}},
+	{"Sharded16", func(capacity uint64) Cache[string, testValue] {
+		return NewShardedCache[string, testValue](16, capacity, HashKey)
+	}},
+	{"Sharded64", func(capacity uint64) Cache[string, testValue] {
+		return NewShardedCache[string, testValue](64, capacity, HashKey)
+	}},
+}
+
+func BenchmarkConcurrentGetAdd(b *testing.B) {
+	keys := zipfKeys(1<<16, 0)
+	for _, p := range benchConcurrent {
+		b.Run(p.name, func(b *testing.B) {
+			c := p.new(benchCapacity)
+			var worker atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(worker.Add(1)) * 7919
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if _, ok := c.Get(key); !ok {
+						c.Add(key, testValue{i})
+					}
+					i++
+				}
+			})
+		})
+	}
+}
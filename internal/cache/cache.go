@@ -1,13 +1,14 @@
 package cache
 
 import (
+	"context"
 	"hash/fnv"
-	"reflect"
-	"unsafe"
+	"time"
 )
 
 type Cache[K comparable, V Cacheable] interface {
 	Add(key K, value V)
+	AddWithTTL(key K, value V, ttl time.Duration)
 	Get(key K) (value V, ok bool)
 	GetOldest() (value V, ok bool)
 	Peek(key K) (value V, ok bool)
@@ -22,48 +23,72 @@ type Cache[K comparable, V Cacheable] interface {
 	Len() uint64
 	Size() uint64
 	Resize(capacity uint64)
+	RemoveExpired() uint64
+	Stats() Stats
+}
+
+// Stats describes usage of cache, counters are cumulative since creation.
+// Only Get is counted as hit or miss, Peek and Contains are not counted.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Adds   uint64
+	// Evictions counts entries removed due to capacity or expiry, explicit
+	// removals and replacements are not counted
+	Evictions uint64
+	Len       uint64
+	Bytes     uint64
+}
+
+// HitRatio return share of Get calls which found entry, zero if there were no
+// calls
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s *Stats) merge(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Adds += other.Adds
+	s.Evictions += other.Evictions
+	s.Len += other.Len
+	s.Bytes += other.Bytes
+}
+
+// Observer is notified about lookups of caches built on top of Cache, like
+// cached queries and storage, e.g. to export metrics. It is called inline,
+// so it should be cheap and safe for concurrent use.
+type Observer interface {
+	Hit(key string)
+	Miss(key string)
 }
 
 type Cacheable interface {
 	Size() uint64
 }
 
+// StartSweeper periodically removes expired entries from cache until context
+// is done, cache should be safe for concurrent use, e.g. SafeCache
+func StartSweeper[K comparable, V Cacheable](ctx context.Context, c Cache[K, V], interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.RemoveExpired()
+			}
+		}
+	}()
+}
+
 func HashString(str string) uint32 {
 	hasher := fnv.New32a()
 	hasher.Write([]byte(str))
 	return hasher.Sum32()
 }
-
-// TODO: add correct calculation for more complex types
-func SizeOf(a any) uint64 {
-	size := uint64(reflect.TypeOf(a).Size())
-	switch reflect.TypeOf(a).Kind() {
-	case reflect.Struct:
-		s := reflect.ValueOf(a)
-		if !s.CanAddr() {
-			tmp := reflect.New(s.Type()).Elem()
-			tmp.Set(s)
-			s = tmp
-		}
-		for i := 0; i < s.NumField(); i++ {
-			f := s.Field(i)
-			if f.Kind() > reflect.Complex128 {
-				size -= uint64(f.Type().Size())
-				if f.CanInterface() {
-					size += SizeOf(f.Interface())
-				} else {
-					uf := reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
-					size += SizeOf(uf.Interface())
-				}
-			}
-		}
-	case reflect.Slice:
-		s := reflect.ValueOf(a)
-		for i := 0; i < s.Len(); i++ {
-			size += SizeOf(s.Index(i).Interface())
-		}
-	case reflect.String:
-		size += uint64(reflect.ValueOf(a).Len())
-	}
-	return size
-}
@@ -1,65 +1,69 @@
 package cache
 
 import (
-	"strconv"
 	"testing"
-	"unsafe"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-type _testAlias int32
+func TestCacheStats(t *testing.T) {
+	policies := append(benchPolicies, struct {
+		name string
+		new  func(capacity uint64) Cache[string, testValue]
+	}{"Sharded", func(capacity uint64) Cache[string, testValue] {
+		return NewShardedCache[string, testValue](1, capacity, HashKey)
+	}})
+	for _, p := range policies {
+		p := p
+		t.Run(p.name+": lookups, adds and evictions counted", func(t *testing.T) {
+			t.Parallel()
+			got := p.new(2)
+			got.Add("key 0", testValue{0})
+			got.Add("key 1", testValue{1})
+			got.Get("key 0")
+			got.Get("missing")
+			got.Peek("key 1")
+			got.Contains("missing")
+			got.Remove("key 1")
+			got.RemoveOldest()
 
-type _testStruct1 struct {
-	f float64
-	b bool
-	i int32
-}
+			stats := got.Stats()
 
-type _testStruct2 struct {
-	f float64
-	b bool
-	s string
-}
+			assert.Equal(t, Stats{Hits: 1, Misses: 1, Adds: 2, Evictions: 1}, stats)
+			assert.Equal(t, 0.5, stats.HitRatio())
+		})
+	}
+	t.Run("Len and Bytes reflect current entries", func(t *testing.T) {
+		t.Parallel()
+		got := NewSafeCache[string, testValue](NewLRUCache[string, testValue](0))
+		got.Add("key 0", testValue{0})
+		got.Add("key 1", testValue{1})
 
-type _testStruct3 struct {
-	f float64
-	b bool
-	s string
-	t _testStruct2
-}
+		stats := got.Stats()
 
-func TestSizeOf(t *testing.T) {
-	intSize := uint64(strconv.IntSize / 8)
-	tCases := []struct {
-		name string
-		a    any
-		exp  uint64
-	}{
-		{"bool", true, 1},
-		{"int32", int32(0), 4},
-		{"int64", int64(0), 8},
-		{"uint32", uint32(0), 4},
-		{"uint64", uint64(0), 8},
-		{"float32", float32(0), 4},
-		{"float64", float64(0), 8},
-		// string header
-		{"empty string", "", uint64(intSize * 2)},
-		{"string", "12345", uint64(intSize*2 + 5)},
-		// slice header
-		{"empty slice of byte", []byte(""), uint64(intSize * 3)},
-		{"slice of byte", []byte("12345"), uint64(intSize*3 + 5)},
-		{"type alias", _testAlias(0), 4},
-		{"struct with unexported fields", _testStruct1{0, false, 0}, uint64(unsafe.Sizeof(_testStruct1{}))},
-		{"struct with unexported string field", _testStruct2{0, false, "12345"}, uint64(unsafe.Sizeof(_testStruct2{}) + 5)},
-		{"struct with unexported struct field", _testStruct3{0, false, "12345", _testStruct2{0, false, "12345"}}, uint64(unsafe.Sizeof(_testStruct3{}) + 10)},
-		{"slice of structs", []_testStruct1{{}, {}}, uint64(unsafe.Sizeof(_testStruct1{})*2) + uint64(intSize*3)},
-	}
-	for _, tc := range tCases {
-		t.Run(tc.name, func(t *testing.T) {
-			got := SizeOf(tc.a)
+		assert.Equal(t, uint64(2), stats.Len)
+		assert.Equal(t, uint64(2), stats.Bytes)
+	})
+	t.Run("capacity and expiry evictions counted", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		got := NewLRUCache[string, testValue](2)
+		got.now = clock.Now
+		got.Add("key 0", testValue{0})
+		got.AddWithTTL("key 1", testValue{1}, time.Minute)
+		got.Add("key 2", testValue{2})
+		// replacement is not an eviction
+		got.Add("key 2", testValue{2})
 
-			assert.Equal(t, int(tc.exp), int(got))
-		})
-	}
+		clock.Advance(time.Minute)
+		got.RemoveExpired()
+
+		assert.Equal(t, uint64(2), got.Stats().Evictions)
+		assert.Equal(t, uint64(4), got.Stats().Adds)
+	})
+	t.Run("no lookups give zero hit ratio", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, 0.0, Stats{}.HitRatio())
+	})
 }
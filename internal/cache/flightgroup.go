@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrFlightPanic is returned to callers waiting for call which panicked
+var ErrFlightPanic = errors.New("call in flight panicked")
+
+// FlightGroup collapses concurrent calls with the same key into one, callers
+// arriving while the call is in flight wait for it and receive its result
+type FlightGroup[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*flight[V]
+}
+
+type flight[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+	dups  int
+}
+
+// Do executes fn unless call with the same key is already in flight, shared
+// reports whether result was given to multiple callers. If fn panics, panic
+// is propagated to the caller executing it and waiters receive ErrFlightPanic.
+func (g *FlightGroup[K, V]) Do(key K, fn func() (V, error)) (value V, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*flight[V])
+	}
+	if f, ok := g.calls[key]; ok {
+		f.dups++
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.value, f.err, true
+	}
+	f := &flight[V]{}
+	f.wg.Add(1)
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			var zero V
+			f.value, f.err = zero, fmt.Errorf("%w: %v", ErrFlightPanic, r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		shared = f.dups > 0
+		g.mu.Unlock()
+		f.wg.Done()
+		if r != nil {
+			panic(r)
+		}
+	}()
+	f.value, f.err = fn()
+	return f.value, f.err, false
+}
+
+// InFlight return amount of calls currently in flight
+func (g *FlightGroup[K, V]) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitDups blocks until amount of callers waiting for key in flight reached
+func waitDups[K comparable, V any](tb testing.TB, g *FlightGroup[K, V], key K, dups int) {
+	tb.Helper()
+	require.Eventually(tb, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		f, ok := g.calls[key]
+		return ok && f.dups == dups
+	}, time.Second, time.Millisecond)
+}
+
+func TestFlightGroupDo(t *testing.T) {
+	t.Parallel()
+	t.Run("concurrent calls with the same key collapsed into one", func(t *testing.T) {
+		t.Parallel()
+		workers := 10
+		var g FlightGroup[string, int]
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func() (int, error) {
+			calls.Add(1)
+			<-release
+			return 42, nil
+		}
+		results := make([]int, workers)
+		shared := make([]bool, workers)
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		go func() {
+			defer complete.Done()
+			results[0], _, shared[0] = g.Do("key", fn)
+		}()
+		require.Eventually(t, func() bool { return g.InFlight() == 1 }, time.Second, time.Millisecond)
+		for i := 1; i < workers; i++ {
+			go func(i int) {
+				defer complete.Done()
+				results[i], _, shared[i] = g.Do("key", fn)
+			}(i)
+		}
+		waitDups(t, &g, "key", workers-1)
+		close(release)
+		complete.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		for i := 0; i < workers; i++ {
+			assert.Equal(t, 42, results[i])
+			assert.True(t, shared[i])
+		}
+		assert.Zero(t, g.InFlight())
+	})
+	t.Run("error returned to all waiters, next call executed again", func(t *testing.T) {
+		t.Parallel()
+		var g FlightGroup[string, int]
+		release := make(chan struct{})
+		errCh := make(chan error)
+		go func() {
+			_, err, _ := g.Do("key", func() (int, error) {
+				<-release
+				return 0, fmt.Errorf("failed")
+			})
+			errCh <- err
+		}()
+		require.Eventually(t, func() bool { return g.InFlight() == 1 }, time.Second, time.Millisecond)
+		go func() {
+			_, err, _ := g.Do("key", func() (int, error) { return 1, nil })
+			errCh <- err
+		}()
+		waitDups(t, &g, "key", 1)
+		close(release)
+
+		assert.ErrorContains(t, <-errCh, "failed")
+		assert.ErrorContains(t, <-errCh, "failed")
+		got, err, shared := g.Do("key", func() (int, error) { return 1, nil })
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got)
+		assert.False(t, shared)
+	})
+	t.Run("panic propagated to caller, waiters receive error", func(t *testing.T) {
+		t.Parallel()
+		var g FlightGroup[string, int]
+		release := make(chan struct{})
+		panicCh := make(chan any)
+		errCh := make(chan error)
+		go func() {
+			defer func() { panicCh <- recover() }()
+			g.Do("key", func() (int, error) {
+				<-release
+				panic("render failed")
+			})
+		}()
+		require.Eventually(t, func() bool { return g.InFlight() == 1 }, time.Second, time.Millisecond)
+		go func() {
+			_, err, _ := g.Do("key", func() (int, error) { return 1, nil })
+			errCh <- err
+		}()
+		waitDups(t, &g, "key", 1)
+		close(release)
+
+		assert.Equal(t, "render failed", <-panicCh)
+		err := <-errCh
+		assert.ErrorIs(t, err, ErrFlightPanic)
+		assert.ErrorContains(t, err, "render failed")
+		assert.Zero(t, g.InFlight())
+	})
+	t.Run("calls with different keys not collapsed", func(t *testing.T) {
+		t.Parallel()
+		var g FlightGroup[int, int]
+		var complete sync.WaitGroup
+		var calls atomic.Int32
+		workers := 10
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func(i int) {
+				defer complete.Done()
+				got, _, _ := g.Do(i, func() (int, error) {
+					calls.Add(1)
+					return i, nil
+				})
+				assert.Equal(t, i, got)
+			}(i)
+		}
+		complete.Wait()
+
+		assert.Equal(t, int32(workers), calls.Load())
+	})
+}
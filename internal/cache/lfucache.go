@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// LFUCache evicts the least frequently used entries first, entries with the
+// same frequency are evicted from the least recently used. Frequency of
+// replaced entry is kept, so hot entries survive updates.
+type LFUCache[K comparable, V Cacheable] struct {
+	capacity   uint64
+	used       uint64
+	tick       uint64
+	items      map[K]*lfuNode[K, V]
+	heap       lfuHeap[K, V]
+	onEviction func(key K, value V)
+	ttl        time.Duration
+	now        func() time.Time
+	hits       uint64
+	misses     uint64
+	adds       uint64
+	evictions  uint64
+}
+
+type lfuNode[K comparable, V Cacheable] struct {
+	key     K
+	value   V
+	freq    uint64
+	tick    uint64
+	expires time.Time
+	index   int
+}
+
+func NewLFUCache[K comparable, V Cacheable](capacity uint64) *LFUCache[K, V] {
+	return NewLFUCacheWithEviction[K, V](capacity, nil)
+}
+
+func NewLFUCacheWithEviction[K comparable, V Cacheable](capacity uint64, evictionCallback func(key K, value V)) *LFUCache[K, V] {
+	return &LFUCache[K, V]{
+		capacity:   capacity,
+		items:      make(map[K]*lfuNode[K, V]),
+		onEviction: evictionCallback,
+		now:        time.Now,
+	}
+}
+
+// SetDefaultTTL sets time to live of entries added with Add, zero disables
+// expiry, already stored entries are not affected
+func (c *LFUCache[K, V]) SetDefaultTTL(ttl time.Duration) {
+	c.ttl = ttl
+}
+
+func (c *LFUCache[K, V]) expired(n *lfuNode[K, V]) bool {
+	return !n.expires.IsZero() && !c.now().Before(n.expires)
+}
+
+// evict removes entry counting it as evicted
+func (c *LFUCache[K, V]) evict(key K) {
+	if _, ok := c.items[key]; ok {
+		c.evictions++
+		c.Remove(key)
+	}
+}
+
+func (c *LFUCache[K, V]) use(n *lfuNode[K, V]) {
+	c.tick++
+	n.freq++
+	n.tick = c.tick
+	heap.Fix(&c.heap, n.index)
+}
+
+func (c *LFUCache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL adds entry which expires after ttl, zero ttl means entry never
+// expires
+func (c *LFUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var freq uint64
+	if n, ok := c.items[key]; ok {
+		freq = n.freq
+		c.Remove(key)
+	}
+	c.tick++
+	c.adds++
+	n := &lfuNode[K, V]{
+		key:   key,
+		value: value,
+		freq:  freq + 1,
+		tick:  c.tick,
+	}
+	if ttl > 0 {
+		n.expires = c.now().Add(ttl)
+	}
+	c.items[key] = n
+	heap.Push(&c.heap, n)
+	c.used += value.Size()
+	for c.capacity != 0 && c.used > c.capacity {
+		c.RemoveOldest()
+	}
+}
+
+func (c *LFUCache[K, V]) Get(key K) (value V, ok bool) {
+	if n, ok := c.items[key]; ok {
+		if c.expired(n) {
+			c.evict(key)
+			c.misses++
+			return value, false
+		}
+		c.use(n)
+		c.hits++
+		return n.value, true
+	}
+	c.misses++
+	return
+}
+
+// GetOldest return the least frequently used entry, counting it as used
+func (c *LFUCache[K, V]) GetOldest() (value V, ok bool) {
+	for len(c.heap) > 0 && c.expired(c.heap[0]) {
+		c.evict(c.heap[0].key)
+	}
+	if len(c.heap) == 0 {
+		return
+	}
+	n := c.heap[0]
+	c.use(n)
+	return n.value, true
+}
+
+func (c *LFUCache[K, V]) Peek(key K) (value V, ok bool) {
+	if n, ok := c.items[key]; ok && !c.expired(n) {
+		return n.value, true
+	}
+	return
+}
+
+func (c *LFUCache[K, V]) Touch(key K) {
+	if n, ok := c.items[key]; ok {
+		c.use(n)
+	}
+}
+
+func (c *LFUCache[K, V]) Remove(key K) {
+	if n, ok := c.items[key]; ok {
+		delete(c.items, key)
+		heap.Remove(&c.heap, n.index)
+		c.used -= n.value.Size()
+		if c.onEviction != nil {
+			c.onEviction(n.key, n.value)
+		}
+	}
+}
+
+func (c *LFUCache[K, V]) RemoveOldest() {
+	if len(c.heap) > 0 {
+		c.evict(c.heap[0].key)
+	}
+}
+
+func (c *LFUCache[K, V]) Purge() {
+	for _, k := range c.Keys() {
+		c.Remove(k)
+	}
+}
+
+func (c *LFUCache[K, V]) Contains(key K) bool {
+	n, ok := c.items[key]
+	return ok && !c.expired(n)
+}
+
+// sorted return entries in order of eviction
+func (c *LFUCache[K, V]) sorted() []*lfuNode[K, V] {
+	nodes := make([]*lfuNode[K, V], len(c.heap))
+	copy(nodes, c.heap)
+	sort.Slice(nodes, func(i, j int) bool {
+		return lfuLess(nodes[i], nodes[j])
+	})
+	return nodes
+}
+
+// Keys return keys in order of eviction, from the least frequently used
+func (c *LFUCache[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	for _, n := range c.sorted() {
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+// Values return values in order of eviction, from the least frequently used
+func (c *LFUCache[K, V]) Values() []V {
+	values := make([]V, 0, c.Len())
+	for _, n := range c.sorted() {
+		values = append(values, n.value)
+	}
+	return values
+}
+
+func (c *LFUCache[K, V]) Capacity() uint64 {
+	return c.capacity
+}
+
+func (c *LFUCache[K, V]) Len() uint64 {
+	return uint64(len(c.items))
+}
+
+func (c *LFUCache[K, V]) Size() uint64 {
+	return c.used
+}
+
+func (c *LFUCache[K, V]) Resize(capacity uint64) {
+	c.capacity = capacity
+	for c.capacity != 0 && c.used > c.capacity {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveExpired removes all expired entries, eviction callback is called for
+// each of them, return amount of removed entries
+func (c *LFUCache[K, V]) RemoveExpired() uint64 {
+	var removed uint64
+	for _, n := range c.sorted() {
+		if c.expired(n) {
+			c.evict(n.key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *LFUCache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Adds:      c.adds,
+		Evictions: c.evictions,
+		Len:       c.Len(),
+		Bytes:     c.used,
+	}
+}
+
+func lfuLess[K comparable, V Cacheable](a, b *lfuNode[K, V]) bool {
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.tick < b.tick
+}
+
+// lfuHeap is a heap of entries, the least frequently used on top
+type lfuHeap[K comparable, V Cacheable] []*lfuNode[K, V]
+
+func (h lfuHeap[K, V]) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap[K, V]) Less(i, j int) bool {
+	return lfuLess(h[i], h[j])
+}
+
+func (h lfuHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K, V]) Push(x any) {
+	n := x.(*lfuNode[K, V])
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *lfuHeap[K, V]) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return n
+}
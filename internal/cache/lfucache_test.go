@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLFUCacheImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Cache[string, testValue])(nil), new(LFUCache[string, testValue]))
+}
+
+func TestLFUCacheEviction(t *testing.T) {
+	t.Parallel()
+	t.Run("least frequently used evicted first, ties by least recently used", func(t *testing.T) {
+		t.Parallel()
+		var evicted []string
+		got := NewLFUCacheWithEviction[string, testValue](3, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		for i := 0; i < 3; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		got.Get("key 0")
+		got.Touch("key 0")
+		got.Get("key 2")
+
+		assert.Equal(t, []string{"key 1", "key 2", "key 0"}, got.Keys())
+		got.Add("key 3", testValue{3})
+		got.Add("key 4", testValue{4})
+
+		assert.Equal(t, []string{"key 1", "key 3"}, evicted)
+		assert.Equal(t, []string{"key 4", "key 2", "key 0"}, got.Keys())
+		assert.Equal(t, uint64(3), got.Size())
+	})
+	t.Run("replaced entry keeps frequency, old value passed to eviction callback", func(t *testing.T) {
+		t.Parallel()
+		var evicted []testValue
+		got := NewLFUCacheWithEviction[string, testValue](2, func(_ string, value testValue) {
+			evicted = append(evicted, value)
+		})
+		got.Add("hot", testValue{0})
+		got.Get("hot")
+		got.Add("hot", testValue{1})
+		got.Add("cold", testValue{2})
+		got.Add("new", testValue{3})
+
+		assert.Equal(t, []testValue{{0}, {2}}, evicted)
+		value, ok := got.Peek("hot")
+		assert.True(t, ok)
+		assert.Equal(t, testValue{1}, value)
+	})
+	t.Run("Resize evicts least frequently used", func(t *testing.T) {
+		t.Parallel()
+		got := NewLFUCache[string, testValue](0)
+		for i := 0; i < 4; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+			for j := 0; j < i; j++ {
+				got.Touch(fmt.Sprintf("key %d", i))
+			}
+		}
+
+		got.Resize(2)
+
+		assert.Equal(t, []string{"key 2", "key 3"}, got.Keys())
+		assert.Equal(t, uint64(2), got.Capacity())
+		value, ok := got.GetOldest()
+		assert.True(t, ok)
+		assert.Equal(t, testValue{2}, value)
+	})
+	t.Run("expired entries removed with eviction callback", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		var evicted []string
+		got := NewLFUCacheWithEviction[string, testValue](0, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.now = clock.Now
+		got.SetDefaultTTL(time.Minute)
+		got.Add("key 0", testValue{0})
+		got.AddWithTTL("key 1", testValue{1}, time.Hour)
+		got.Add("key 2", testValue{2})
+
+		clock.Advance(time.Minute)
+
+		assert.False(t, got.Contains("key 0"))
+		_, ok := got.Get("key 0")
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), got.RemoveExpired())
+		assert.Equal(t, []string{"key 0", "key 2"}, evicted)
+		assert.Equal(t, []string{"key 1"}, got.Keys())
+	})
+	t.Run("Purge removes all entries", func(t *testing.T) {
+		t.Parallel()
+		got := NewLFUCache[string, testValue](0)
+		for i := 0; i < 4; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		got.Purge()
+
+		assert.Zero(t, got.Len())
+		assert.Zero(t, got.Size())
+		assert.Empty(t, got.Values())
+	})
+}
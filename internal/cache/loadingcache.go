@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// LoadingCache is a read-through wrapper of Cache, missing entries are loaded
+// with loader given to GetOrLoad. Concurrent loads of the same key are
+// collapsed into one. Load result is not stored if its key was invalidated
+// while it was in flight, so stale value can't overwrite newer one. Wrapped
+// cache should be safe for concurrent use.
+type LoadingCache[K comparable, V Cacheable] struct {
+	Cache[K, V]
+	group FlightGroup[K, V]
+	// mu guards loads in flight and negative cache
+	mu       sync.Mutex
+	loads    map[K]*load
+	negative *LRUCache[K, negativeEntry]
+	negTTL   time.Duration
+	notFound func(err error) bool
+}
+
+// load is a load in flight, it is stale once its key was invalidated
+type load struct {
+	stale bool
+}
+
+// negativeEntry remembers error of failed load, every entry takes one unit of
+// negative cache capacity
+type negativeEntry struct {
+	err error
+}
+
+func (negativeEntry) Size() uint64 {
+	return 1
+}
+
+func NewLoadingCache[K comparable, V Cacheable](c Cache[K, V]) *LoadingCache[K, V] {
+	return &LoadingCache[K, V]{Cache: c, loads: make(map[K]*load)}
+}
+
+// SetNegativeCaching enables caching of load errors for which notFound return
+// true, up to capacity of errors are kept for ttl, zero capacity disables
+// negative caching
+func (c *LoadingCache[K, V]) SetNegativeCaching(capacity uint64, ttl time.Duration, notFound func(err error) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if capacity == 0 {
+		c.negative = nil
+		return
+	}
+	c.negative = NewLRUCache[K, negativeEntry](capacity)
+	c.negTTL = ttl
+	c.notFound = notFound
+}
+
+// GetOrLoad return cached value or loads it, loaded reports whether value was
+// loaded by this or concurrent call instead of taken from cache. Cached
+// not found errors are returned without calling loader.
+func (c *LoadingCache[K, V]) GetOrLoad(key K, loader func() (V, error)) (value V, loaded bool, err error) {
+	if value, ok := c.Get(key); ok {
+		return value, false, nil
+	}
+	if err, ok := c.negativeHit(key); ok {
+		return value, false, err
+	}
+	value, err, _ = c.group.Do(key, func() (V, error) {
+		if value, ok := c.Peek(key); ok {
+			return value, nil
+		}
+		c.mu.Lock()
+		l := &load{}
+		c.loads[key] = l
+		c.mu.Unlock()
+
+		value, err := loader()
+		c.store(key, value, err, l)
+		return value, err
+	})
+	return value, true, err
+}
+
+func (c *LoadingCache[K, V]) negativeHit(key K) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.negative == nil {
+		return nil, false
+	}
+	e, ok := c.negative.Get(key)
+	return e.err, ok
+}
+
+// store adds load result unless key was invalidated since load started
+func (c *LoadingCache[K, V]) store(key K, value V, err error, l *load) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loads[key] == l {
+		delete(c.loads, key)
+	}
+	if l.stale {
+		return
+	}
+	if err == nil {
+		c.Cache.Add(key, value)
+		return
+	}
+	if c.negative != nil && c.notFound != nil && c.notFound(err) {
+		c.negative.AddWithTTL(key, negativeEntry{err: err}, c.negTTL)
+	}
+}
+
+// invalidate marks load of key in flight stale and drops negative entry of
+// key, loads of other keys are not affected
+func (c *LoadingCache[K, V]) invalidate(key K, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.loads[key]; ok {
+		l.stale = true
+	}
+	if c.negative != nil {
+		c.negative.Remove(key)
+	}
+	fn()
+}
+
+// DiscardLoads marks all loads currently in flight stale, so their results
+// are not stored. It is meant for invalidations which can't name affected
+// keys.
+func (c *LoadingCache[K, V]) DiscardLoads() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.discardLoads()
+}
+
+func (c *LoadingCache[K, V]) discardLoads() {
+	for _, l := range c.loads {
+		l.stale = true
+	}
+}
+
+func (c *LoadingCache[K, V]) Add(key K, value V) {
+	c.invalidate(key, func() { c.Cache.Add(key, value) })
+}
+
+func (c *LoadingCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	c.invalidate(key, func() { c.Cache.AddWithTTL(key, value, ttl) })
+}
+
+func (c *LoadingCache[K, V]) Remove(key K) {
+	c.invalidate(key, func() { c.Cache.Remove(key) })
+}
+
+func (c *LoadingCache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.discardLoads()
+	if c.negative != nil {
+		c.negative.Purge()
+	}
+	c.Cache.Purge()
+}
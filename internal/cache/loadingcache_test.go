@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestNotFound = errors.New("not found")
+
+func prepLoadingCache() *LoadingCache[string, testValue] {
+	return NewLoadingCache[string, testValue](NewSafeCache[string, testValue](NewLRUCache[string, testValue](0)))
+}
+
+func TestLoadingCacheImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Cache[string, testValue])(nil), new(LoadingCache[string, testValue]))
+}
+
+func TestLoadingCacheGetOrLoad(t *testing.T) {
+	t.Parallel()
+	t.Run("missing value loaded and cached, cached value returned without loader", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		var calls int
+		loader := func() (testValue, error) {
+			calls++
+			return testValue{1}, nil
+		}
+
+		value, loaded, err := got.GetOrLoad("key", loader)
+		require.NoError(t, err)
+		assert.True(t, loaded)
+		assert.Equal(t, testValue{1}, value)
+
+		value, loaded, err = got.GetOrLoad("key", loader)
+		require.NoError(t, err)
+		assert.False(t, loaded)
+		assert.Equal(t, testValue{1}, value)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("load error returned and not cached", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		var calls int
+		loader := func() (testValue, error) {
+			calls++
+			return testValue{}, errTestNotFound
+		}
+
+		_, _, err := got.GetOrLoad("key", loader)
+		assert.ErrorIs(t, err, errTestNotFound)
+		_, _, err = got.GetOrLoad("key", loader)
+		assert.ErrorIs(t, err, errTestNotFound)
+
+		assert.Equal(t, 2, calls)
+		assert.False(t, got.Contains("key"))
+	})
+	t.Run("concurrent loads of the same key collapsed into one", func(t *testing.T) {
+		t.Parallel()
+		workers := 10
+		got := prepLoadingCache()
+		var calls atomic.Int32
+		release := make(chan struct{})
+		loader := func() (testValue, error) {
+			calls.Add(1)
+			<-release
+			return testValue{1}, nil
+		}
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer complete.Done()
+				value, _, err := got.GetOrLoad("key", loader)
+				assert.NoError(t, err)
+				assert.Equal(t, testValue{1}, value)
+			}()
+		}
+		waitDups(t, &got.group, "key", workers-1)
+		close(release)
+		complete.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+	})
+	t.Run("value loaded during invalidation is not cached", func(t *testing.T) {
+		t.Parallel()
+		for name, invalidate := range map[string]func(c *LoadingCache[string, testValue]){
+			"Remove": func(c *LoadingCache[string, testValue]) { c.Remove("key") },
+			"Purge":  func(c *LoadingCache[string, testValue]) { c.Purge() },
+		} {
+			got := prepLoadingCache()
+			loader := func() (testValue, error) {
+				invalidate(got)
+				return testValue{1}, nil
+			}
+
+			value, _, err := got.GetOrLoad("key", loader)
+
+			require.NoError(t, err, name)
+			assert.Equal(t, testValue{1}, value, name)
+			assert.False(t, got.Contains("key"), name)
+		}
+	})
+	t.Run("value loaded during invalidation of other key is cached", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		loader := func() (testValue, error) {
+			got.Add("other", testValue{2})
+			got.Remove("other")
+			return testValue{1}, nil
+		}
+
+		_, _, err := got.GetOrLoad("key", loader)
+		require.NoError(t, err)
+
+		value, ok := got.Peek("key")
+		assert.True(t, ok)
+		assert.Equal(t, testValue{1}, value)
+	})
+	t.Run("DiscardLoads discards loads of all keys in flight", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		started, release := make(chan struct{}), make(chan struct{})
+		var complete sync.WaitGroup
+		complete.Add(1)
+		go func() {
+			defer complete.Done()
+			_, _, err := got.GetOrLoad("other", func() (testValue, error) {
+				close(started)
+				<-release
+				return testValue{2}, nil
+			})
+			assert.NoError(t, err)
+		}()
+		<-started
+		loader := func() (testValue, error) {
+			got.DiscardLoads()
+			return testValue{1}, nil
+		}
+
+		_, _, err := got.GetOrLoad("key", loader)
+		require.NoError(t, err)
+		close(release)
+		complete.Wait()
+
+		assert.False(t, got.Contains("key"))
+		assert.False(t, got.Contains("other"))
+	})
+	t.Run("load started after DiscardLoads is cached", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		got.DiscardLoads()
+
+		_, _, err := got.GetOrLoad("key", func() (testValue, error) { return testValue{1}, nil })
+		require.NoError(t, err)
+
+		assert.True(t, got.Contains("key"))
+	})
+	t.Run("value added during load is not overwritten", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		loader := func() (testValue, error) {
+			got.Add("key", testValue{2})
+			return testValue{1}, nil
+		}
+
+		_, _, err := got.GetOrLoad("key", loader)
+		require.NoError(t, err)
+
+		value, ok := got.Peek("key")
+		assert.True(t, ok)
+		assert.Equal(t, testValue{2}, value)
+	})
+}
+
+func TestLoadingCacheNegativeCaching(t *testing.T) {
+	t.Parallel()
+	notFound := func(err error) bool {
+		return errors.Is(err, errTestNotFound)
+	}
+	t.Run("not found error cached until ttl expires", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		got := prepLoadingCache()
+		got.SetNegativeCaching(10, time.Minute, notFound)
+		got.negative.now = clock.Now
+		var calls int
+		loader := func() (testValue, error) {
+			calls++
+			return testValue{}, errTestNotFound
+		}
+
+		_, loaded, err := got.GetOrLoad("key", loader)
+		assert.ErrorIs(t, err, errTestNotFound)
+		assert.True(t, loaded)
+		_, loaded, err = got.GetOrLoad("key", loader)
+		assert.ErrorIs(t, err, errTestNotFound)
+		assert.False(t, loaded)
+		assert.Equal(t, 1, calls)
+
+		clock.Advance(time.Minute)
+		_, _, err = got.GetOrLoad("key", loader)
+		assert.ErrorIs(t, err, errTestNotFound)
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("other errors are not cached", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		got.SetNegativeCaching(10, time.Minute, notFound)
+		errOther := errors.New("connection refused")
+		var calls int
+		loader := func() (testValue, error) {
+			calls++
+			return testValue{}, errOther
+		}
+
+		got.GetOrLoad("key", loader)
+		got.GetOrLoad("key", loader)
+
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("Add clears cached not found error", func(t *testing.T) {
+		t.Parallel()
+		got := prepLoadingCache()
+		got.SetNegativeCaching(10, time.Minute, notFound)
+		_, _, err := got.GetOrLoad("key", func() (testValue, error) {
+			return testValue{}, errTestNotFound
+		})
+		require.ErrorIs(t, err, errTestNotFound)
+
+		got.Add("key", testValue{1})
+		value, loaded, err := got.GetOrLoad("key", func() (testValue, error) {
+			return testValue{}, errTestNotFound
+		})
+
+		require.NoError(t, err)
+		assert.False(t, loaded)
+		assert.Equal(t, testValue{1}, value)
+	})
+}
@@ -1,5 +1,7 @@
 package cache
 
+import "time"
+
 type LRUCache[K comparable, V Cacheable] struct {
 	capacity   uint64
 	used       uint64
@@ -7,19 +9,27 @@ type LRUCache[K comparable, V Cacheable] struct {
 	tail       *node[K, V]
 	items      map[K]*node[K, V]
 	onEviction func(key K, value V)
+	ttl        time.Duration
+	now        func() time.Time
+	hits       uint64
+	misses     uint64
+	adds       uint64
+	evictions  uint64
 }
 
 type node[K comparable, V Cacheable] struct {
-	next  *node[K, V]
-	prev  *node[K, V]
-	key   K
-	value V
+	next    *node[K, V]
+	prev    *node[K, V]
+	key     K
+	value   V
+	expires time.Time
 }
 
 func NewLRUCache[K comparable, V Cacheable](capacity uint64) *LRUCache[K, V] {
 	return &LRUCache[K, V]{
 		capacity: capacity,
 		items:    make(map[K]*node[K, V]),
+		now:      time.Now,
 	}
 }
 
@@ -28,9 +38,23 @@ func NewLRUCacheWithEviction[K comparable, V Cacheable](capacity uint64, evictio
 		capacity:   capacity,
 		items:      make(map[K]*node[K, V]),
 		onEviction: evictionCallback,
+		now:        time.Now,
 	}
 }
 
+// SetDefaultTTL sets time to live of entries added with Add, zero disables
+// expiry, already stored entries are not affected
+func (c *LRUCache[K, V]) SetDefaultTTL(ttl time.Duration) {
+	c.ttl = ttl
+}
+
+// expired reports whether entry expired, expired entries are invisible to
+// Get, Peek and Contains, but removed only by Get, GetOldest, Add and
+// RemoveExpired, so read only methods are safe under read lock
+func (c *LRUCache[K, V]) expired(n *node[K, V]) bool {
+	return !n.expires.IsZero() && !c.now().Before(n.expires)
+}
+
 func (c *LRUCache[K, V]) addToHead(item *node[K, V]) {
 	item.prev = c.head
 	item.next = nil
@@ -60,14 +84,55 @@ func (c *LRUCache[K, V]) removeFromList(item *node[K, V]) {
 	item.next = nil
 }
 
+// moveTo moves entry to the head of other cache, keeping its expiry and
+// without eviction callback, capacity of other cache is not enforced
+func (c *LRUCache[K, V]) moveTo(key K, other *LRUCache[K, V]) {
+	n, ok := c.items[key]
+	if !ok {
+		return
+	}
+	delete(c.items, key)
+	c.removeFromList(n)
+	c.used -= n.value.Size()
+	other.items[key] = n
+	other.addToHead(n)
+	other.used += n.value.Size()
+}
+
+// oldest return the least recently used entry without changing its recency
+func (c *LRUCache[K, V]) oldest() (n *node[K, V], ok bool) {
+	if c.tail == nil {
+		return nil, false
+	}
+	return c.tail, true
+}
+
+// evict removes entry counting it as evicted
+func (c *LRUCache[K, V]) evict(key K) {
+	if _, ok := c.items[key]; ok {
+		c.evictions++
+		c.Remove(key)
+	}
+}
+
 func (c *LRUCache[K, V]) Add(key K, value V) {
-	if c.Contains(key) {
+	c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL adds entry which expires after ttl, zero ttl means entry never
+// expires
+func (c *LRUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	if _, ok := c.items[key]; ok {
 		c.Remove(key)
 	}
 	n := node[K, V]{
 		key:   key,
 		value: value,
 	}
+	if ttl > 0 {
+		n.expires = c.now().Add(ttl)
+	}
+	c.adds++
 	c.items[key] = &n
 	c.addToHead(&n)
 	c.used += value.Size()
@@ -78,14 +143,24 @@ func (c *LRUCache[K, V]) Add(key K, value V) {
 
 func (c *LRUCache[K, V]) Get(key K) (value V, ok bool) {
 	if n, ok := c.items[key]; ok {
+		if c.expired(n) {
+			c.evict(key)
+			c.misses++
+			return value, false
+		}
 		c.removeFromList(n)
 		c.addToHead(n)
+		c.hits++
 		return n.value, true
 	}
+	c.misses++
 	return
 }
 
 func (c *LRUCache[K, V]) GetOldest() (value V, ok bool) {
+	for c.tail != nil && c.expired(c.tail) {
+		c.evict(c.tail.key)
+	}
 	if c.tail == nil {
 		return
 	}
@@ -98,7 +173,7 @@ func (c *LRUCache[K, V]) GetOldest() (value V, ok bool) {
 }
 
 func (c *LRUCache[K, V]) Peek(key K) (value V, ok bool) {
-	if n, ok := c.items[key]; ok {
+	if n, ok := c.items[key]; ok && !c.expired(n) {
 		return n.value, true
 	}
 	return
@@ -124,7 +199,7 @@ func (c *LRUCache[K, V]) Remove(key K) {
 
 func (c *LRUCache[K, V]) RemoveOldest() {
 	if c.tail != nil {
-		c.Remove(c.tail.key)
+		c.evict(c.tail.key)
 	}
 }
 
@@ -135,8 +210,34 @@ func (c *LRUCache[K, V]) Purge() {
 }
 
 func (c *LRUCache[K, V]) Contains(key K) bool {
-	_, ok := c.items[key]
-	return ok
+	n, ok := c.items[key]
+	return ok && !c.expired(n)
+}
+
+// RemoveExpired removes all expired entries, eviction callback is called for
+// each of them, return amount of removed entries
+func (c *LRUCache[K, V]) RemoveExpired() uint64 {
+	var removed uint64
+	for n := c.tail; n != nil; {
+		next := n.next
+		if c.expired(n) {
+			c.evict(n.key)
+			removed++
+		}
+		n = next
+	}
+	return removed
+}
+
+func (c *LRUCache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Adds:      c.adds,
+		Evictions: c.evictions,
+		Len:       c.Len(),
+		Bytes:     c.used,
+	}
 }
 
 func (c *LRUCache[K, V]) Keys() []K {
@@ -167,10 +268,14 @@ func (c *LRUCache[K, V]) Size() uint64 {
 	return c.used
 }
 
+// Resize changes capacity, least recently used entries are evicted to fit
+// smaller one. Zero capacity is unbounded, so limiting unbounded cache is
+// shrinking too, ShardedCache relies on it when its shards created unbounded
+// are resized.
 func (c *LRUCache[K, V]) Resize(capacity uint64) {
 	old := c.capacity
 	c.capacity = capacity
-	if c.capacity >= old {
+	if old != 0 && c.capacity >= old {
 		return
 	}
 	for c.capacity != 0 && c.used > c.capacity {
@@ -5,6 +5,7 @@ import (
 	"math"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -574,4 +575,145 @@ func TestLRUCacheResize(t *testing.T) {
 		assert.Equal(t, evictedKeys, cbKeys)
 		assert.Equal(t, evictedValues, cbValues)
 	})
+	t.Run("Limiting unbounded capacity should remove old pairs with eviction", func(t *testing.T) {
+		t.Parallel()
+		var cbKeys []string
+		got := NewLRUCacheWithEviction[string, testValue](0, func(key string, _ testValue) {
+			cbKeys = append(cbKeys, key)
+		})
+		for i := 0; i < 4; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		got.Resize(2 * testValue{}.Size())
+
+		assert.Equal(t, 2*testValue{}.Size(), got.Capacity())
+		assert.Equal(t, []string{"key 2", "key 3"}, got.Keys())
+		assert.Equal(t, []string{"key 0", "key 1"}, cbKeys)
+	})
+	t.Run("Zero capacity should make cache unbounded without eviction", func(t *testing.T) {
+		t.Parallel()
+		called := false
+		got := NewLRUCacheWithEviction[string, testValue](2*testValue{}.Size(), func(_ string, _ testValue) {
+			called = true
+		})
+		got.Add("key 0", testValue{0})
+		got.Add("key 1", testValue{1})
+
+		got.Resize(0)
+		got.Add("key 2", testValue{2})
+		got.Resize(0)
+
+		assert.Zero(t, got.Capacity())
+		assert.Equal(t, []string{"key 0", "key 1", "key 2"}, got.Keys())
+		assert.False(t, called)
+	})
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	t.Parallel()
+	t.Run("expired entry invisible to Peek and Contains, removed by Get", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		var evicted []string
+		got := NewLRUCacheWithEviction[string, testValue](0, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.now = clock.Now
+		got.AddWithTTL("key", testValue{1}, time.Minute)
+
+		clock.Advance(time.Minute - time.Second)
+		value, ok := got.Peek("key")
+		assert.True(t, ok)
+		assert.Equal(t, testValue{1}, value)
+
+		clock.Advance(time.Second)
+		assert.False(t, got.Contains("key"))
+		_, ok = got.Peek("key")
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), got.Len())
+		_, ok = got.Get("key")
+		assert.False(t, ok)
+		assert.Zero(t, got.Len())
+		assert.Zero(t, got.Size())
+		assert.Equal(t, []string{"key"}, evicted)
+	})
+	t.Run("default ttl applied to entries added with Add", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		got := NewLRUCache[string, testValue](0)
+		got.now = clock.Now
+		got.Add("forever", testValue{0})
+		got.SetDefaultTTL(time.Minute)
+		got.Add("key", testValue{1})
+		got.AddWithTTL("longer", testValue{2}, time.Hour)
+
+		clock.Advance(time.Minute)
+
+		assert.False(t, got.Contains("key"))
+		assert.True(t, got.Contains("forever"))
+		assert.True(t, got.Contains("longer"))
+	})
+	t.Run("re-added entry gets new expiry", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		got := NewLRUCache[string, testValue](0)
+		got.now = clock.Now
+		got.SetDefaultTTL(time.Minute)
+		got.Add("key", testValue{1})
+
+		clock.Advance(30 * time.Second)
+		got.Add("key", testValue{2})
+		clock.Advance(30 * time.Second)
+
+		value, ok := got.Get("key")
+		assert.True(t, ok)
+		assert.Equal(t, testValue{2}, value)
+	})
+	t.Run("GetOldest skips expired entries", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		got := NewLRUCache[string, testValue](0)
+		got.now = clock.Now
+		got.AddWithTTL("expiring", testValue{0}, time.Minute)
+		got.Add("key", testValue{1})
+
+		clock.Advance(time.Minute)
+		value, ok := got.GetOldest()
+
+		assert.True(t, ok)
+		assert.Equal(t, testValue{1}, value)
+		assert.Equal(t, []string{"key"}, got.Keys())
+	})
+	t.Run("RemoveExpired removes only expired entries with eviction", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		var evicted []string
+		got := NewLRUCacheWithEviction[string, testValue](0, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.now = clock.Now
+		for i := 0; i < 4; i++ {
+			got.AddWithTTL(fmt.Sprintf("key %d", i), testValue{i}, time.Duration(i%2+1)*time.Minute)
+		}
+
+		clock.Advance(time.Minute)
+		removed := got.RemoveExpired()
+
+		assert.Equal(t, uint64(2), removed)
+		assert.Equal(t, []string{"key 0", "key 2"}, evicted)
+		assert.Equal(t, []string{"key 1", "key 3"}, got.Keys())
+	})
 }
@@ -1,6 +1,9 @@
 package cache
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 type SafeCache[K comparable, V Cacheable] struct {
 	c  Cache[K, V]
@@ -17,6 +20,12 @@ func (s *SafeCache[K, V]) Add(key K, value V) {
 	s.c.Add(key, value)
 }
 
+func (s *SafeCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c.AddWithTTL(key, value, ttl)
+}
+
 func (s *SafeCache[K, V]) Get(key K) (value V, ok bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -100,3 +109,15 @@ func (s *SafeCache[K, V]) Resize(capacity uint64) {
 	defer s.mu.Unlock()
 	s.c.Resize(capacity)
 }
+
+func (s *SafeCache[K, V]) RemoveExpired() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.RemoveExpired()
+}
+
+func (s *SafeCache[K, V]) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.c.Stats()
+}
@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -715,3 +717,41 @@ func TestSafeCacheResize(t *testing.T) {
 		assert.Equal(t, values[oldest:], got.Values())
 	})
 }
+
+func TestSafeCacheTTL(t *testing.T) {
+	t.Parallel()
+	t.Run("expired entries removed by sweeper, concurrently with reads", func(t *testing.T) {
+		t.Parallel()
+		workers := 10
+		amount := 100
+		var evicted atomic.Int64
+		lru := NewLRUCacheWithEviction[string, testValue](0, func(string, testValue) {
+			evicted.Add(1)
+		})
+		got := NewSafeCache[string, testValue](lru)
+		for i := 0; i < workers*amount; i++ {
+			got.AddWithTTL(fmt.Sprintf("key %d", i), testValue{i}, time.Millisecond)
+		}
+		got.Add("forever", testValue{-1})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		StartSweeper[string, testValue](ctx, got, time.Millisecond)
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func(i int) {
+				defer complete.Done()
+				for j := 0; j < amount; j++ {
+					got.Peek(fmt.Sprintf("key %d", amount*i+j))
+					got.Contains("forever")
+				}
+			}(i)
+		}
+		complete.Wait()
+
+		assert.Eventually(t, func() bool { return got.Len() == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, int64(workers*amount), evicted.Load())
+		assert.True(t, got.Contains("forever"))
+	})
+}
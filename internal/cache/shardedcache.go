@@ -0,0 +1,189 @@
+package cache
+
+import "time"
+
+// ShardedCache splits keys across independently locked LRU shards, so
+// concurrent requests to different shards don't contend for one lock.
+// Capacity is split evenly between shards, recency is tracked per shard.
+type ShardedCache[K comparable, V Cacheable] struct {
+	shards []*SafeCache[K, V]
+	lrus   []*LRUCache[K, V]
+	hasher func(key K) uint64
+}
+
+func NewShardedCache[K comparable, V Cacheable](shards int, capacity uint64, hasher func(key K) uint64) *ShardedCache[K, V] {
+	return NewShardedCacheWithEviction[K, V](shards, capacity, hasher, nil)
+}
+
+// NewShardedCacheWithEviction creates sharded cache, eviction callback is
+// called under lock of the shard, so it may be called concurrently for
+// different shards
+func NewShardedCacheWithEviction[K comparable, V Cacheable](shards int, capacity uint64, hasher func(key K) uint64,
+	evictionCallback func(key K, value V)) *ShardedCache[K, V] {
+	shards = max(shards, 1)
+	c := &ShardedCache[K, V]{
+		shards: make([]*SafeCache[K, V], shards),
+		lrus:   make([]*LRUCache[K, V], shards),
+		hasher: hasher,
+	}
+	perShard := c.shardCapacity(capacity)
+	for i := range c.shards {
+		c.lrus[i] = NewLRUCacheWithEviction[K, V](perShard, evictionCallback)
+		c.shards[i] = NewSafeCache[K, V](c.lrus[i])
+	}
+	return c
+}
+
+// HashKey is a hasher of string keys suitable for ShardedCache and
+// TinyLFUCache
+func HashKey(key string) uint64 {
+	return uint64(HashString(key))
+}
+
+// shardCapacity is never zero for bounded cache, zero would make shard
+// unbounded
+func (c *ShardedCache[K, V]) shardCapacity(capacity uint64) uint64 {
+	if capacity == 0 {
+		return 0
+	}
+	return max(capacity/uint64(len(c.shards)), 1)
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *SafeCache[K, V] {
+	return c.shards[c.hasher(key)%uint64(len(c.shards))]
+}
+
+// fullest return shard with the largest size, used when there is no single
+// oldest entry
+func (c *ShardedCache[K, V]) fullest() *SafeCache[K, V] {
+	fullest := c.shards[0]
+	size := fullest.Size()
+	for _, s := range c.shards[1:] {
+		if ss := s.Size(); ss > size {
+			fullest, size = s, ss
+		}
+	}
+	return fullest
+}
+
+// SetDefaultTTL sets time to live of entries added with Add, zero disables
+// expiry, already stored entries are not affected
+func (c *ShardedCache[K, V]) SetDefaultTTL(ttl time.Duration) {
+	for i, s := range c.shards {
+		s.mu.Lock()
+		c.lrus[i].SetDefaultTTL(ttl)
+		s.mu.Unlock()
+	}
+}
+
+func (c *ShardedCache[K, V]) Add(key K, value V) {
+	c.shard(key).Add(key, value)
+}
+
+func (c *ShardedCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	c.shard(key).AddWithTTL(key, value, ttl)
+}
+
+func (c *ShardedCache[K, V]) Get(key K) (value V, ok bool) {
+	return c.shard(key).Get(key)
+}
+
+// GetOldest return the oldest entry of the fullest shard
+func (c *ShardedCache[K, V]) GetOldest() (value V, ok bool) {
+	return c.fullest().GetOldest()
+}
+
+func (c *ShardedCache[K, V]) Peek(key K) (value V, ok bool) {
+	return c.shard(key).Peek(key)
+}
+
+func (c *ShardedCache[K, V]) Touch(key K) {
+	c.shard(key).Touch(key)
+}
+
+func (c *ShardedCache[K, V]) Remove(key K) {
+	c.shard(key).Remove(key)
+}
+
+// RemoveOldest removes the oldest entry of the fullest shard
+func (c *ShardedCache[K, V]) RemoveOldest() {
+	c.fullest().RemoveOldest()
+}
+
+func (c *ShardedCache[K, V]) Purge() {
+	for _, s := range c.shards {
+		s.Purge()
+	}
+}
+
+func (c *ShardedCache[K, V]) Contains(key K) bool {
+	return c.shard(key).Contains(key)
+}
+
+// Keys return keys shard by shard, ordered from the oldest within each shard
+func (c *ShardedCache[K, V]) Keys() []K {
+	var keys []K
+	for _, s := range c.shards {
+		keys = append(keys, s.Keys()...)
+	}
+	return keys
+}
+
+// Values return values in the same order as Keys
+func (c *ShardedCache[K, V]) Values() []V {
+	var values []V
+	for _, s := range c.shards {
+		values = append(values, s.Values()...)
+	}
+	return values
+}
+
+// Capacity return sum of capacities of all shards
+func (c *ShardedCache[K, V]) Capacity() uint64 {
+	var capacity uint64
+	for _, s := range c.shards {
+		capacity += s.Capacity()
+	}
+	return capacity
+}
+
+func (c *ShardedCache[K, V]) Len() uint64 {
+	var l uint64
+	for _, s := range c.shards {
+		l += s.Len()
+	}
+	return l
+}
+
+func (c *ShardedCache[K, V]) Size() uint64 {
+	var size uint64
+	for _, s := range c.shards {
+		size += s.Size()
+	}
+	return size
+}
+
+// Resize splits new capacity evenly between shards
+func (c *ShardedCache[K, V]) Resize(capacity uint64) {
+	perShard := c.shardCapacity(capacity)
+	for _, s := range c.shards {
+		s.Resize(perShard)
+	}
+}
+
+func (c *ShardedCache[K, V]) RemoveExpired() uint64 {
+	var removed uint64
+	for _, s := range c.shards {
+		removed += s.RemoveExpired()
+	}
+	return removed
+}
+
+// Stats return sum of statistics of all shards
+func (c *ShardedCache[K, V]) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats.merge(s.Stats())
+	}
+	return stats
+}
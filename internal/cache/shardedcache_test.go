@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCacheImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Cache[string, testValue])(nil), new(ShardedCache[string, testValue]))
+}
+
+func TestShardedCacheAdd(t *testing.T) {
+	t.Parallel()
+	t.Run("keys routed to shards by hash, all entries available", func(t *testing.T) {
+		t.Parallel()
+		shards := 4
+		amount := 100
+		got := NewShardedCache[string, testValue](shards, 0, HashKey)
+
+		for i := 0; i < amount; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		assert.Equal(t, uint64(amount), got.Len())
+		assert.Equal(t, uint64(amount), got.Size())
+		assert.Len(t, got.Keys(), amount)
+		for i := 0; i < amount; i++ {
+			key := fmt.Sprintf("key %d", i)
+			shard := got.shards[HashKey(key)%uint64(shards)]
+			assert.True(t, shard.Contains(key))
+			value, ok := got.Get(key)
+			assert.True(t, ok)
+			assert.Equal(t, testValue{i}, value)
+		}
+	})
+	t.Run("capacity split between shards, eviction callback called", func(t *testing.T) {
+		t.Parallel()
+		var evicted atomic.Int32
+		got := NewShardedCacheWithEviction[string, testValue](4, 40, HashKey, func(string, testValue) {
+			evicted.Add(1)
+		})
+
+		for i := 0; i < 100; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		assert.Equal(t, uint64(40), got.Capacity())
+		for _, s := range got.shards {
+			assert.LessOrEqual(t, s.Size(), uint64(10))
+		}
+		assert.Equal(t, int32(100), evicted.Load()+int32(got.Len()))
+	})
+	t.Run("small capacity doesn't make shards unbounded", func(t *testing.T) {
+		t.Parallel()
+		got := NewShardedCache[string, testValue](8, 2, HashKey)
+
+		for i := 0; i < 100; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		assert.Equal(t, uint64(8), got.Capacity())
+		assert.LessOrEqual(t, got.Len(), uint64(8))
+	})
+	t.Run("Add with different keys, concurrently", func(t *testing.T) {
+		t.Parallel()
+		workers := 10
+		amount := 100
+		got := NewShardedCache[string, testValue](4, 0, HashKey)
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func(i int) {
+				defer complete.Done()
+				for j := 0; j < amount; j++ {
+					key := fmt.Sprintf("key %d", amount*i+j)
+					got.Add(key, testValue{amount*i + j})
+					got.Get(key)
+				}
+			}(i)
+		}
+		complete.Wait()
+
+		assert.Equal(t, uint64(workers*amount), got.Len())
+	})
+}
+
+func TestShardedCacheOldest(t *testing.T) {
+	t.Run("oldest entry of the fullest shard removed", func(t *testing.T) {
+		got := NewShardedCache[int, testValue](2, 0, func(key int) uint64 { return uint64(key) })
+		got.Add(0, testValue{0})
+		got.Add(2, testValue{2})
+		got.Add(1, testValue{1})
+
+		value, ok := got.GetOldest()
+		assert.True(t, ok)
+		assert.Equal(t, testValue{0}, value)
+		got.RemoveOldest()
+
+		assert.Equal(t, []int{0, 1}, got.Keys())
+	})
+}
+
+func TestShardedCacheResize(t *testing.T) {
+	t.Run("new capacity split between shards", func(t *testing.T) {
+		got := NewShardedCache[string, testValue](4, 0, HashKey)
+		for i := 0; i < 100; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		got.Resize(20)
+
+		assert.Equal(t, uint64(20), got.Capacity())
+		assert.LessOrEqual(t, got.Len(), uint64(20))
+	})
+}
+
+func TestShardedCacheTTL(t *testing.T) {
+	t.Run("default ttl applied to all shards", func(t *testing.T) {
+		clock := &testClock{now: time.Now()}
+		got := NewShardedCache[string, testValue](4, 0, HashKey)
+		for _, lru := range got.lrus {
+			lru.now = clock.Now
+		}
+		got.SetDefaultTTL(time.Minute)
+		for i := 0; i < 10; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		got.AddWithTTL("longer", testValue{-1}, time.Hour)
+
+		clock.Advance(time.Minute)
+
+		assert.Equal(t, uint64(10), got.RemoveExpired())
+		assert.Equal(t, []string{"longer"}, got.Keys())
+	})
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// Sizer is implemented by types which know their memory footprint better than
+// reflection, SizeOf uses it instead of walking value. Returned size should
+// include size of value itself.
+type Sizer interface {
+	SizeOf() uint64
+}
+
+const (
+	// mapHeaderSize approximates size of map header
+	mapHeaderSize = 48
+	// mapEntryOverhead approximates per entry overhead of map buckets
+	mapEntryOverhead = 1
+)
+
+var (
+	sizerType = reflect.TypeOf((*Sizer)(nil)).Elem()
+	timeType  = reflect.TypeOf(time.Time{})
+)
+
+// SizeOf estimates amount of memory retained by value: size of value itself,
+// plus contents of strings, slices, maps, pointers and interfaces it refers
+// to. Memory reachable more than once, including cycles, is counted once.
+// Location of time.Time is shared between values, so it is not counted.
+func SizeOf(a any) uint64 {
+	if a == nil {
+		return 0
+	}
+	if s, ok := a.(Sizer); ok {
+		return s.SizeOf()
+	}
+	v := reflect.ValueOf(a)
+	// addressable copy allows reading unexported fields of Sizer type
+	tmp := reflect.New(v.Type()).Elem()
+	tmp.Set(v)
+	var w sizeWalker
+	return uint64(v.Type().Size()) + w.heap(tmp)
+}
+
+type visit struct {
+	ptr unsafe.Pointer
+	typ reflect.Type
+}
+
+type sizeWalker struct {
+	visited map[visit]struct{}
+}
+
+// seen marks memory as visited, return true if it was visited before
+func (w *sizeWalker) seen(ptr unsafe.Pointer, typ reflect.Type) bool {
+	v := visit{ptr, typ}
+	if w.visited == nil {
+		w.visited = make(map[visit]struct{})
+	}
+	if _, ok := w.visited[v]; ok {
+		return true
+	}
+	w.visited[v] = struct{}{}
+	return false
+}
+
+// sizer return Sizer implementation of value if there is one
+func sizer(v reflect.Value) (Sizer, bool) {
+	if !v.Type().Implements(sizerType) {
+		return nil, false
+	}
+	if !v.CanInterface() {
+		if !v.CanAddr() {
+			return nil, false
+		}
+		v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	}
+	s, ok := v.Interface().(Sizer)
+	return s, ok
+}
+
+// size return memory of value stored separately, like an element of slice or
+// value boxed in interface
+func (w *sizeWalker) size(v reflect.Value) uint64 {
+	if s, ok := sizer(v); ok {
+		return s.SizeOf()
+	}
+	return uint64(v.Type().Size()) + w.heap(v)
+}
+
+// heap return memory referred by value, size of value itself is not included
+func (w *sizeWalker) heap(v reflect.Value) uint64 {
+	if s, ok := sizer(v); ok {
+		return s.SizeOf() - min(s.SizeOf(), uint64(v.Type().Size()))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return uint64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || w.seen(v.UnsafePointer(), v.Type()) {
+			return 0
+		}
+		return w.elements(v)
+	case reflect.Array:
+		return w.elements(v) - uint64(v.Len())*uint64(v.Type().Elem().Size())
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return 0
+		}
+		var size uint64
+		for i := 0; i < v.NumField(); i++ {
+			size += w.heap(v.Field(i))
+		}
+		return size
+	case reflect.Pointer:
+		if v.IsNil() || w.seen(v.UnsafePointer(), v.Type()) {
+			return 0
+		}
+		return w.size(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		if isPointerShaped(e.Kind()) {
+			return w.heap(e)
+		}
+		return w.size(e)
+	case reflect.Map:
+		if v.IsNil() || w.seen(v.UnsafePointer(), v.Type()) {
+			return 0
+		}
+		t := v.Type()
+		entry := uint64(t.Key().Size()+t.Elem().Size()) + mapEntryOverhead
+		size := mapHeaderSize + uint64(v.Len())*entry
+		if !hasHeap(t.Key()) && !hasHeap(t.Elem()) {
+			return size
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += w.heap(iter.Key()) + w.heap(iter.Value())
+		}
+		return size
+	}
+	return 0
+}
+
+// elements return size of all elements of slice or array
+func (w *sizeWalker) elements(v reflect.Value) uint64 {
+	elem := v.Type().Elem()
+	size := uint64(v.Len()) * uint64(elem.Size())
+	if !hasHeap(elem) {
+		return size
+	}
+	for i := 0; i < v.Len(); i++ {
+		size += w.heap(v.Index(i))
+	}
+	return size
+}
+
+func isPointerShaped(k reflect.Kind) bool {
+	switch k {
+	case reflect.Pointer, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+// hasHeap reports whether value of type may refer to memory stored outside of
+// it, such values are walked element by element
+func hasHeap(t reflect.Type) bool {
+	if t.Implements(sizerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Pointer, reflect.Interface, reflect.Map:
+		return true
+	case reflect.Array:
+		return hasHeap(t.Elem())
+	case reflect.Struct:
+		if t == timeType {
+			return false
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if hasHeap(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _testAlias int32
+
+type _testStruct1 struct {
+	f float64
+	b bool
+	i int32
+}
+
+type _testStruct2 struct {
+	f float64
+	b bool
+	s string
+}
+
+type _testStruct3 struct {
+	f float64
+	b bool
+	s string
+	t _testStruct2
+}
+
+type _testNode struct {
+	value int64
+	next  *_testNode
+}
+
+type _testSized struct {
+	b []byte
+}
+
+func (s _testSized) SizeOf() uint64 {
+	return 1000
+}
+
+type _testWithSized struct {
+	s _testSized
+}
+
+func TestSizeOf(t *testing.T) {
+	intSize := uint64(strconv.IntSize / 8)
+	tCases := []struct {
+		name string
+		a    any
+		exp  uint64
+	}{
+		{"bool", true, 1},
+		{"int32", int32(0), 4},
+		{"int64", int64(0), 8},
+		{"uint32", uint32(0), 4},
+		{"uint64", uint64(0), 8},
+		{"float32", float32(0), 4},
+		{"float64", float64(0), 8},
+		// string header
+		{"empty string", "", uint64(intSize * 2)},
+		{"string", "12345", uint64(intSize*2 + 5)},
+		// slice header
+		{"empty slice of byte", []byte(""), uint64(intSize * 3)},
+		{"slice of byte", []byte("12345"), uint64(intSize*3 + 5)},
+		{"type alias", _testAlias(0), 4},
+		{"struct with unexported fields", _testStruct1{0, false, 0}, uint64(unsafe.Sizeof(_testStruct1{}))},
+		{"struct with unexported string field", _testStruct2{0, false, "12345"}, uint64(unsafe.Sizeof(_testStruct2{}) + 5)},
+		{"struct with unexported struct field", _testStruct3{0, false, "12345", _testStruct2{0, false, "12345"}}, uint64(unsafe.Sizeof(_testStruct3{}) + 10)},
+		{"slice of structs", []_testStruct1{{}, {}}, uint64(unsafe.Sizeof(_testStruct1{})*2) + uint64(intSize*3)},
+		{"array of strings", [2]string{"12345", "12"}, uint64(intSize*4 + 7)},
+		{"nil pointer", (*int64)(nil), uint64(intSize)},
+		{"pointer", new(int64), uint64(intSize + 8)},
+		{"pointer to string", func() *string { s := "12345"; return &s }(), uint64(intSize*3 + 5)},
+		{"nil interface field", struct{ v any }{}, uint64(intSize * 2)},
+		// interface header, boxed string header and content
+		{"interface field with string", struct{ v any }{"12345"}, uint64(intSize*4 + 5)},
+		// pointer in interface is not boxed again
+		{"interface field with pointer", struct{ v any }{new(int64)}, uint64(intSize*2 + 8)},
+		{"nil map", map[string]int64(nil), uint64(intSize)},
+		{"map", map[int64]int64{1: 1, 2: 2},
+			uint64(intSize + mapHeaderSize + 2*(16+mapEntryOverhead))},
+		{"map of strings", map[string]string{"12": "345"},
+			uint64(intSize + mapHeaderSize + intSize*4 + mapEntryOverhead + 5)},
+		{"map of any", map[string]any{"1": []byte("12")},
+			uint64(intSize + mapHeaderSize + intSize*4 + mapEntryOverhead + 1 + intSize*3 + 2)},
+		{"time", time.Now(), uint64(unsafe.Sizeof(time.Time{}))},
+		{"Sizer", _testSized{}, 1000},
+		{"struct with Sizer field", _testWithSized{}, 1000},
+		{"nil", nil, 0},
+	}
+	for _, tc := range tCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SizeOf(tc.a)
+
+			assert.Equal(t, int(tc.exp), int(got))
+		})
+	}
+}
+
+func TestSizeOfCycles(t *testing.T) {
+	nodeSize := uint64(unsafe.Sizeof(_testNode{}))
+	t.Run("cycle of pointers counted once", func(t *testing.T) {
+		a := &_testNode{value: 1}
+		b := &_testNode{value: 2, next: a}
+		a.next = b
+
+		got := SizeOf(a)
+
+		assert.Equal(t, uint64(unsafe.Sizeof(a))+2*nodeSize, got)
+	})
+	t.Run("memory shared by fields counted once", func(t *testing.T) {
+		n := &_testNode{}
+		b := make([]byte, 100)
+		v := struct {
+			a, b *_testNode
+			c, d []byte
+		}{n, n, b, b}
+
+		got := SizeOf(v)
+
+		assert.Equal(t, uint64(unsafe.Sizeof(v))+nodeSize+100, got)
+	})
+	t.Run("map containing itself", func(t *testing.T) {
+		m := map[string]any{}
+		m["self"] = m
+
+		assert.NotPanics(t, func() { SizeOf(m) })
+	})
+}
+
+func BenchmarkSizeOf(b *testing.B) {
+	data := []byte(`{"name":"John Doe","course":"Go","grade":"A"}`)
+	values := []struct {
+		name string
+		v    any
+	}{
+		{"bytes", data},
+		{"struct", _testStruct3{0, false, "12345", _testStruct2{0, false, "12345"}}},
+		{"map", map[string]any{"name": "John Doe", "course": "Go", "grades": []any{5.0, 4.0}}},
+		{"list", func() *_testNode {
+			var head *_testNode
+			for i := 0; i < 100; i++ {
+				head = &_testNode{value: int64(i), next: head}
+			}
+			return head
+		}()},
+	}
+	for _, v := range values {
+		b.Run(v.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				SizeOf(v.v)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+// countMinSketch estimates access frequency of keys with 4 rows of 4-bit
+// saturating counters, all counters are halved periodically, so frequency
+// reflects recent popularity
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions uint64
+	resetAt   uint64
+}
+
+const (
+	sketchDepth    = 4
+	sketchMaxCount = 15
+	sketchMinWidth = 16
+	// sketchSampleRatio is an amount of additions, relative to expected
+	// amount of entries, after which counters are halved
+	sketchSampleRatio = 10
+)
+
+// sketchSeeds are odd constants used to derive independent row indexes from
+// a single hash
+var sketchSeeds = [sketchDepth]uint64{
+	0x9e3779b97f4a7c15,
+	0xbf58476d1ce4e5b9,
+	0x94d049bb133111eb,
+	0xd6e8feb86659fd93,
+}
+
+func newCountMinSketch(entries uint64) *countMinSketch {
+	width := uint64(sketchMinWidth)
+	for width < entries {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:    width - 1,
+		resetAt: sketchSampleRatio * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	h := (hash + 1) * sketchSeeds[row]
+	h ^= h >> 31
+	return h & s.mask
+}
+
+func (s *countMinSketch) add(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	est := uint8(sketchMaxCount)
+	for i := range s.rows {
+		est = min(est, s.rows[i][s.index(hash, i)])
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
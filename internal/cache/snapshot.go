@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Codec converts cached values to bytes and back for snapshots
+type Codec[V any] interface {
+	Marshal(value V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// GobCodec encodes values with encoding/gob, only exported fields of values
+// are preserved
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Marshal(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&value)
+	return buf.Bytes(), err
+}
+
+func (GobCodec[V]) Unmarshal(data []byte) (value V, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return
+}
+
+// Snapshotter is implemented by caches which contents can be saved and
+// restored later
+type Snapshotter[K comparable, V Cacheable] interface {
+	Snapshot(w io.Writer, codec Codec[V]) error
+	Restore(r io.Reader, codec Codec[V], keep func(key K, value V, created time.Time) bool) (uint64, error)
+}
+
+// snapshotVersion is incremented on every incompatible change of format
+const snapshotVersion = 1
+
+var ErrSnapshotVersion = errors.New("unsupported snapshot version")
+
+// SnapshotHeader precedes entries of snapshot
+type SnapshotHeader struct {
+	Version int
+	Created time.Time
+	Entries uint64
+}
+
+type snapshotEntry[K comparable] struct {
+	Key     K
+	Value   []byte
+	Expires time.Time
+}
+
+// Snapshot writes entries from the oldest to the most recently used with
+// their expiry time, expired entries are skipped
+func (c *LRUCache[K, V]) Snapshot(w io.Writer, codec Codec[V]) error {
+	var nodes []*node[K, V]
+	for n := c.tail; n != nil; n = n.next {
+		if !c.expired(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(SnapshotHeader{
+		Version: snapshotVersion,
+		Created: c.now(),
+		Entries: uint64(len(nodes)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	for _, n := range nodes {
+		e := snapshotEntry[K]{Key: n.key, Expires: n.expires}
+		if e.Value, err = codec.Marshal(n.value); err != nil {
+			return fmt.Errorf("failed to encode value of %v: %w", n.key, err)
+		}
+		if err = enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write snapshot entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Restore adds entries of snapshot in their original recency order, entries
+// expired since snapshot was taken or rejected by keep are skipped, nil keep
+// accepts all entries. keep also receives creation time of snapshot, so it can
+// reject entries of outdated snapshot. Return amount of restored entries.
+// SafeCache calls keep under lock, so it should not access the cache.
+func (c *LRUCache[K, V]) Restore(r io.Reader, codec Codec[V], keep func(key K, value V, created time.Time) bool) (uint64, error) {
+	dec := gob.NewDecoder(r)
+	header, err := readSnapshotHeader(dec)
+	if err != nil {
+		return 0, err
+	}
+	var restored uint64
+	for i := uint64(0); i < header.Entries; i++ {
+		var e snapshotEntry[K]
+		if err := dec.Decode(&e); err != nil {
+			return restored, fmt.Errorf("failed to read snapshot entry: %w", err)
+		}
+		var ttl time.Duration
+		if !e.Expires.IsZero() {
+			if ttl = e.Expires.Sub(c.now()); ttl <= 0 {
+				continue
+			}
+		}
+		value, err := codec.Unmarshal(e.Value)
+		if err != nil {
+			return restored, fmt.Errorf("failed to decode value of %v: %w", e.Key, err)
+		}
+		if keep != nil && !keep(e.Key, value, header.Created) {
+			continue
+		}
+		c.AddWithTTL(e.Key, value, ttl)
+		restored++
+	}
+	return restored, nil
+}
+
+func readSnapshotHeader(dec *gob.Decoder) (header SnapshotHeader, err error) {
+	if err = dec.Decode(&header); err != nil {
+		return header, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return header, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+	return header, nil
+}
+
+func (s *SafeCache[K, V]) Snapshot(w io.Writer, codec Codec[V]) error {
+	sn, ok := s.c.(Snapshotter[K, V])
+	if !ok {
+		return fmt.Errorf("snapshot of %T is not supported", s.c)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sn.Snapshot(w, codec)
+}
+
+func (s *SafeCache[K, V]) Restore(r io.Reader, codec Codec[V], keep func(key K, value V, created time.Time) bool) (uint64, error) {
+	sn, ok := s.c.(Snapshotter[K, V])
+	if !ok {
+		return 0, fmt.Errorf("restore of %T is not supported", s.c)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sn.Restore(r, codec, keep)
+}
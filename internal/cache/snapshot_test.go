@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCodec struct{}
+
+func (testCodec) Marshal(value testValue) ([]byte, error) {
+	return []byte(strconv.Itoa(value.value)), nil
+}
+
+func (testCodec) Unmarshal(data []byte) (testValue, error) {
+	v, err := strconv.Atoi(string(data))
+	return testValue{v}, err
+}
+
+func TestLRUCacheSnapshot(t *testing.T) {
+	t.Parallel()
+	t.Run("restored entries keep values and recency order", func(t *testing.T) {
+		t.Parallel()
+		src := NewLRUCache[string, testValue](0)
+		for i := 0; i < 4; i++ {
+			src.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		src.Get("key 1")
+		var buf bytes.Buffer
+
+		require.NoError(t, src.Snapshot(&buf, testCodec{}))
+		got := NewLRUCache[string, testValue](0)
+		restored, err := got.Restore(&buf, testCodec{}, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), restored)
+		assert.Equal(t, src.Keys(), got.Keys())
+		assert.Equal(t, src.Values(), got.Values())
+	})
+	t.Run("expired entries skipped, remaining ttl kept", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		src := NewLRUCache[string, testValue](0)
+		src.now = clock.Now
+		src.AddWithTTL("expired", testValue{0}, time.Minute)
+		src.AddWithTTL("expires later", testValue{1}, time.Hour)
+		src.AddWithTTL("expires on restore", testValue{2}, 2*time.Minute)
+		src.Add("never expires", testValue{3})
+		clock.Advance(time.Minute)
+		var buf bytes.Buffer
+
+		require.NoError(t, src.Snapshot(&buf, testCodec{}))
+		clock.Advance(time.Minute)
+		got := NewLRUCache[string, testValue](0)
+		got.now = clock.Now
+		restored, err := got.Restore(&buf, testCodec{}, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), restored)
+		assert.Equal(t, []string{"expires later", "never expires"}, got.Keys())
+		clock.Advance(time.Hour)
+		assert.False(t, got.Contains("expires later"))
+	})
+	t.Run("entries rejected by keep skipped, creation time passed", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		src := NewLRUCache[string, testValue](0)
+		src.now = clock.Now
+		for i := 0; i < 4; i++ {
+			src.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf, testCodec{}))
+
+		got := NewLRUCache[string, testValue](0)
+		restored, err := got.Restore(&buf, testCodec{}, func(key string, value testValue, created time.Time) bool {
+			assert.True(t, clock.now.Equal(created))
+			return value.value%2 == 0
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), restored)
+		assert.Equal(t, []string{"key 0", "key 2"}, got.Keys())
+	})
+	t.Run("snapshot of unsupported version rejected", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(SnapshotHeader{Version: snapshotVersion + 1}))
+
+		_, err := NewLRUCache[string, testValue](0).Restore(&buf, testCodec{}, nil)
+
+		assert.ErrorIs(t, err, ErrSnapshotVersion)
+	})
+	t.Run("truncated snapshot return error", func(t *testing.T) {
+		t.Parallel()
+		src := NewLRUCache[string, testValue](0)
+		src.Add("key", testValue{1})
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf, testCodec{}))
+
+		_, err := NewLRUCache[string, testValue](0).Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-4]), testCodec{}, nil)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestSafeCacheSnapshot(t *testing.T) {
+	t.Parallel()
+	t.Run("snapshot of wrapped LRU cache restored", func(t *testing.T) {
+		t.Parallel()
+		src := NewSafeCache[string, testValue](NewLRUCache[string, testValue](0))
+		src.Add("key", testValue{1})
+		var buf bytes.Buffer
+
+		require.NoError(t, src.Snapshot(&buf, testCodec{}))
+		got := NewSafeCache[string, testValue](NewLRUCache[string, testValue](0))
+		restored, err := got.Restore(&buf, testCodec{}, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), restored)
+		assert.Equal(t, []string{"key"}, got.Keys())
+	})
+	t.Run("cache without snapshot support return error", func(t *testing.T) {
+		t.Parallel()
+		got := NewSafeCache[string, testValue](NewLFUCache[string, testValue](0))
+
+		assert.Error(t, got.Snapshot(&bytes.Buffer{}, testCodec{}))
+		_, err := got.Restore(&bytes.Buffer{}, testCodec{}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestGobCodec(t *testing.T) {
+	t.Run("value with exported fields encoded and decoded", func(t *testing.T) {
+		type value struct {
+			Name  string
+			Items []int
+		}
+		exp := value{"name", []int{1, 2}}
+		var codec GobCodec[value]
+
+		data, err := codec.Marshal(exp)
+		require.NoError(t, err)
+		got, err := codec.Unmarshal(data)
+
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+}
@@ -0,0 +1,297 @@
+package cache
+
+import "time"
+
+// TinyLFUCache implements W-TinyLFU policy. New entries are added to small
+// window LRU, entries leaving window are admitted to main segment only if
+// their estimated access frequency is higher than frequency of main segment
+// eviction victim, so keys used once can't push out popular ones. Main
+// segment is a segmented LRU: admitted entries go to probation queue and are
+// promoted to protected queue on access.
+type TinyLFUCache[K comparable, V Cacheable] struct {
+	capacity   uint64
+	window     *LRUCache[K, V]
+	probation  *LRUCache[K, V]
+	protected  *LRUCache[K, V]
+	sketch     *countMinSketch
+	hasher     func(key K) uint64
+	onEviction func(key K, value V)
+	hits       uint64
+	misses     uint64
+	adds       uint64
+}
+
+const (
+	// tinyLFUWindowRatio is a share of capacity reserved for window
+	tinyLFUWindowRatio = 0.01
+	// tinyLFUProtectedRatio is a share of main segment reserved for
+	// protected queue
+	tinyLFUProtectedRatio = 0.8
+)
+
+// NewTinyLFUCache creates cache with frequency sketch sized for expected
+// amount of entries, hasher should distribute keys uniformly
+func NewTinyLFUCache[K comparable, V Cacheable](capacity uint64, entries uint64, hasher func(key K) uint64) *TinyLFUCache[K, V] {
+	return NewTinyLFUCacheWithEviction[K, V](capacity, entries, hasher, nil)
+}
+
+func NewTinyLFUCacheWithEviction[K comparable, V Cacheable](capacity uint64, entries uint64, hasher func(key K) uint64,
+	evictionCallback func(key K, value V)) *TinyLFUCache[K, V] {
+	c := &TinyLFUCache[K, V]{
+		capacity:   capacity,
+		sketch:     newCountMinSketch(entries),
+		hasher:     hasher,
+		onEviction: evictionCallback,
+	}
+	// inner queues are unbounded, capacity is enforced by evict
+	c.window = NewLRUCacheWithEviction[K, V](0, c.evicted)
+	c.probation = NewLRUCacheWithEviction[K, V](0, c.evicted)
+	c.protected = NewLRUCacheWithEviction[K, V](0, c.evicted)
+	return c
+}
+
+func (c *TinyLFUCache[K, V]) evicted(key K, value V) {
+	if c.onEviction != nil {
+		c.onEviction(key, value)
+	}
+}
+
+// SetDefaultTTL sets time to live of entries added with Add, zero disables
+// expiry, already stored entries are not affected
+func (c *TinyLFUCache[K, V]) SetDefaultTTL(ttl time.Duration) {
+	for _, q := range c.queues() {
+		q.SetDefaultTTL(ttl)
+	}
+}
+
+func (c *TinyLFUCache[K, V]) setNow(now func() time.Time) {
+	for _, q := range c.queues() {
+		q.now = now
+	}
+}
+
+// queues return inner queues in order of eviction
+func (c *TinyLFUCache[K, V]) queues() []*LRUCache[K, V] {
+	return []*LRUCache[K, V]{c.probation, c.protected, c.window}
+}
+
+// queue return inner queue holding key, including expired entries
+func (c *TinyLFUCache[K, V]) queue(key K) (*LRUCache[K, V], bool) {
+	for _, q := range c.queues() {
+		if _, ok := q.items[key]; ok {
+			return q, true
+		}
+	}
+	return nil, false
+}
+
+func (c *TinyLFUCache[K, V]) windowCapacity() uint64 {
+	return max(uint64(float64(c.capacity)*tinyLFUWindowRatio), 1)
+}
+
+func (c *TinyLFUCache[K, V]) protectedCapacity() uint64 {
+	return uint64(float64(c.capacity-min(c.windowCapacity(), c.capacity)) * tinyLFUProtectedRatio)
+}
+
+func (c *TinyLFUCache[K, V]) frequency(key K) uint8 {
+	return c.sketch.estimate(c.hasher(key))
+}
+
+// evict moves entries exceeding window capacity to main segment, admitting
+// them only if they are used more frequently than main segment victims
+func (c *TinyLFUCache[K, V]) evict() {
+	if c.capacity == 0 {
+		return
+	}
+	for c.window.Size() > c.windowCapacity() && c.window.Len() > 1 {
+		candidate, _ := c.window.oldest()
+		key := candidate.key
+		c.window.moveTo(key, c.probation)
+		for c.Size() > c.capacity {
+			victim, ok := c.probation.oldest()
+			if ok && victim.key == key {
+				victim, ok = c.protected.oldest()
+			}
+			if !ok || c.frequency(key) <= c.frequency(victim.key) {
+				c.probation.evict(key)
+				break
+			}
+			if q, ok := c.queue(victim.key); ok {
+				q.evict(victim.key)
+			}
+		}
+	}
+	for c.Size() > c.capacity {
+		c.RemoveOldest()
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, c.window.ttl)
+}
+
+// AddWithTTL adds entry which expires after ttl, zero ttl means entry never
+// expires
+func (c *TinyLFUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	c.sketch.add(c.hasher(key))
+	c.adds++
+	if q, ok := c.queue(key); ok {
+		q.AddWithTTL(key, value, ttl)
+	} else {
+		c.window.AddWithTTL(key, value, ttl)
+	}
+	c.evict()
+}
+
+// access records access to key, entry of probation queue is promoted to
+// protected one, return queue holding key after access
+func (c *TinyLFUCache[K, V]) access(key K) (*LRUCache[K, V], bool) {
+	c.sketch.add(c.hasher(key))
+	q, ok := c.queue(key)
+	if !ok {
+		return nil, false
+	}
+	if n := q.items[key]; q.expired(n) {
+		q.evict(key)
+		return nil, false
+	}
+	if q != c.probation {
+		q.Touch(key)
+		return q, true
+	}
+	c.probation.moveTo(key, c.protected)
+	for c.protected.Size() > c.protectedCapacity() && c.protected.Len() > 1 {
+		demoted, _ := c.protected.oldest()
+		c.protected.moveTo(demoted.key, c.probation)
+	}
+	if _, ok := c.protected.items[key]; ok {
+		return c.protected, true
+	}
+	return c.probation, true
+}
+
+func (c *TinyLFUCache[K, V]) Get(key K) (value V, ok bool) {
+	q, ok := c.access(key)
+	if !ok {
+		c.misses++
+		return
+	}
+	c.hits++
+	return q.items[key].value, true
+}
+
+// GetOldest return the next entry to evict, counting it as used
+func (c *TinyLFUCache[K, V]) GetOldest() (value V, ok bool) {
+	for _, q := range c.queues() {
+		for n, ok := q.oldest(); ok && q.expired(n); n, ok = q.oldest() {
+			q.evict(n.key)
+		}
+		if n, ok := q.oldest(); ok {
+			return c.Get(n.key)
+		}
+	}
+	return
+}
+
+func (c *TinyLFUCache[K, V]) Peek(key K) (value V, ok bool) {
+	if q, ok := c.queue(key); ok {
+		return q.Peek(key)
+	}
+	return
+}
+
+func (c *TinyLFUCache[K, V]) Touch(key K) {
+	c.access(key)
+}
+
+func (c *TinyLFUCache[K, V]) Remove(key K) {
+	if q, ok := c.queue(key); ok {
+		q.Remove(key)
+	}
+}
+
+// RemoveOldest evicts the least recently used entry of probation queue, then
+// of protected queue, then of window
+func (c *TinyLFUCache[K, V]) RemoveOldest() {
+	for _, q := range c.queues() {
+		if q.Len() > 0 {
+			q.RemoveOldest()
+			return
+		}
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Purge() {
+	for _, q := range c.queues() {
+		q.Purge()
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Contains(key K) bool {
+	if q, ok := c.queue(key); ok {
+		return q.Contains(key)
+	}
+	return false
+}
+
+// Keys return keys in order of eviction: probation, protected and window
+// queues, each from the least recently used
+func (c *TinyLFUCache[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	for _, q := range c.queues() {
+		keys = append(keys, q.Keys()...)
+	}
+	return keys
+}
+
+// Values return values in the same order as Keys
+func (c *TinyLFUCache[K, V]) Values() []V {
+	values := make([]V, 0, c.Len())
+	for _, q := range c.queues() {
+		values = append(values, q.Values()...)
+	}
+	return values
+}
+
+func (c *TinyLFUCache[K, V]) Capacity() uint64 {
+	return c.capacity
+}
+
+func (c *TinyLFUCache[K, V]) Len() uint64 {
+	return c.window.Len() + c.probation.Len() + c.protected.Len()
+}
+
+func (c *TinyLFUCache[K, V]) Size() uint64 {
+	return c.window.Size() + c.probation.Size() + c.protected.Size()
+}
+
+func (c *TinyLFUCache[K, V]) Resize(capacity uint64) {
+	c.capacity = capacity
+	c.evict()
+}
+
+// RemoveExpired removes all expired entries, eviction callback is called for
+// each of them, return amount of removed entries
+func (c *TinyLFUCache[K, V]) RemoveExpired() uint64 {
+	var removed uint64
+	for _, q := range c.queues() {
+		removed += q.RemoveExpired()
+	}
+	return removed
+}
+
+// Stats counts lookups and adds of the whole cache, evictions are summed from
+// all inner queues
+func (c *TinyLFUCache[K, V]) Stats() Stats {
+	stats := Stats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Adds:   c.adds,
+		Len:    c.Len(),
+		Bytes:  c.Size(),
+	}
+	for _, q := range c.queues() {
+		stats.Evictions += q.evictions
+	}
+	return stats
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testHasher(key string) uint64 {
+	return uint64(HashString(key))
+}
+
+func TestTinyLFUCacheImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Cache[string, testValue])(nil), new(TinyLFUCache[string, testValue]))
+}
+
+func TestCountMinSketch(t *testing.T) {
+	t.Run("estimate frequency, saturate and halve counters", func(t *testing.T) {
+		s := newCountMinSketch(16)
+		hash := testHasher("key")
+		for i := 0; i < 5; i++ {
+			s.add(hash)
+		}
+
+		assert.Equal(t, uint8(5), s.estimate(hash))
+		assert.Zero(t, s.estimate(testHasher("other")))
+
+		for i := 0; i < 20; i++ {
+			s.add(hash)
+		}
+		assert.Equal(t, uint8(sketchMaxCount), s.estimate(hash))
+
+		s.reset()
+		assert.Equal(t, uint8(sketchMaxCount/2), s.estimate(hash))
+	})
+}
+
+func TestTinyLFUCacheEviction(t *testing.T) {
+	t.Parallel()
+	t.Run("popular entries survive scan of one-time keys", func(t *testing.T) {
+		t.Parallel()
+		var evicted []string
+		got := NewTinyLFUCacheWithEviction[string, testValue](10, 100, testHasher, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		for i := 0; i < 5; i++ {
+			key := fmt.Sprintf("hot %d", i)
+			got.Add(key, testValue{i})
+			for j := 0; j < 3; j++ {
+				got.Get(key)
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			got.Add(fmt.Sprintf("scan %d", i), testValue{i})
+		}
+
+		for i := 0; i < 5; i++ {
+			assert.True(t, got.Contains(fmt.Sprintf("hot %d", i)))
+		}
+		for i := 0; i < 5; i++ {
+			assert.NotContains(t, evicted, fmt.Sprintf("hot %d", i))
+		}
+		assert.LessOrEqual(t, got.Size(), uint64(10))
+	})
+	t.Run("frequently requested new key admitted to main segment", func(t *testing.T) {
+		t.Parallel()
+		got := NewTinyLFUCache[string, testValue](10, 100, testHasher)
+		for i := 0; i < 10; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		for i := 0; i < 5; i++ {
+			got.Get("new")
+		}
+
+		got.Add("new", testValue{-1})
+		got.Add("next", testValue{-2})
+
+		assert.True(t, got.probation.Contains("new"))
+		assert.Equal(t, uint64(10), got.Len())
+	})
+	t.Run("access promotes entry from probation to protected queue", func(t *testing.T) {
+		t.Parallel()
+		got := NewTinyLFUCache[string, testValue](100, 100, testHasher)
+		got.Add("key", testValue{0})
+		got.Add("next", testValue{1})
+		assert.True(t, got.probation.Contains("key"))
+
+		value, ok := got.Get("key")
+
+		assert.True(t, ok)
+		assert.Equal(t, testValue{0}, value)
+		assert.True(t, got.protected.Contains("key"))
+	})
+	t.Run("expired entries removed with eviction callback", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		var evicted []string
+		got := NewTinyLFUCacheWithEviction[string, testValue](0, 16, testHasher, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.setNow(clock.Now)
+		got.SetDefaultTTL(time.Minute)
+		got.Add("key 0", testValue{0})
+		got.AddWithTTL("key 1", testValue{1}, time.Hour)
+
+		clock.Advance(time.Minute)
+
+		_, ok := got.Get("key 0")
+		assert.False(t, ok)
+		assert.Equal(t, []string{"key 0"}, evicted)
+		assert.Equal(t, []string{"key 1"}, got.Keys())
+	})
+	t.Run("Resize keeps capacity", func(t *testing.T) {
+		t.Parallel()
+		got := NewTinyLFUCache[string, testValue](0, 16, testHasher)
+		for i := 0; i < 10; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		got.Resize(4)
+
+		assert.Equal(t, uint64(4), got.Len())
+		assert.Equal(t, uint64(4), got.Capacity())
+	})
+}
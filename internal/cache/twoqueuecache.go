@@ -0,0 +1,250 @@
+package cache
+
+import "time"
+
+// TwoQueueCache implements 2Q replacement policy. New entries are added to
+// recent FIFO queue, which doesn't change order on access, so entries used
+// only once can't push out frequently used ones. Keys evicted from recent
+// queue are remembered in ghost queue, if such key is added again it goes to
+// frequent LRU queue.
+type TwoQueueCache[K comparable, V Cacheable] struct {
+	capacity   uint64
+	recent     *LRUCache[K, V]
+	frequent   *LRUCache[K, V]
+	ghost      *LRUCache[K, ghostEntry]
+	onEviction func(key K, value V)
+	hits       uint64
+	misses     uint64
+	adds       uint64
+}
+
+// ghostEntry remembers size of evicted value, so ghost queue capacity is
+// shared with real entries
+type ghostEntry uint64
+
+func (g ghostEntry) Size() uint64 {
+	return uint64(g)
+}
+
+const (
+	// twoQueueRecentRatio is a share of capacity reserved for recent queue
+	twoQueueRecentRatio = 0.25
+	// twoQueueGhostRatio is a share of capacity remembered by ghost queue
+	twoQueueGhostRatio = 0.5
+)
+
+func NewTwoQueueCache[K comparable, V Cacheable](capacity uint64) *TwoQueueCache[K, V] {
+	return NewTwoQueueCacheWithEviction[K, V](capacity, nil)
+}
+
+func NewTwoQueueCacheWithEviction[K comparable, V Cacheable](capacity uint64, evictionCallback func(key K, value V)) *TwoQueueCache[K, V] {
+	c := &TwoQueueCache[K, V]{
+		capacity:   capacity,
+		onEviction: evictionCallback,
+	}
+	// inner queues are unbounded, capacity is enforced by evict
+	c.recent = NewLRUCacheWithEviction[K, V](0, c.evicted)
+	c.frequent = NewLRUCacheWithEviction[K, V](0, c.evicted)
+	c.ghost = NewLRUCache[K, ghostEntry](c.ghostCapacity())
+	return c
+}
+
+// ghostCapacity is never zero for bounded cache, zero would make ghost queue
+// unbounded
+func (c *TwoQueueCache[K, V]) ghostCapacity() uint64 {
+	if c.capacity == 0 {
+		return 0
+	}
+	return max(uint64(float64(c.capacity)*twoQueueGhostRatio), 1)
+}
+
+func (c *TwoQueueCache[K, V]) evicted(key K, value V) {
+	if c.onEviction != nil {
+		c.onEviction(key, value)
+	}
+}
+
+// SetDefaultTTL sets time to live of entries added with Add, zero disables
+// expiry, already stored entries are not affected
+func (c *TwoQueueCache[K, V]) SetDefaultTTL(ttl time.Duration) {
+	c.recent.SetDefaultTTL(ttl)
+	c.frequent.SetDefaultTTL(ttl)
+}
+
+func (c *TwoQueueCache[K, V]) setNow(now func() time.Time) {
+	c.recent.now = now
+	c.frequent.now = now
+}
+
+func (c *TwoQueueCache[K, V]) recentTarget() uint64 {
+	return uint64(float64(c.capacity) * twoQueueRecentRatio)
+}
+
+func (c *TwoQueueCache[K, V]) evict() {
+	for c.capacity != 0 && c.Size() > c.capacity {
+		c.RemoveOldest()
+	}
+}
+
+func (c *TwoQueueCache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, c.recent.ttl)
+}
+
+// AddWithTTL adds entry which expires after ttl, zero ttl means entry never
+// expires
+func (c *TwoQueueCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	// expired entries are checked too, so key never ends up in both queues
+	_, inFrequent := c.frequent.items[key]
+	_, inRecent := c.recent.items[key]
+	c.adds++
+	switch {
+	case inFrequent:
+		c.frequent.AddWithTTL(key, value, ttl)
+	case inRecent:
+		// replaced entry stays in recent queue, it is not promoted
+		c.recent.AddWithTTL(key, value, ttl)
+	case c.ghost.Contains(key):
+		c.ghost.Remove(key)
+		c.frequent.AddWithTTL(key, value, ttl)
+	default:
+		c.recent.AddWithTTL(key, value, ttl)
+	}
+	c.evict()
+}
+
+func (c *TwoQueueCache[K, V]) Get(key K) (value V, ok bool) {
+	defer func() {
+		if ok {
+			c.hits++
+		} else {
+			c.misses++
+		}
+	}()
+	if value, ok = c.frequent.Get(key); ok {
+		return
+	}
+	if n, found := c.recent.items[key]; found && c.recent.expired(n) {
+		c.recent.evict(key)
+		return value, false
+	}
+	return c.recent.Peek(key)
+}
+
+// GetOldest return the next entry to evict, counting it as used
+func (c *TwoQueueCache[K, V]) GetOldest() (value V, ok bool) {
+	c.removeExpiredOldest()
+	if from := c.victimQueue(); from != nil {
+		n, _ := from.oldest()
+		return c.Get(n.key)
+	}
+	return
+}
+
+func (c *TwoQueueCache[K, V]) Peek(key K) (value V, ok bool) {
+	if value, ok = c.frequent.Peek(key); ok {
+		return
+	}
+	return c.recent.Peek(key)
+}
+
+// Touch marks entry of frequent queue as recently used, entries of recent
+// queue are not affected
+func (c *TwoQueueCache[K, V]) Touch(key K) {
+	c.frequent.Touch(key)
+}
+
+func (c *TwoQueueCache[K, V]) Remove(key K) {
+	c.frequent.Remove(key)
+	c.recent.Remove(key)
+}
+
+// victimQueue return queue which oldest entry should be evicted next
+func (c *TwoQueueCache[K, V]) victimQueue() *LRUCache[K, V] {
+	if c.recent.Len() > 0 && (c.recent.Size() > c.recentTarget() || c.frequent.Len() == 0) {
+		return c.recent
+	}
+	if c.frequent.Len() > 0 {
+		return c.frequent
+	}
+	return nil
+}
+
+func (c *TwoQueueCache[K, V]) removeExpiredOldest() {
+	for _, q := range []*LRUCache[K, V]{c.recent, c.frequent} {
+		for n, ok := q.oldest(); ok && q.expired(n); n, ok = q.oldest() {
+			q.evict(n.key)
+		}
+	}
+}
+
+// RemoveOldest evicts the oldest entry of recent queue if it exceeds its
+// share of capacity, otherwise the least recently used of frequent queue
+func (c *TwoQueueCache[K, V]) RemoveOldest() {
+	from := c.victimQueue()
+	if from == nil {
+		return
+	}
+	n, _ := from.oldest()
+	if from == c.recent {
+		c.ghost.Add(n.key, ghostEntry(n.value.Size()))
+	}
+	from.evict(n.key)
+}
+
+func (c *TwoQueueCache[K, V]) Purge() {
+	c.recent.Purge()
+	c.frequent.Purge()
+	c.ghost.Purge()
+}
+
+func (c *TwoQueueCache[K, V]) Contains(key K) bool {
+	return c.frequent.Contains(key) || c.recent.Contains(key)
+}
+
+// Keys return keys of recent queue followed by keys of frequent queue, both
+// from the oldest
+func (c *TwoQueueCache[K, V]) Keys() []K {
+	return append(c.recent.Keys(), c.frequent.Keys()...)
+}
+
+// Values return values in the same order as Keys
+func (c *TwoQueueCache[K, V]) Values() []V {
+	return append(c.recent.Values(), c.frequent.Values()...)
+}
+
+func (c *TwoQueueCache[K, V]) Capacity() uint64 {
+	return c.capacity
+}
+
+func (c *TwoQueueCache[K, V]) Len() uint64 {
+	return c.recent.Len() + c.frequent.Len()
+}
+
+func (c *TwoQueueCache[K, V]) Size() uint64 {
+	return c.recent.Size() + c.frequent.Size()
+}
+
+func (c *TwoQueueCache[K, V]) Resize(capacity uint64) {
+	c.capacity = capacity
+	c.ghost.Resize(c.ghostCapacity())
+	c.evict()
+}
+
+// RemoveExpired removes all expired entries, eviction callback is called for
+// each of them, return amount of removed entries
+func (c *TwoQueueCache[K, V]) RemoveExpired() uint64 {
+	return c.recent.RemoveExpired() + c.frequent.RemoveExpired()
+}
+
+// Stats counts lookups and adds of the whole cache, evictions are summed from
+// both queues
+func (c *TwoQueueCache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Adds:      c.adds,
+		Evictions: c.recent.evictions + c.frequent.evictions,
+		Len:       c.Len(),
+		Bytes:     c.Size(),
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoQueueCacheImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Cache[string, testValue])(nil), new(TwoQueueCache[string, testValue]))
+}
+
+func TestTwoQueueCacheEviction(t *testing.T) {
+	t.Parallel()
+	t.Run("key re-added after eviction from recent queue promoted to frequent queue", func(t *testing.T) {
+		t.Parallel()
+		got := NewTwoQueueCache[string, testValue](4)
+		for i := 0; i < 5; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+		assert.False(t, got.Contains("key 0"))
+		assert.True(t, got.ghost.Contains("key 0"))
+
+		got.Add("key 0", testValue{0})
+
+		assert.True(t, got.frequent.Contains("key 0"))
+		assert.False(t, got.ghost.Contains("key 0"))
+		assert.Equal(t, uint64(4), got.Len())
+	})
+	t.Run("scan of one-time keys doesn't evict frequent entries", func(t *testing.T) {
+		t.Parallel()
+		var evicted []string
+		got := NewTwoQueueCacheWithEviction[string, testValue](8, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.Add("hot", testValue{-1})
+		got.Add("filler", testValue{-2})
+		got.Add("filler 2", testValue{-3})
+		for i := 0; i < 8; i++ {
+			got.Add(fmt.Sprintf("pad %d", i), testValue{i})
+		}
+		got.Add("hot", testValue{-1})
+		assert.True(t, got.frequent.Contains("hot"))
+		evicted = nil
+
+		for i := 0; i < 100; i++ {
+			got.Add(fmt.Sprintf("scan %d", i), testValue{i})
+		}
+
+		assert.True(t, got.Contains("hot"))
+		assert.NotContains(t, evicted, "hot")
+		assert.LessOrEqual(t, got.Size(), uint64(8))
+	})
+	t.Run("access to recent queue doesn't change eviction order", func(t *testing.T) {
+		t.Parallel()
+		got := NewTwoQueueCache[string, testValue](2)
+		got.Add("key 0", testValue{0})
+		got.Add("key 1", testValue{1})
+		got.Get("key 0")
+		got.Touch("key 0")
+
+		got.Add("key 2", testValue{2})
+
+		assert.Equal(t, []string{"key 1", "key 2"}, got.Keys())
+	})
+	t.Run("expired entries removed with eviction callback", func(t *testing.T) {
+		t.Parallel()
+		clock := &testClock{now: time.Now()}
+		var evicted []string
+		got := NewTwoQueueCacheWithEviction[string, testValue](0, func(key string, _ testValue) {
+			evicted = append(evicted, key)
+		})
+		got.setNow(clock.Now)
+		got.SetDefaultTTL(time.Minute)
+		got.Add("key 0", testValue{0})
+		got.AddWithTTL("key 1", testValue{1}, time.Hour)
+
+		clock.Advance(time.Minute)
+
+		_, ok := got.Get("key 0")
+		assert.False(t, ok)
+		assert.Equal(t, []string{"key 0"}, evicted)
+		assert.Equal(t, []string{"key 1"}, got.Keys())
+		assert.Zero(t, got.RemoveExpired())
+	})
+	t.Run("Resize evicts from recent queue first", func(t *testing.T) {
+		t.Parallel()
+		got := NewTwoQueueCache[string, testValue](0)
+		got.ghost.Add("hot", 1)
+		got.Add("hot", testValue{0})
+		for i := 0; i < 4; i++ {
+			got.Add(fmt.Sprintf("key %d", i), testValue{i})
+		}
+
+		got.Resize(2)
+
+		assert.Equal(t, []string{"key 3", "hot"}, got.Keys())
+		assert.Equal(t, uint64(2), got.Size())
+	})
+}
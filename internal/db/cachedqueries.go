@@ -2,24 +2,33 @@ package db
 
 import (
 	"context"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"strconv"
+	"time"
 
 	"github.com/eklmv/pdfcertificates/internal/cache"
+	"github.com/jackc/pgx/v5"
 )
 
 type CachedQueries struct {
 	Querier
-	c cache.Cache[uint32, cachedResponse]
+	c        *cache.LoadingCache[string, CachedResponse]
+	index    *certIndex
+	scopes   *scopeIndex
+	observer cache.Observer
 }
 
-type cachedResponse struct {
+// CachedResponse is an entry of CachedQueries cache
+type CachedResponse struct {
 	value any
 	size  uint64
 }
 
-func (r cachedResponse) Size() uint64 {
+func (r CachedResponse) Size() uint64 {
 	return r.size
 }
 
@@ -30,67 +39,166 @@ const (
 	prefCourse
 	prefStudent
 	prefTmpl
+	prefList
+	prefLen
 )
 
 func (p prefix) String() string {
-	return []string{"certificate_", "course_", "student_", "template_"}[p]
+	return []string{"certificate_", "course_", "student_", "template_", "list_", "len_"}[p]
 }
 
-func NewCachedQueries(cache cache.Cache[uint32, cachedResponse], querier Querier) *CachedQueries {
+// key returns cache key of response, full string is used instead of its hash
+// to rule out collisions between different entities
+func (p prefix) key(str string) string {
+	return p.String() + str
+}
+
+// NewCachedQueries creates CachedQueries on top of given cache, e.g.
+// ShardedCache, cache should be safe for concurrent use
+func NewCachedQueries(c cache.Cache[string, CachedResponse], querier Querier) *CachedQueries {
 	return &CachedQueries{
 		Querier: querier,
-		c:       cache,
+		c:       cache.NewLoadingCache(c),
+		index:   newCertIndex(),
+		scopes:  newScopeIndex(),
 	}
 }
 
-func (cq *CachedQueries) addToCache(p prefix, str string, value any) {
-	hash := cache.HashString(p.String() + str)
-	r := cachedResponse{
+// SetNegativeCaching enables caching of not found responses, up to capacity
+// of them are kept for ttl
+func (cq *CachedQueries) SetNegativeCaching(capacity uint64, ttl time.Duration) {
+	cq.c.SetNegativeCaching(capacity, ttl, func(err error) bool {
+		return errors.Is(err, pgx.ErrNoRows)
+	})
+}
+
+// SetObserver sets observer notified about each cache lookup, it should be set
+// before queries are used
+func (cq *CachedQueries) SetObserver(observer cache.Observer) {
+	cq.observer = observer
+}
+
+// CacheStats return statistics of underlying cache
+func (cq *CachedQueries) CacheStats() cache.Stats {
+	return cq.c.Stats()
+}
+
+func newCachedResponse(value any) CachedResponse {
+	r := CachedResponse{
 		value: value,
 	}
 	r.size = cache.SizeOf(r)
-	cq.c.Add(hash, r)
+	return r
 }
 
+func (cq *CachedQueries) addToCache(p prefix, str string, value any) {
+	r := newCachedResponse(value)
+	if cert, ok := value.(Certificate); ok {
+		cq.index.addWith(cert, func() { cq.c.Add(p.key(str), r) })
+		cq.pruneIndex()
+		return
+	}
+	cq.c.Add(p.key(str), r)
+}
+
+// track indexes loaded certificate before it is cached
+func (cq *CachedQueries) track(value any) {
+	if cert, ok := value.(Certificate); ok {
+		cq.index.add(cert)
+		cq.pruneIndex()
+	}
+}
+
+// pruneIndex removes evicted certificates from index once it outgrows cache
+func (cq *CachedQueries) pruneIndex() {
+	if l := uint64(cq.index.len()); l > certIndexMinPrune && l > 2*cq.c.Len() {
+		cq.index.prune(func(certificateID string) bool {
+			return cq.c.Contains(prefCert.key(certificateID))
+		}, cq.c.DiscardLoads)
+	}
+}
+
+// invalidateCache removes response even if it is not cached yet, so query in
+// flight won't cache stale response
 func (cq *CachedQueries) invalidateCache(p prefix, str string) {
-	hash := cache.HashString(p.String() + str)
-	if cq.c.Contains(hash) {
-		cq.c.Remove(hash)
+	cq.c.Remove(p.key(str))
+	if p == prefCert {
+		cq.index.remove(str)
+	}
+}
+
+// pruneScopes removes evicted lists and counts from scope index once it
+// outgrows cache
+func (cq *CachedQueries) pruneScopes() {
+	if l := uint64(cq.scopes.len()); l > scopeIndexMinPrune && l > 2*cq.c.Len() {
+		cq.scopes.prune(cq.c.Contains, cq.c.DiscardLoads)
 	}
 }
 
-// TODO: rewrite using some sort of thread safe lookup index
-func (cq *CachedQueries) invalidateCertificates(ctx context.Context, db DBTX, p prefix, id int32) {
-	var err error
+// invalidateScopes removes cached lists and counts of scopes, loads in flight
+// are discarded even if nothing is cached yet
+func (cq *CachedQueries) invalidateScopes(scopes ...string) {
+	cq.removeKeys(cq.scopes.take(scopes...))
+}
+
+// invalidateScopePrefix removes cached lists and counts of all scopes starting
+// with prefix
+func (cq *CachedQueries) invalidateScopePrefix(prefix string) {
+	cq.removeKeys(cq.scopes.takePrefix(prefix))
+}
+
+func (cq *CachedQueries) removeKeys(keys []string) {
+	for _, key := range keys {
+		cq.c.Remove(key)
+	}
+	cq.c.DiscardLoads()
+}
+
+func (cq *CachedQueries) purge() {
+	cq.c.Purge()
+	cq.index.reset()
+	cq.scopes.reset()
+}
+
+// invalidateCertificates removes cached certificates linked to template,
+// course or student with given id
+func (cq *CachedQueries) invalidateCertificates(p prefix, id int32) {
+	for _, c := range cq.index.linkedTo(p, id) {
+		cq.invalidateCache(prefCert, c)
+	}
+}
+
+// listCertificatesOf return all certificates linked to template, course or
+// student with given id
+func listCertificatesOf(ctx context.Context, q Querier, db DBTX, p prefix, id int32) (certs []Certificate, err error) {
 	var l int64
-	var certs []Certificate
 	switch p {
 	case prefTmpl:
-		l, err = cq.ListCertificatesByTemplateLen(ctx, db, id)
+		l, err = q.ListCertificatesByTemplateLen(ctx, db, id)
 		if err != nil {
 			break
 		}
-		certs, err = cq.ListCertificatesByTemplate(ctx, db, ListCertificatesByTemplateParams{
+		certs, err = q.ListCertificatesByTemplate(ctx, db, ListCertificatesByTemplateParams{
 			TemplateID: id,
 			Limit:      l,
 			Offset:     0,
 		})
 	case prefCourse:
-		l, err = cq.ListCertificatesByCourseLen(ctx, db, id)
+		l, err = q.ListCertificatesByCourseLen(ctx, db, id)
 		if err != nil {
 			break
 		}
-		certs, err = cq.ListCertificatesByCourse(ctx, db, ListCertificatesByCourseParams{
+		certs, err = q.ListCertificatesByCourse(ctx, db, ListCertificatesByCourseParams{
 			CourseID: id,
 			Limit:    l,
 			Offset:   0,
 		})
 	case prefStudent:
-		l, err = cq.ListCertificatesByStudentLen(ctx, db, id)
+		l, err = q.ListCertificatesByStudentLen(ctx, db, id)
 		if err != nil {
 			break
 		}
-		certs, err = cq.ListCertificatesByStudent(ctx, db, ListCertificatesByStudentParams{
+		certs, err = q.ListCertificatesByStudent(ctx, db, ListCertificatesByStudentParams{
 			StudentID: id,
 			Limit:     l,
 			Offset:    0,
@@ -98,32 +206,78 @@ func (cq *CachedQueries) invalidateCertificates(ctx context.Context, db DBTX, p
 	default:
 		err = fmt.Errorf("invalid prefix")
 	}
+	return
+}
+
+// getOrQuery return cached response or makes query, concurrent queries of the
+// same key are collapsed into one, queries in transaction bypass cache
+func getOrQuery[T any](cq *CachedQueries, db DBTX, p prefix, str string, query func() (T, error)) (T, error) {
+	if inTx(db) {
+		return query()
+	}
+	key := p.key(str)
+	r, loaded, err := cq.c.GetOrLoad(key, func() (CachedResponse, error) {
+		v, err := query()
+		if err != nil {
+			return CachedResponse{}, err
+		}
+		cq.track(v)
+		return newCachedResponse(v), nil
+	})
+	if cq.observer != nil {
+		if loaded {
+			cq.observer.Miss(key)
+		} else {
+			cq.observer.Hit(key)
+		}
+	}
 	if err != nil {
-		slog.Error("failed to invalidate cached certificates, force purge",
-			slog.String("prefix", p.String()), slog.Any("error", err))
-		cq.c.Purge()
-		return
+		var zero T
+		return zero, err
+	}
+	v, ok := r.value.(T)
+	if !ok {
+		slog.Error("failed type conversion of cached value", slog.String("key", key),
+			slog.String("type", fmt.Sprintf("%T", v)), slog.Any("value", r.value))
+		cq.c.Remove(key)
+		return query()
 	}
-	for _, c := range certs {
-		cq.invalidateCache(prefCert, c.CertificateID)
+	if !loaded {
+		slog.Debug("successful queries cache hit", slog.String("key", key))
 	}
+	return v, nil
 }
 
-func (cq *CachedQueries) hitCache(p prefix, str string) (v any, ok bool) {
-	hash := cache.HashString(p.String() + str)
-	if cq.c.Contains(hash) {
-		r, ok := cq.c.Get(hash)
-		slog.Info("successful queries cache hit", slog.String("hashed string", p.String()+str),
-			slog.Any("value", r.value), slog.Bool("ok", ok))
-		return r.value, ok
-	}
-	return
+// getOrQueryScoped return cached list or count response, its key is tracked by
+// scope before response is cached, so scope invalidation can't miss it
+func getOrQueryScoped[T any](cq *CachedQueries, db DBTX, p prefix, scope string, str string, query func() (T, error)) (T, error) {
+	return getOrQuery(cq, db, p, str, func() (T, error) {
+		v, err := query()
+		if err == nil {
+			cq.scopes.add(scope, p.key(str))
+			cq.pruneScopes()
+		}
+		return v, err
+	})
+}
+
+// listOf return cached page of list in scope or makes query
+func listOf[T any](cq *CachedQueries, db DBTX, scope string, limit int64, offset int64, query func() ([]T, error)) ([]T, error) {
+	return getOrQueryScoped(cq, db, prefList, scope, fmt.Sprintf("%s?limit=%d&offset=%d", scope, limit, offset), query)
+}
+
+// lenOf return cached length of list in scope or makes query
+func lenOf(cq *CachedQueries, db DBTX, scope string, query func() (int64, error)) (int64, error) {
+	return getOrQueryScoped(cq, db, prefLen, scope, scope, query)
 }
 
 func (cq *CachedQueries) CreateCertificate(ctx context.Context, db DBTX, arg CreateCertificateParams) (Certificate, error) {
 	cert, err := cq.Querier.CreateCertificate(ctx, db, arg)
 	if err == nil {
-		cq.addToCache(prefCert, cert.CertificateID, cert)
+		afterCommit(db, func() {
+			cq.addToCache(prefCert, cert.CertificateID, cert)
+			cq.invalidateScopes(certScopes(cert)...)
+		})
 	}
 	return cert, err
 }
@@ -131,7 +285,10 @@ func (cq *CachedQueries) CreateCertificate(ctx context.Context, db DBTX, arg Cre
 func (cq *CachedQueries) CreateCourse(ctx context.Context, db DBTX, data []byte) (Course, error) {
 	course, err := cq.Querier.CreateCourse(ctx, db, data)
 	if err == nil {
-		cq.addToCache(prefCourse, strconv.Itoa(int(course.CourseID)), course)
+		afterCommit(db, func() {
+			cq.addToCache(prefCourse, strconv.Itoa(int(course.CourseID)), course)
+			cq.invalidateScopes(scopeOf(prefCourse))
+		})
 	}
 	return course, err
 }
@@ -139,7 +296,10 @@ func (cq *CachedQueries) CreateCourse(ctx context.Context, db DBTX, data []byte)
 func (cq *CachedQueries) CreateStudent(ctx context.Context, db DBTX, data []byte) (Student, error) {
 	student, err := cq.Querier.CreateStudent(ctx, db, data)
 	if err == nil {
-		cq.addToCache(prefStudent, strconv.Itoa(int(student.StudentID)), student)
+		afterCommit(db, func() {
+			cq.addToCache(prefStudent, strconv.Itoa(int(student.StudentID)), student)
+			cq.invalidateScopes(scopeOf(prefStudent))
+		})
 	}
 	return student, err
 }
@@ -147,7 +307,10 @@ func (cq *CachedQueries) CreateStudent(ctx context.Context, db DBTX, data []byte
 func (cq *CachedQueries) CreateTemplate(ctx context.Context, db DBTX, content string) (Template, error) {
 	tmpl, err := cq.Querier.CreateTemplate(ctx, db, content)
 	if err == nil {
-		cq.addToCache(prefTmpl, strconv.Itoa(int(tmpl.TemplateID)), tmpl)
+		afterCommit(db, func() {
+			cq.addToCache(prefTmpl, strconv.Itoa(int(tmpl.TemplateID)), tmpl)
+			cq.invalidateScopes(scopeOf(prefTmpl))
+		})
 	}
 	return tmpl, err
 }
@@ -155,7 +318,10 @@ func (cq *CachedQueries) CreateTemplate(ctx context.Context, db DBTX, content st
 func (cq *CachedQueries) DeleteCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
 	cert, err := cq.Querier.DeleteCertificate(ctx, db, certificateID)
 	if err == nil {
-		cq.invalidateCache(prefCert, certificateID)
+		afterCommit(db, func() {
+			cq.invalidateCache(prefCert, certificateID)
+			cq.invalidateScopes(certScopes(cert)...)
+		})
 	}
 	return cert, err
 }
@@ -163,7 +329,10 @@ func (cq *CachedQueries) DeleteCertificate(ctx context.Context, db DBTX, certifi
 func (cq *CachedQueries) DeleteCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
 	course, err := cq.Querier.DeleteCourse(ctx, db, courseID)
 	if err == nil {
-		cq.invalidateCache(prefCourse, strconv.Itoa(int(courseID)))
+		afterCommit(db, func() {
+			cq.invalidateCache(prefCourse, strconv.Itoa(int(courseID)))
+			cq.invalidateScopes(scopeOf(prefCourse))
+		})
 	}
 	return course, err
 }
@@ -171,7 +340,10 @@ func (cq *CachedQueries) DeleteCourse(ctx context.Context, db DBTX, courseID int
 func (cq *CachedQueries) DeleteStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
 	student, err := cq.Querier.DeleteStudent(ctx, db, studentID)
 	if err == nil {
-		cq.invalidateCache(prefStudent, strconv.Itoa(int(studentID)))
+		afterCommit(db, func() {
+			cq.invalidateCache(prefStudent, strconv.Itoa(int(studentID)))
+			cq.invalidateScopes(scopeOf(prefStudent))
+		})
 	}
 	return student, err
 }
@@ -179,90 +351,129 @@ func (cq *CachedQueries) DeleteStudent(ctx context.Context, db DBTX, studentID i
 func (cq *CachedQueries) DeleteTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
 	tmpl, err := cq.Querier.DeleteTemplate(ctx, db, templateID)
 	if err == nil {
-		cq.invalidateCache(prefTmpl, strconv.Itoa(int(templateID)))
+		afterCommit(db, func() {
+			cq.invalidateCache(prefTmpl, strconv.Itoa(int(templateID)))
+			cq.invalidateScopes(scopeOf(prefTmpl))
+		})
 	}
 	return tmpl, err
 }
 
 func (cq *CachedQueries) GetCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
-	if v, ok := cq.hitCache(prefCert, certificateID); ok {
-		if cert, ok := v.(Certificate); ok {
-			return cert, nil
-		} else {
-			slog.Error("failed type conversion of cached value", slog.String("scope", "GetCertificate"),
-				slog.String("type", "Certificate"), slog.Any("value", v))
-			cq.invalidateCache(prefCert, certificateID)
-		}
-	}
+	return getOrQuery(cq, db, prefCert, certificateID, func() (Certificate, error) {
+		return cq.Querier.GetCertificate(ctx, db, certificateID)
+	})
+}
 
-	cert, err := cq.Querier.GetCertificate(ctx, db, certificateID)
-	if err == nil {
-		cq.addToCache(prefCert, certificateID, cert)
-	}
+func (cq *CachedQueries) GetCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
+	return getOrQuery(cq, db, prefCourse, strconv.Itoa(int(courseID)), func() (Course, error) {
+		return cq.Querier.GetCourse(ctx, db, courseID)
+	})
+}
 
-	return cert, err
+func (cq *CachedQueries) GetStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
+	return getOrQuery(cq, db, prefStudent, strconv.Itoa(int(studentID)), func() (Student, error) {
+		return cq.Querier.GetStudent(ctx, db, studentID)
+	})
 }
 
-func (cq *CachedQueries) GetCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
-	if v, ok := cq.hitCache(prefCourse, strconv.Itoa(int(courseID))); ok {
-		if course, ok := v.(Course); ok {
-			return course, nil
-		} else {
-			slog.Error("failed type conversion of cached value", slog.String("scope", "GetCourse"),
-				slog.String("type", "Course"), slog.Any("value", v))
-			cq.invalidateCache(prefCourse, strconv.Itoa(int(courseID)))
-		}
-	}
-	course, err := cq.Querier.GetCourse(ctx, db, courseID)
-	if err == nil {
-		cq.addToCache(prefCourse, strconv.Itoa(int(courseID)), course)
-	}
+func (cq *CachedQueries) GetTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
+	return getOrQuery(cq, db, prefTmpl, strconv.Itoa(int(templateID)), func() (Template, error) {
+		return cq.Querier.GetTemplate(ctx, db, templateID)
+	})
+}
 
-	return course, err
+func (cq *CachedQueries) ListCertificates(ctx context.Context, db DBTX, arg ListCertificatesParams) ([]Certificate, error) {
+	return listOf(cq, db, scopeCerts, arg.Limit, arg.Offset, func() ([]Certificate, error) {
+		return cq.Querier.ListCertificates(ctx, db, arg)
+	})
 }
 
-func (cq *CachedQueries) GetStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
-	if v, ok := cq.hitCache(prefStudent, strconv.Itoa(int(studentID))); ok {
-		if student, ok := v.(Student); ok {
-			return student, nil
-		} else {
-			slog.Error("failed type conversion of cached value", slog.String("scope", "GetStudent"),
-				slog.String("type", "Student"), slog.Any("value", v))
-			cq.invalidateCache(prefStudent, strconv.Itoa(int(studentID)))
-		}
-	}
+func (cq *CachedQueries) ListCertificatesLen(ctx context.Context, db DBTX) (int64, error) {
+	return lenOf(cq, db, scopeCerts, func() (int64, error) {
+		return cq.Querier.ListCertificatesLen(ctx, db)
+	})
+}
 
-	student, err := cq.Querier.GetStudent(ctx, db, studentID)
-	if err == nil {
-		cq.addToCache(prefStudent, strconv.Itoa(int(studentID)), student)
-	}
+func (cq *CachedQueries) ListCertificatesByCourse(ctx context.Context, db DBTX, arg ListCertificatesByCourseParams) ([]Certificate, error) {
+	return listOf(cq, db, certScope(prefCourse, arg.CourseID), arg.Limit, arg.Offset, func() ([]Certificate, error) {
+		return cq.Querier.ListCertificatesByCourse(ctx, db, arg)
+	})
+}
 
-	return student, err
+func (cq *CachedQueries) ListCertificatesByCourseLen(ctx context.Context, db DBTX, courseID int32) (int64, error) {
+	return lenOf(cq, db, certScope(prefCourse, courseID), func() (int64, error) {
+		return cq.Querier.ListCertificatesByCourseLen(ctx, db, courseID)
+	})
 }
 
-func (cq *CachedQueries) GetTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
-	if v, ok := cq.hitCache(prefTmpl, strconv.Itoa(int(templateID))); ok {
-		if tmpl, ok := v.(Template); ok {
-			return tmpl, nil
-		} else {
-			slog.Error("failed type conversion of cached value", slog.String("scope", "GetTemplate"),
-				slog.String("type", "Template"), slog.Any("value", v))
-			cq.invalidateCache(prefTmpl, strconv.Itoa(int(templateID)))
-		}
-	}
+func (cq *CachedQueries) ListCertificatesByStudent(ctx context.Context, db DBTX, arg ListCertificatesByStudentParams) ([]Certificate, error) {
+	return listOf(cq, db, certScope(prefStudent, arg.StudentID), arg.Limit, arg.Offset, func() ([]Certificate, error) {
+		return cq.Querier.ListCertificatesByStudent(ctx, db, arg)
+	})
+}
 
-	tmpl, err := cq.Querier.GetTemplate(ctx, db, templateID)
-	if err == nil {
-		cq.addToCache(prefTmpl, strconv.Itoa(int(templateID)), tmpl)
-	}
+func (cq *CachedQueries) ListCertificatesByStudentLen(ctx context.Context, db DBTX, studentID int32) (int64, error) {
+	return lenOf(cq, db, certScope(prefStudent, studentID), func() (int64, error) {
+		return cq.Querier.ListCertificatesByStudentLen(ctx, db, studentID)
+	})
+}
 
-	return tmpl, err
+func (cq *CachedQueries) ListCertificatesByTemplate(ctx context.Context, db DBTX, arg ListCertificatesByTemplateParams) ([]Certificate, error) {
+	return listOf(cq, db, certScope(prefTmpl, arg.TemplateID), arg.Limit, arg.Offset, func() ([]Certificate, error) {
+		return cq.Querier.ListCertificatesByTemplate(ctx, db, arg)
+	})
+}
+
+func (cq *CachedQueries) ListCertificatesByTemplateLen(ctx context.Context, db DBTX, templateID int32) (int64, error) {
+	return lenOf(cq, db, certScope(prefTmpl, templateID), func() (int64, error) {
+		return cq.Querier.ListCertificatesByTemplateLen(ctx, db, templateID)
+	})
+}
+
+func (cq *CachedQueries) ListCourses(ctx context.Context, db DBTX, arg ListCoursesParams) ([]Course, error) {
+	return listOf(cq, db, scopeCourses, arg.Limit, arg.Offset, func() ([]Course, error) {
+		return cq.Querier.ListCourses(ctx, db, arg)
+	})
+}
+
+func (cq *CachedQueries) ListCoursesLen(ctx context.Context, db DBTX) (int64, error) {
+	return lenOf(cq, db, scopeCourses, func() (int64, error) {
+		return cq.Querier.ListCoursesLen(ctx, db)
+	})
+}
+
+func (cq *CachedQueries) ListStudents(ctx context.Context, db DBTX, arg ListStudentsParams) ([]Student, error) {
+	return listOf(cq, db, scopeStudents, arg.Limit, arg.Offset, func() ([]Student, error) {
+		return cq.Querier.ListStudents(ctx, db, arg)
+	})
+}
+
+func (cq *CachedQueries) ListStudentsLen(ctx context.Context, db DBTX) (int64, error) {
+	return lenOf(cq, db, scopeStudents, func() (int64, error) {
+		return cq.Querier.ListStudentsLen(ctx, db)
+	})
+}
+
+func (cq *CachedQueries) ListTemplates(ctx context.Context, db DBTX, arg ListTemplatesParams) ([]Template, error) {
+	return listOf(cq, db, scopeTmpls, arg.Limit, arg.Offset, func() ([]Template, error) {
+		return cq.Querier.ListTemplates(ctx, db, arg)
+	})
+}
+
+func (cq *CachedQueries) ListTemplatesLen(ctx context.Context, db DBTX) (int64, error) {
+	return lenOf(cq, db, scopeTmpls, func() (int64, error) {
+		return cq.Querier.ListTemplatesLen(ctx, db)
+	})
 }
 
 func (cq *CachedQueries) UpdateCertificate(ctx context.Context, db DBTX, arg UpdateCertificateParams) (Certificate, error) {
 	cert, err := cq.Querier.UpdateCertificate(ctx, db, arg)
 	if err == nil {
-		cq.addToCache(prefCert, cert.CertificateID, cert)
+		afterCommit(db, func() {
+			cq.addToCache(prefCert, cert.CertificateID, cert)
+			cq.invalidateScopes(certScopes(cert)...)
+		})
 	}
 	return cert, err
 }
@@ -270,24 +481,171 @@ func (cq *CachedQueries) UpdateCertificate(ctx context.Context, db DBTX, arg Upd
 func (cq *CachedQueries) UpdateCourse(ctx context.Context, db DBTX, arg UpdateCourseParams) (Course, error) {
 	course, err := cq.Querier.UpdateCourse(ctx, db, arg)
 	if err == nil {
-		cq.addToCache(prefCourse, strconv.Itoa(int(arg.CourseID)), course)
-		cq.invalidateCertificates(ctx, db, prefCourse, arg.CourseID)
+		afterCommit(db, func() {
+			cq.addToCache(prefCourse, strconv.Itoa(int(arg.CourseID)), course)
+			cq.invalidateCertificates(prefCourse, arg.CourseID)
+			cq.invalidateScopes(scopeOf(prefCourse))
+			cq.invalidateScopePrefix(scopeCerts)
+		})
 	}
 	return course, err
 }
 func (cq *CachedQueries) UpdateStudent(ctx context.Context, db DBTX, arg UpdateStudentParams) (Student, error) {
 	student, err := cq.Querier.UpdateStudent(ctx, db, arg)
 	if err == nil {
-		cq.addToCache(prefStudent, strconv.Itoa(int(arg.StudentID)), student)
-		cq.invalidateCertificates(ctx, db, prefStudent, arg.StudentID)
+		afterCommit(db, func() {
+			cq.addToCache(prefStudent, strconv.Itoa(int(arg.StudentID)), student)
+			cq.invalidateCertificates(prefStudent, arg.StudentID)
+			cq.invalidateScopes(scopeOf(prefStudent))
+			cq.invalidateScopePrefix(scopeCerts)
+		})
 	}
 	return student, err
 }
 func (cq *CachedQueries) UpdateTemplate(ctx context.Context, db DBTX, arg UpdateTemplateParams) (Template, error) {
 	tmpl, err := cq.Querier.UpdateTemplate(ctx, db, arg)
 	if err == nil {
-		cq.addToCache(prefTmpl, strconv.Itoa(int(arg.TemplateID)), tmpl)
-		cq.invalidateCertificates(ctx, db, prefTmpl, arg.TemplateID)
+		afterCommit(db, func() {
+			cq.addToCache(prefTmpl, strconv.Itoa(int(arg.TemplateID)), tmpl)
+			cq.invalidateCertificates(prefTmpl, arg.TemplateID)
+			cq.invalidateScopes(scopeOf(prefTmpl))
+			cq.invalidateScopePrefix(scopeCerts)
+		})
 	}
 	return tmpl, err
 }
+
+func init() {
+	gob.Register(Certificate{})
+	gob.Register(Course{})
+	gob.Register(Student{})
+	gob.Register(Template{})
+	gob.Register([]Certificate{})
+	gob.Register([]Course{})
+	gob.Register([]Student{})
+	gob.Register([]Template{})
+}
+
+// responseCodec encodes cached responses for snapshots, types of responses
+// are registered with gob
+type responseCodec struct{}
+
+type encodedResponse struct {
+	Value any
+}
+
+func (responseCodec) Marshal(r CachedResponse) ([]byte, error) {
+	return cache.GobCodec[encodedResponse]{}.Marshal(encodedResponse{Value: r.value})
+}
+
+func (responseCodec) Unmarshal(data []byte) (CachedResponse, error) {
+	e, err := cache.GobCodec[encodedResponse]{}.Unmarshal(data)
+	if err != nil {
+		return CachedResponse{}, err
+	}
+	return newCachedResponse(e.Value), nil
+}
+
+func (cq *CachedQueries) snapshotter() (cache.Snapshotter[string, CachedResponse], error) {
+	s, ok := cq.c.Cache.(cache.Snapshotter[string, CachedResponse])
+	if !ok {
+		return nil, fmt.Errorf("snapshot of %T is not supported", cq.c.Cache)
+	}
+	return s, nil
+}
+
+// Snapshot writes cached responses, so cache can be restored after restart
+func (cq *CachedQueries) Snapshot(w io.Writer) error {
+	s, err := cq.snapshotter()
+	if err != nil {
+		return err
+	}
+	return s.Snapshot(w, responseCodec{})
+}
+
+// Restore loads cached responses of snapshot, snapshot older than maxAge is
+// skipped entirely, as responses may have been changed by other instances
+// since. Restored certificates are checked against database, ones changed or
+// deleted since are removed with their template, course, student and lists
+// they appear in. Changes of rows which were not cached can't be detected, so
+// maxAge should be positive and short.
+func (cq *CachedQueries) Restore(ctx context.Context, db DBTX, r io.Reader, maxAge time.Duration) (uint64, error) {
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("invalid max age %v, should be positive", maxAge)
+	}
+	s, err := cq.snapshotter()
+	if err != nil {
+		return 0, err
+	}
+	// keep is called under cache lock, so certificates and lists are indexed
+	// after
+	var certs []Certificate
+	var lists []string
+	restored, err := s.Restore(r, responseCodec{}, func(key string, r CachedResponse, created time.Time) bool {
+		if time.Since(created) > maxAge {
+			return false
+		}
+		if cert, ok := r.value.(Certificate); ok {
+			certs = append(certs, cert)
+		}
+		if _, ok := scopeOfKey(key); ok {
+			lists = append(lists, key)
+		}
+		return true
+	})
+	for _, cert := range certs {
+		cq.index.add(cert)
+	}
+	for _, key := range lists {
+		scope, _ := scopeOfKey(key)
+		cq.scopes.add(scope, key)
+	}
+	if err != nil {
+		return restored, err
+	}
+	stale, err := cq.removeStale(ctx, db, certs)
+	if err != nil {
+		cq.purge()
+		return 0, err
+	}
+	slog.Info("restored queries cache snapshot", slog.Uint64("restored", restored-stale), slog.Uint64("stale", stale))
+	return restored - stale, nil
+}
+
+// removeStale removes restored certificates which differ from database, with
+// responses depending on them, return number of removed responses
+func (cq *CachedQueries) removeStale(ctx context.Context, db DBTX, certs []Certificate) (uint64, error) {
+	var keys, scopes []string
+	for _, cert := range certs {
+		current, err := cq.Querier.GetCertificate(ctx, db, cert.CertificateID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("failed to check restored certificate %s: %w", cert.CertificateID, err)
+		}
+		if err == nil && current.Timestamp.Valid == cert.Timestamp.Valid && current.Timestamp.Time.Equal(cert.Timestamp.Time) {
+			continue
+		}
+		keys = append(keys,
+			prefCert.key(cert.CertificateID),
+			prefTmpl.key(strconv.Itoa(int(cert.TemplateID))),
+			prefCourse.key(strconv.Itoa(int(cert.CourseID))),
+			prefStudent.key(strconv.Itoa(int(cert.StudentID))),
+		)
+		scopes = append(scopes, certScopes(cert)...)
+		if err == nil {
+			scopes = append(scopes, certScopes(current)...)
+		}
+		cq.index.remove(cert.CertificateID)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	keys = append(keys, cq.scopes.take(scopes...)...)
+	removed := make(map[string]struct{})
+	for _, key := range keys {
+		if cq.c.Contains(key) {
+			removed[key] = struct{}{}
+		}
+	}
+	cq.removeKeys(keys)
+	return uint64(len(removed)), nil
+}
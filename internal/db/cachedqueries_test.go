@@ -1,22 +1,25 @@
 package db
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/eklmv/pdfcertificates/internal/cache"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func prepCachedQueries(tb testing.TB) (cq *CachedQueries, c cache.Cache[uint32, cachedResponse], m *MockQuerier) {
+func prepCachedQueries(tb testing.TB) (cq *CachedQueries, c cache.Cache[string, CachedResponse], m *MockQuerier) {
 	tb.Helper()
 	m = NewMockQuerier(tb)
-	c = cache.NewSafeCache(cache.NewLRUCache[uint32, cachedResponse](0))
+	c = cache.NewSafeCache(cache.NewLRUCache[string, CachedResponse](0))
 	cq = NewCachedQueries(c, m)
 	return
 }
@@ -49,8 +52,8 @@ func TestCachedQueriesCreateCertificate(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCert.String() + exp.CertificateID)
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCert.String() + exp.CertificateID
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -72,8 +75,8 @@ func TestCachedQueriesCreateCourse(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCourse.String() + strconv.Itoa(int(exp.CourseID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCourse.String() + strconv.Itoa(int(exp.CourseID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -95,8 +98,8 @@ func TestCachedQueriesCreateStudent(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefStudent.String() + strconv.Itoa(int(exp.StudentID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefStudent.String() + strconv.Itoa(int(exp.StudentID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -118,8 +121,8 @@ func TestCachedQueriesCreateTemplate(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefTmpl.String() + strconv.Itoa(int(exp.TemplateID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefTmpl.String() + strconv.Itoa(int(exp.TemplateID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -362,8 +365,8 @@ func TestCachedQueriesGetCertificate(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCert.String() + exp.CertificateID)
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCert.String() + exp.CertificateID
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -402,8 +405,8 @@ func TestCachedQueriesGetCourse(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCourse.String() + strconv.Itoa(int(exp.CourseID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCourse.String() + strconv.Itoa(int(exp.CourseID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -442,8 +445,8 @@ func TestCachedQueriesGetStudent(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefStudent.String() + strconv.Itoa(int(exp.StudentID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefStudent.String() + strconv.Itoa(int(exp.StudentID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -482,8 +485,8 @@ func TestCachedQueriesGetTemplate(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefTmpl.String() + strconv.Itoa(int(exp.TemplateID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefTmpl.String() + strconv.Itoa(int(exp.TemplateID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -513,8 +516,8 @@ func TestCachedQueriesUpdateCertificate(t *testing.T) {
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCert.String() + exp.CertificateID)
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCert.String() + exp.CertificateID
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -580,20 +583,14 @@ func TestCachedQueriesUpdateCourse(t *testing.T) {
 		require.Equal(t, uint64(1), c.Len())
 
 		m.EXPECT().UpdateCourse(ctx, nil, UpdateCourseParams{}).Return(exp, nil).Once()
-		m.EXPECT().ListCertificatesByCourseLen(ctx, nil, exp.CourseID).Return(1, nil).Once()
-		m.EXPECT().ListCertificatesByCourse(ctx, nil, ListCertificatesByCourseParams{
-			CourseID: exp.CourseID,
-			Limit:    1,
-			Offset:   0,
-		}).Return([]Certificate{cert}, nil).Once()
 		got, err := cq.UpdateCourse(ctx, nil, UpdateCourseParams{})
 
 		assert.NoError(t, err)
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefCourse.String() + strconv.Itoa(int(exp.CourseID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefCourse.String() + strconv.Itoa(int(exp.CourseID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -659,20 +656,14 @@ func TestCachedQueriesUpdateStudent(t *testing.T) {
 		require.Equal(t, uint64(1), c.Len())
 
 		m.EXPECT().UpdateStudent(ctx, nil, UpdateStudentParams{}).Return(exp, nil).Once()
-		m.EXPECT().ListCertificatesByStudentLen(ctx, nil, exp.StudentID).Return(1, nil).Once()
-		m.EXPECT().ListCertificatesByStudent(ctx, nil, ListCertificatesByStudentParams{
-			StudentID: exp.StudentID,
-			Limit:     1,
-			Offset:    0,
-		}).Return([]Certificate{cert}, nil).Once()
 		got, err := cq.UpdateStudent(ctx, nil, UpdateStudentParams{})
 
 		assert.NoError(t, err)
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefStudent.String() + strconv.Itoa(int(exp.StudentID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefStudent.String() + strconv.Itoa(int(exp.StudentID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -738,20 +729,14 @@ func TestCachedQueriesUpdateTemplate(t *testing.T) {
 		require.Equal(t, uint64(1), c.Len())
 
 		m.EXPECT().UpdateTemplate(ctx, nil, UpdateTemplateParams{}).Return(exp, nil).Once()
-		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, exp.TemplateID).Return(1, nil).Once()
-		m.EXPECT().ListCertificatesByTemplate(ctx, nil, ListCertificatesByTemplateParams{
-			TemplateID: exp.TemplateID,
-			Limit:      1,
-			Offset:     0,
-		}).Return([]Certificate{cert}, nil).Once()
 		got, err := cq.UpdateTemplate(ctx, nil, UpdateTemplateParams{})
 
 		assert.NoError(t, err)
 		assert.Equal(t, exp, got)
 		m.AssertExpectations(t)
 
-		hash := cache.HashString(prefTmpl.String() + strconv.Itoa(int(exp.TemplateID)))
-		assert.Contains(t, c.Keys(), hash)
+		key := prefTmpl.String() + strconv.Itoa(int(exp.TemplateID))
+		assert.Contains(t, c.Keys(), key)
 		assert.Equal(t, uint64(1), c.Len())
 		assert.Equal(t, exp, c.Values()[0].value)
 	})
@@ -790,3 +775,317 @@ func TestCachedQueriesUpdateTemplate(t *testing.T) {
 		m.AssertExpectations(t)
 	})
 }
+
+func TestCachedQueriesCollidingKeys(t *testing.T) {
+	t.Run("certificates with colliding hashes of keys cached separately", func(t *testing.T) {
+		// FNV-1a 32-bit hashes of prefixed ids are equal
+		first, second := "000179bb", "00054848"
+		require.Equal(t, cache.HashString(prefCert.key(first)), cache.HashString(prefCert.key(second)))
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		firstCert := Certificate{CertificateID: first, Data: []byte{}}
+		secondCert := Certificate{CertificateID: second, StudentID: 1, Data: []byte{}}
+		m.EXPECT().GetCertificate(ctx, nil, first).Return(firstCert, nil).Once()
+		m.EXPECT().GetCertificate(ctx, nil, second).Return(secondCert, nil).Once()
+
+		_, err := cq.GetCertificate(ctx, nil, first)
+		require.NoError(t, err)
+		got, err := cq.GetCertificate(ctx, nil, second)
+		require.NoError(t, err)
+
+		assert.Equal(t, secondCert, got)
+		assert.Equal(t, uint64(2), c.Len())
+		got, err = cq.GetCertificate(ctx, nil, first)
+		require.NoError(t, err)
+		assert.Equal(t, firstCert, got)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedQueriesWithShardedCache(t *testing.T) {
+	t.Run("responses cached in given sharded cache", func(t *testing.T) {
+		id := "00000000"
+		m := NewMockQuerier(t)
+		c := cache.NewShardedCache[string, CachedResponse](4, 0, cache.HashKey)
+		cq := NewCachedQueries(c, m)
+		ctx := context.Background()
+		exp := Certificate{CertificateID: id, Data: []byte("{}")}
+		m.EXPECT().GetCertificate(ctx, nil, id).Return(exp, nil).Once()
+
+		_, err := cq.GetCertificate(ctx, nil, id)
+		require.NoError(t, err)
+		got, err := cq.GetCertificate(ctx, nil, id)
+		require.NoError(t, err)
+
+		assert.Equal(t, exp, got)
+		assert.Equal(t, uint64(1), c.Len())
+	})
+}
+
+type testObserver struct {
+	hits   []string
+	misses []string
+}
+
+func (o *testObserver) Hit(key string) {
+	o.hits = append(o.hits, key)
+}
+
+func (o *testObserver) Miss(key string) {
+	o.misses = append(o.misses, key)
+}
+
+func TestCachedQueriesObserver(t *testing.T) {
+	t.Run("observer notified about hits and misses, stats counted by cache", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		o := &testObserver{}
+		cq.SetObserver(o)
+		ctx := context.Background()
+		exp := Course{CourseID: 1}
+		m.EXPECT().GetCourse(ctx, nil, exp.CourseID).Return(exp, nil).Once()
+
+		_, err := cq.GetCourse(ctx, nil, exp.CourseID)
+		require.NoError(t, err)
+		got, err := cq.GetCourse(ctx, nil, exp.CourseID)
+		require.NoError(t, err)
+
+		assert.Equal(t, exp, got)
+		key := prefCourse.key("1")
+		assert.Equal(t, []string{key}, o.hits)
+		assert.Equal(t, []string{key}, o.misses)
+		stats := cq.CacheStats()
+		assert.Equal(t, uint64(1), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+		assert.Equal(t, uint64(1), stats.Len)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedQueriesGetOrQuery(t *testing.T) {
+	t.Run("concurrent requests of the same certificate make single db request", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		workers := 10
+		exp := Certificate{CertificateID: "00000000"}
+		release := make(chan time.Time)
+		m.EXPECT().GetCertificate(ctx, nil, exp.CertificateID).Return(exp, nil).Once().WaitUntil(release)
+
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer complete.Done()
+				got, err := cq.GetCertificate(ctx, nil, exp.CertificateID)
+				assert.NoError(t, err)
+				assert.Equal(t, exp, got)
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		complete.Wait()
+
+		m.AssertExpectations(t)
+	})
+	t.Run("if negative caching enabled, not found response cached until created", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		cq.SetNegativeCaching(10, time.Minute)
+		ctx := context.Background()
+		exp := Course{CourseID: 1}
+		m.EXPECT().GetCourse(ctx, nil, exp.CourseID).Return(Course{}, pgx.ErrNoRows).Once()
+
+		_, err := cq.GetCourse(ctx, nil, exp.CourseID)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = cq.GetCourse(ctx, nil, exp.CourseID)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		m.EXPECT().CreateCourse(ctx, nil, []byte{}).Return(exp, nil).Once()
+		_, err = cq.CreateCourse(ctx, nil, []byte{})
+		require.NoError(t, err)
+		got, err := cq.GetCourse(ctx, nil, exp.CourseID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+		m.AssertExpectations(t)
+	})
+	t.Run("if negative caching disabled, not found response is not cached", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		m.EXPECT().GetStudent(ctx, nil, int32(1)).Return(Student{}, pgx.ErrNoRows).Twice()
+
+		_, err := cq.GetStudent(ctx, nil, 1)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = cq.GetStudent(ctx, nil, 1)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		m.AssertExpectations(t)
+	})
+	t.Run("if cached value has unexpected type, make db request and cache result", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		exp := Template{TemplateID: 1}
+		c.Add(prefTmpl.key("1"), newCachedResponse(Course{CourseID: 1}))
+		m.EXPECT().GetTemplate(ctx, nil, exp.TemplateID).Return(exp, nil).Once()
+
+		got, err := cq.GetTemplate(ctx, nil, exp.TemplateID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedQueriesResponseSize(t *testing.T) {
+	t.Run("size of cached response accounts for data payload", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		small := Course{CourseID: 1, Data: []byte(`{}`)}
+		large := Course{CourseID: 2, Data: make([]byte, 1000)}
+		m.EXPECT().CreateCourse(ctx, nil, small.Data).Return(small, nil).Once()
+		m.EXPECT().CreateCourse(ctx, nil, large.Data).Return(large, nil).Once()
+
+		_, err := cq.CreateCourse(ctx, nil, small.Data)
+		require.NoError(t, err)
+		smallSize := c.Size()
+		_, err = cq.CreateCourse(ctx, nil, large.Data)
+		require.NoError(t, err)
+
+		assert.Equal(t, smallSize+uint64(len(large.Data)-len(small.Data)), c.Size()-smallSize)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedQueriesSnapshot(t *testing.T) {
+	t.Run("restore responses of all types", func(t *testing.T) {
+		src, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		cert := Certificate{
+			CertificateID: "00000000",
+			Timestamp: pgtype.Timestamptz{
+				Time:  time.Now().Truncate(time.Microsecond),
+				Valid: true,
+			},
+			Data: []byte(`{}`),
+		}
+		course := Course{CourseID: 1, Data: []byte(`{"name":"course"}`)}
+		student := Student{StudentID: 2, Data: []byte(`{"name":"student"}`)}
+		tmpl := Template{TemplateID: 3, Content: "content"}
+		m.EXPECT().CreateCertificate(ctx, nil, CreateCertificateParams{}).Return(cert, nil).Once()
+		m.EXPECT().CreateCourse(ctx, nil, course.Data).Return(course, nil).Once()
+		m.EXPECT().CreateStudent(ctx, nil, student.Data).Return(student, nil).Once()
+		m.EXPECT().CreateTemplate(ctx, nil, tmpl.Content).Return(tmpl, nil).Once()
+		_, err := src.CreateCertificate(ctx, nil, CreateCertificateParams{})
+		require.NoError(t, err)
+		_, err = src.CreateCourse(ctx, nil, course.Data)
+		require.NoError(t, err)
+		_, err = src.CreateStudent(ctx, nil, student.Data)
+		require.NoError(t, err)
+		_, err = src.CreateTemplate(ctx, nil, tmpl.Content)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+
+		got, c, gm := prepCachedQueries(t)
+		gm.EXPECT().GetCertificate(ctx, nil, cert.CertificateID).Return(cert, nil).Once()
+		restored, err := got.Restore(ctx, nil, &buf, time.Minute)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), restored)
+		gotCert, err := got.GetCertificate(ctx, nil, cert.CertificateID)
+		require.NoError(t, err)
+		assert.True(t, cert.Timestamp.Time.Equal(gotCert.Timestamp.Time))
+		gotCourse, err := got.GetCourse(ctx, nil, course.CourseID)
+		require.NoError(t, err)
+		assert.Equal(t, course, gotCourse)
+		gotStudent, err := got.GetStudent(ctx, nil, student.StudentID)
+		require.NoError(t, err)
+		assert.Equal(t, student, gotStudent)
+		gotTmpl, err := got.GetTemplate(ctx, nil, tmpl.TemplateID)
+		require.NoError(t, err)
+		assert.Equal(t, tmpl, gotTmpl)
+		assert.Equal(t, uint64(4), c.Stats().Hits)
+		m.AssertExpectations(t)
+	})
+	t.Run("snapshot older than max age skipped", func(t *testing.T) {
+		src, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		m.EXPECT().CreateTemplate(ctx, nil, "content").Return(Template{TemplateID: 1}, nil).Once()
+		_, err := src.CreateTemplate(ctx, nil, "content")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+		time.Sleep(2 * time.Millisecond)
+
+		got, c, _ := prepCachedQueries(t)
+		restored, err := got.Restore(ctx, nil, &buf, time.Millisecond)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), restored)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("zero max age rejected", func(t *testing.T) {
+		got, c, _ := prepCachedQueries(t)
+
+		_, err := got.Restore(context.Background(), nil, &bytes.Buffer{}, 0)
+
+		assert.ErrorContains(t, err, "max age")
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("certificates changed or deleted since snapshot removed with responses depending on them", func(t *testing.T) {
+		src, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		timestamp := pgtype.Timestamptz{Time: time.Now().Truncate(time.Microsecond), Valid: true}
+		changed := Certificate{CertificateID: "0000000a", TemplateID: 1, CourseID: 1, StudentID: 1, Timestamp: timestamp}
+		deleted := Certificate{CertificateID: "0000000b", TemplateID: 2, CourseID: 2, StudentID: 2, Timestamp: timestamp}
+		kept := Certificate{CertificateID: "0000000c", TemplateID: 3, CourseID: 3, StudentID: 3, Timestamp: timestamp}
+		for _, cert := range []Certificate{changed, deleted, kept} {
+			m.EXPECT().GetCertificate(ctx, nil, cert.CertificateID).Return(cert, nil).Once()
+			_, err := src.GetCertificate(ctx, nil, cert.CertificateID)
+			require.NoError(t, err)
+		}
+		m.EXPECT().GetCourse(ctx, nil, int32(1)).Return(Course{CourseID: 1}, nil).Once()
+		_, err := src.GetCourse(ctx, nil, 1)
+		require.NoError(t, err)
+		for _, course := range []int32{1, 3} {
+			m.EXPECT().ListCertificatesByCourseLen(ctx, nil, course).Return(1, nil).Once()
+			_, err := src.ListCertificatesByCourseLen(ctx, nil, course)
+			require.NoError(t, err)
+		}
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+
+		got, c, gm := prepCachedQueries(t)
+		updated := changed
+		updated.Timestamp.Time = timestamp.Time.Add(time.Second)
+		gm.EXPECT().GetCertificate(ctx, nil, changed.CertificateID).Return(updated, nil).Once()
+		gm.EXPECT().GetCertificate(ctx, nil, deleted.CertificateID).Return(Certificate{}, pgx.ErrNoRows).Once()
+		gm.EXPECT().GetCertificate(ctx, nil, kept.CertificateID).Return(kept, nil).Once()
+		restored, err := got.Restore(ctx, nil, &buf, time.Minute)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), restored)
+		assert.Equal(t, uint64(2), c.Len())
+		assert.True(t, c.Contains(prefCert.key(kept.CertificateID)))
+		l, err := got.ListCertificatesByCourseLen(ctx, nil, 3)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), l)
+		gm.AssertExpectations(t)
+	})
+	t.Run("restored responses discarded if certificates can't be checked", func(t *testing.T) {
+		src, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		cert := Certificate{CertificateID: "00000000"}
+		m.EXPECT().GetCertificate(ctx, nil, cert.CertificateID).Return(cert, nil).Once()
+		_, err := src.GetCertificate(ctx, nil, cert.CertificateID)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+
+		got, c, gm := prepCachedQueries(t)
+		gm.EXPECT().GetCertificate(ctx, nil, cert.CertificateID).Return(Certificate{}, fmt.Errorf("connection refused")).Once()
+		restored, err := got.Restore(ctx, nil, &buf, time.Minute)
+
+		assert.ErrorContains(t, err, "connection refused")
+		assert.Equal(t, uint64(0), restored)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+}
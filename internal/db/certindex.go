@@ -0,0 +1,131 @@
+package db
+
+import "sync"
+
+// certIndex maps templates, courses and students to cached certificates
+// linked to them, so certificates can be invalidated without database
+// requests. Certificates are indexed before they are cached, so index may
+// refer to certificates never cached or already evicted, invalidating them is
+// harmless, they are pruned once index outgrows cache.
+type certIndex struct {
+	mu     sync.Mutex
+	owners map[string]certOwners
+	linked map[prefix]map[int32]map[string]struct{}
+}
+
+type certOwners struct {
+	template int32
+	course   int32
+	student  int32
+}
+
+// certIndexMinPrune is a size of index below which it is never pruned
+const certIndexMinPrune = 1024
+
+func newCertIndex() *certIndex {
+	i := &certIndex{}
+	i.reset()
+	return i
+}
+
+func ownersOf(cert Certificate) certOwners {
+	return certOwners{template: cert.TemplateID, course: cert.CourseID, student: cert.StudentID}
+}
+
+func (o certOwners) of(p prefix) int32 {
+	switch p {
+	case prefTmpl:
+		return o.template
+	case prefCourse:
+		return o.course
+	default:
+		return o.student
+	}
+}
+
+func (i *certIndex) add(cert Certificate) {
+	i.addWith(cert, func() {})
+}
+
+// addWith indexes certificate and calls fn under lock, so certificate can be
+// cached without being pruned meanwhile
+func (i *certIndex) addWith(cert Certificate, fn func()) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	defer fn()
+	i.removeLocked(cert.CertificateID)
+	o := ownersOf(cert)
+	i.owners[cert.CertificateID] = o
+	for p, ids := range i.linked {
+		certs, ok := ids[o.of(p)]
+		if !ok {
+			certs = make(map[string]struct{})
+			ids[o.of(p)] = certs
+		}
+		certs[cert.CertificateID] = struct{}{}
+	}
+}
+
+func (i *certIndex) remove(certificateID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.removeLocked(certificateID)
+}
+
+func (i *certIndex) removeLocked(certificateID string) {
+	o, ok := i.owners[certificateID]
+	if !ok {
+		return
+	}
+	delete(i.owners, certificateID)
+	for p, ids := range i.linked {
+		certs := ids[o.of(p)]
+		delete(certs, certificateID)
+		if len(certs) == 0 {
+			delete(ids, o.of(p))
+		}
+	}
+}
+
+// linkedTo return certificates linked to template, course or student with
+// given id
+func (i *certIndex) linkedTo(p prefix, id int32) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	certs := make([]string, 0, len(i.linked[p][id]))
+	for c := range i.linked[p][id] {
+		certs = append(certs, c)
+	}
+	return certs
+}
+
+func (i *certIndex) len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.owners)
+}
+
+func (i *certIndex) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.owners = make(map[string]certOwners)
+	i.linked = map[prefix]map[int32]map[string]struct{}{
+		prefTmpl:    make(map[int32]map[string]struct{}),
+		prefCourse:  make(map[int32]map[string]struct{}),
+		prefStudent: make(map[int32]map[string]struct{}),
+	}
+}
+
+// prune removes certificates which are no longer cached. Loads in flight
+// would be stored after being indexed, so they are discarded by
+// discardLoads before cache is checked.
+func (i *certIndex) prune(cached func(certificateID string) bool, discardLoads func()) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	discardLoads()
+	for id := range i.owners {
+		if !cached(id) {
+			i.removeLocked(id)
+		}
+	}
+}
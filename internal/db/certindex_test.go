@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertIndex(t *testing.T) {
+	t.Run("certificates linked to template, course and student", func(t *testing.T) {
+		i := newCertIndex()
+		i.add(Certificate{CertificateID: "00000000", TemplateID: 1, CourseID: 2, StudentID: 3})
+		i.add(Certificate{CertificateID: "00000001", TemplateID: 1, CourseID: 4, StudentID: 3})
+
+		assert.ElementsMatch(t, []string{"00000000", "00000001"}, i.linkedTo(prefTmpl, 1))
+		assert.ElementsMatch(t, []string{"00000000"}, i.linkedTo(prefCourse, 2))
+		assert.ElementsMatch(t, []string{"00000001"}, i.linkedTo(prefCourse, 4))
+		assert.ElementsMatch(t, []string{"00000000", "00000001"}, i.linkedTo(prefStudent, 3))
+		assert.Empty(t, i.linkedTo(prefStudent, 1))
+	})
+	t.Run("readded certificate linked only to its new owners", func(t *testing.T) {
+		i := newCertIndex()
+		i.add(Certificate{CertificateID: "00000000", TemplateID: 1, CourseID: 2, StudentID: 3})
+		i.add(Certificate{CertificateID: "00000000", TemplateID: 1, CourseID: 5, StudentID: 3})
+
+		assert.Empty(t, i.linkedTo(prefCourse, 2))
+		assert.Equal(t, []string{"00000000"}, i.linkedTo(prefCourse, 5))
+		assert.Equal(t, 1, i.len())
+	})
+	t.Run("removed certificate unlinked from all owners", func(t *testing.T) {
+		i := newCertIndex()
+		i.add(Certificate{CertificateID: "00000000", TemplateID: 1, CourseID: 2, StudentID: 3})
+
+		i.remove("00000000")
+
+		assert.Empty(t, i.linkedTo(prefTmpl, 1))
+		assert.Empty(t, i.linkedTo(prefCourse, 2))
+		assert.Empty(t, i.linkedTo(prefStudent, 3))
+		assert.Equal(t, 0, i.len())
+		assert.Empty(t, i.linked[prefCourse])
+	})
+	t.Run("prune removes certificates which are not cached and discards loads", func(t *testing.T) {
+		i := newCertIndex()
+		i.add(Certificate{CertificateID: "00000000", CourseID: 1})
+		i.add(Certificate{CertificateID: "00000001", CourseID: 1})
+		var discarded bool
+
+		i.prune(func(id string) bool { return id == "00000001" }, func() { discarded = true })
+
+		assert.True(t, discarded)
+		assert.Equal(t, []string{"00000001"}, i.linkedTo(prefCourse, 1))
+	})
+}
+
+func TestCachedQueriesCertIndex(t *testing.T) {
+	t.Run("certificates loaded from db invalidated by update of linked student without db requests", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		linked := Certificate{CertificateID: "00000000", StudentID: 1}
+		other := Certificate{CertificateID: "00000001", StudentID: 2}
+		m.EXPECT().GetCertificate(ctx, nil, linked.CertificateID).Return(linked, nil).Once()
+		m.EXPECT().GetCertificate(ctx, nil, other.CertificateID).Return(other, nil).Once()
+		_, err := cq.GetCertificate(ctx, nil, linked.CertificateID)
+		require.NoError(t, err)
+		_, err = cq.GetCertificate(ctx, nil, other.CertificateID)
+		require.NoError(t, err)
+
+		student := Student{StudentID: 1}
+		m.EXPECT().UpdateStudent(ctx, nil, UpdateStudentParams{StudentID: 1}).Return(student, nil).Once()
+		_, err = cq.UpdateStudent(ctx, nil, UpdateStudentParams{StudentID: 1})
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{prefCert.key(other.CertificateID), prefStudent.key("1")}, c.Keys())
+		assert.Empty(t, cq.index.linkedTo(prefStudent, 1))
+		m.AssertExpectations(t)
+	})
+	t.Run("index pruned once it outgrows cache", func(t *testing.T) {
+		cq, c, _ := prepCachedQueries(t)
+		for n := 0; n < certIndexMinPrune; n++ {
+			// certificates indexed, but never cached or already evicted
+			cq.index.add(Certificate{CertificateID: fmt.Sprintf("%08x", n), CourseID: 1})
+		}
+		cert := Certificate{CertificateID: "cached00", CourseID: 1}
+
+		cq.addToCache(prefCert, cert.CertificateID, cert)
+
+		assert.Equal(t, []string{prefCert.key(cert.CertificateID)}, c.Keys())
+		assert.Equal(t, []string{cert.CertificateID}, cq.index.linkedTo(prefCourse, 1))
+	})
+	t.Run("InvalidateAll resets index", func(t *testing.T) {
+		cq, _, _ := prepCachedQueries(t)
+		cq.addToCache(prefCert, "00000000", Certificate{CertificateID: "00000000", CourseID: 1})
+
+		cq.InvalidateAll()
+
+		assert.Equal(t, 0, cq.index.len())
+	})
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testQuerierConformance checks behaviour of Querier implementation against
+// expectations of database schema, it is run for Queries on real database and
+// for MemoryQueries, so both behave the same. Rows created by other tests may
+// be present.
+func testQuerierConformance(t *testing.T, q Querier, db DBTX) {
+	ctx := context.Background()
+	// missing is an id which is never generated by serial sequences in tests
+	const missing = math.MaxInt32
+	requirePgError := func(t *testing.T, err error, code string) {
+		t.Helper()
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr), "expected *pgconn.PgError, got %v", err)
+		assert.Equal(t, code, pgErr.Code)
+	}
+	newCertificate := func(t *testing.T) Certificate {
+		t.Helper()
+		tmpl, err := q.CreateTemplate(ctx, db, "content")
+		require.NoError(t, err)
+		course, err := q.CreateCourse(ctx, db, nil)
+		require.NoError(t, err)
+		student, err := q.CreateStudent(ctx, db, nil)
+		require.NoError(t, err)
+		cert, err := q.CreateCertificate(ctx, db, CreateCertificateParams{
+			TemplateID: tmpl.TemplateID,
+			CourseID:   course.CourseID,
+			StudentID:  student.StudentID,
+		})
+		require.NoError(t, err)
+		return cert
+	}
+
+	t.Run("created rows can be read back", func(t *testing.T) {
+		tmpl, err := q.CreateTemplate(ctx, db, "content")
+		require.NoError(t, err)
+		course, err := q.CreateCourse(ctx, db, []byte(`{"title": "course"}`))
+		require.NoError(t, err)
+		student, err := q.CreateStudent(ctx, db, []byte(`{"name": "student"}`))
+		require.NoError(t, err)
+		cert, err := q.CreateCertificate(ctx, db, CreateCertificateParams{
+			TemplateID: tmpl.TemplateID,
+			CourseID:   course.CourseID,
+			StudentID:  student.StudentID,
+		})
+		require.NoError(t, err)
+
+		gotTmpl, err := q.GetTemplate(ctx, db, tmpl.TemplateID)
+		require.NoError(t, err)
+		assert.Equal(t, tmpl, gotTmpl)
+		gotCourse, err := q.GetCourse(ctx, db, course.CourseID)
+		require.NoError(t, err)
+		assert.Equal(t, course, gotCourse)
+		gotStudent, err := q.GetStudent(ctx, db, student.StudentID)
+		require.NoError(t, err)
+		assert.Equal(t, student, gotStudent)
+		gotCert, err := q.GetCertificate(ctx, db, cert.CertificateID)
+		require.NoError(t, err)
+		assert.True(t, cert.Timestamp.Time.Equal(gotCert.Timestamp.Time))
+		cert.Timestamp, gotCert.Timestamp = gotCert.Timestamp, cert.Timestamp
+		assert.Equal(t, cert, gotCert)
+	})
+	t.Run("serial ids are increasing and not reused after delete", func(t *testing.T) {
+		first, err := q.CreateCourse(ctx, db, nil)
+		require.NoError(t, err)
+		_, err = q.DeleteCourse(ctx, db, first.CourseID)
+		require.NoError(t, err)
+
+		second, err := q.CreateCourse(ctx, db, nil)
+		require.NoError(t, err)
+
+		assert.Greater(t, second.CourseID, first.CourseID)
+	})
+	t.Run("certificate id is 8 lowercase hex digits, timestamp is set", func(t *testing.T) {
+		before := time.Now().Add(-time.Second)
+
+		cert := newCertificate(t)
+
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}$`), cert.CertificateID)
+		assert.True(t, cert.Timestamp.Valid)
+		assert.True(t, cert.Timestamp.Time.After(before))
+	})
+	t.Run("nil data stored as empty object", func(t *testing.T) {
+		cert := newCertificate(t)
+
+		assert.Equal(t, "{}", string(cert.Data))
+	})
+	t.Run("data normalized as jsonb", func(t *testing.T) {
+		cases := map[string]string{
+			`{"b":1,"a":{"c":[1,2,"x"]}}`:        `{"a": {"c": [1, 2, "x"]}, "b": 1}`,
+			`{"bb": 1, "a": 2, "c": 3}`:          `{"a": 2, "c": 3, "bb": 1}`,
+			`{"a": 1, "a": 2}`:                   `{"a": 2}`,
+			` [ ] `:                              `[]`,
+			`{"n": [1.50, 1e2, 1.5e-1, -0]}`:     `{"n": [1.50, 100, 0.15, 0]}`,
+			`{"s": "line\nbreak \"q\" é /"}`:     `{"s": "line\nbreak \"q\" é /"}`,
+			`{"t": true, "f": false, "z": null}`: `{"f": false, "t": true, "z": null}`,
+		}
+		for in, exp := range cases {
+			course, err := q.CreateCourse(ctx, db, []byte(in))
+			require.NoError(t, err, in)
+			assert.Equal(t, exp, string(course.Data), in)
+		}
+	})
+	t.Run("invalid json rejected", func(t *testing.T) {
+		for _, data := range []string{"some string", "{ 'key': 'value', }", `{"a": 1,}`} {
+			_, err := q.CreateStudent(ctx, db, []byte(data))
+			requirePgError(t, err, "22P02")
+		}
+	})
+	t.Run("empty template content rejected", func(t *testing.T) {
+		_, err := q.CreateTemplate(ctx, db, "")
+		requirePgError(t, err, "23514")
+
+		tmpl, err := q.CreateTemplate(ctx, db, "content")
+		require.NoError(t, err)
+		_, err = q.UpdateTemplate(ctx, db, UpdateTemplateParams{TemplateID: tmpl.TemplateID})
+		requirePgError(t, err, "23514")
+	})
+	t.Run("certificate of missing template, course or student rejected", func(t *testing.T) {
+		cert := newCertificate(t)
+		for _, p := range []CreateCertificateParams{
+			{TemplateID: missing, CourseID: cert.CourseID, StudentID: cert.StudentID},
+			{TemplateID: cert.TemplateID, CourseID: missing, StudentID: cert.StudentID},
+			{TemplateID: cert.TemplateID, CourseID: cert.CourseID, StudentID: missing},
+		} {
+			_, err := q.CreateCertificate(ctx, db, p)
+			requirePgError(t, err, "23503")
+		}
+	})
+	t.Run("delete of referenced template, course or student restricted", func(t *testing.T) {
+		cert := newCertificate(t)
+
+		_, err := q.DeleteTemplate(ctx, db, cert.TemplateID)
+		requirePgError(t, err, "23503")
+		_, err = q.DeleteCourse(ctx, db, cert.CourseID)
+		requirePgError(t, err, "23503")
+		_, err = q.DeleteStudent(ctx, db, cert.StudentID)
+		requirePgError(t, err, "23503")
+
+		_, err = q.DeleteCertificate(ctx, db, cert.CertificateID)
+		require.NoError(t, err)
+		_, err = q.DeleteTemplate(ctx, db, cert.TemplateID)
+		assert.NoError(t, err)
+		_, err = q.DeleteCourse(ctx, db, cert.CourseID)
+		assert.NoError(t, err)
+		_, err = q.DeleteStudent(ctx, db, cert.StudentID)
+		assert.NoError(t, err)
+	})
+	t.Run("missing rows reported as no rows", func(t *testing.T) {
+		_, err := q.GetCertificate(ctx, db, "zzzzzzzz")
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.UpdateCertificate(ctx, db, UpdateCertificateParams{CertificateID: "zzzzzzzz"})
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.DeleteCertificate(ctx, db, "zzzzzzzz")
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.GetCourse(ctx, db, missing)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.UpdateStudent(ctx, db, UpdateStudentParams{StudentID: missing})
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.UpdateTemplate(ctx, db, UpdateTemplateParams{TemplateID: missing, Content: "content"})
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		_, err = q.DeleteTemplate(ctx, db, missing)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+	t.Run("certificate update bumps its timestamp", func(t *testing.T) {
+		cert := newCertificate(t)
+
+		got, err := q.UpdateCertificate(ctx, db, UpdateCertificateParams{
+			CertificateID: cert.CertificateID,
+			Data:          []byte(`{"a": 1}`),
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, `{"a": 1}`, string(got.Data))
+		assert.True(t, got.Timestamp.Time.After(cert.Timestamp.Time))
+	})
+	t.Run("update of template, course or student bumps timestamps of linked certificates only", func(t *testing.T) {
+		updates := map[string]func(cert Certificate) error{
+			"template": func(cert Certificate) error {
+				_, err := q.UpdateTemplate(ctx, db, UpdateTemplateParams{TemplateID: cert.TemplateID, Content: "new"})
+				return err
+			},
+			"course": func(cert Certificate) error {
+				_, err := q.UpdateCourse(ctx, db, UpdateCourseParams{CourseID: cert.CourseID})
+				return err
+			},
+			"student": func(cert Certificate) error {
+				_, err := q.UpdateStudent(ctx, db, UpdateStudentParams{StudentID: cert.StudentID})
+				return err
+			},
+		}
+		for name, update := range updates {
+			linked := newCertificate(t)
+			other := newCertificate(t)
+
+			require.NoError(t, update(linked), name)
+
+			got, err := q.GetCertificate(ctx, db, linked.CertificateID)
+			require.NoError(t, err)
+			assert.True(t, got.Timestamp.Time.After(linked.Timestamp.Time), name)
+			got, err = q.GetCertificate(ctx, db, other.CertificateID)
+			require.NoError(t, err)
+			assert.True(t, got.Timestamp.Time.Equal(other.Timestamp.Time), name)
+		}
+	})
+	t.Run("lists paginated in order of ids", func(t *testing.T) {
+		cert := newCertificate(t)
+		ids := []string{cert.CertificateID}
+		for i := 0; i < 4; i++ {
+			c, err := q.CreateCertificate(ctx, db, CreateCertificateParams{
+				TemplateID: cert.TemplateID,
+				CourseID:   cert.CourseID,
+				StudentID:  cert.StudentID,
+			})
+			require.NoError(t, err)
+			ids = append(ids, c.CertificateID)
+		}
+		sort.Strings(ids)
+
+		var got []string
+		for offset := int64(0); offset < 6; offset += 2 {
+			page, err := q.ListCertificatesByCourse(ctx, db, ListCertificatesByCourseParams{
+				CourseID: cert.CourseID,
+				Limit:    2,
+				Offset:   offset,
+			})
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page), 2)
+			for _, c := range page {
+				got = append(got, c.CertificateID)
+			}
+		}
+		assert.Equal(t, ids, got)
+		l, err := q.ListCertificatesByCourseLen(ctx, db, cert.CourseID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), l)
+		l, err = q.ListCertificatesByStudentLen(ctx, db, cert.StudentID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), l)
+		l, err = q.ListCertificatesByTemplateLen(ctx, db, cert.TemplateID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), l)
+	})
+	t.Run("empty page is nil", func(t *testing.T) {
+		cert := newCertificate(t)
+
+		page, err := q.ListCertificatesByStudent(ctx, db, ListCertificatesByStudentParams{
+			StudentID: cert.StudentID,
+			Limit:     10,
+			Offset:    1,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, page)
+		page, err = q.ListCertificatesByTemplate(ctx, db, ListCertificatesByTemplateParams{
+			TemplateID: cert.TemplateID,
+			Limit:      0,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, page)
+	})
+	t.Run("negative limit or offset rejected", func(t *testing.T) {
+		_, err := q.ListCourses(ctx, db, ListCoursesParams{Limit: -1})
+		requirePgError(t, err, "2201W")
+		_, err = q.ListStudents(ctx, db, ListStudentsParams{Limit: 1, Offset: -1})
+		requirePgError(t, err, "2201X")
+	})
+	t.Run("global lists ordered by id and match their length", func(t *testing.T) {
+		newCertificate(t)
+
+		l, err := q.ListTemplatesLen(ctx, db)
+		require.NoError(t, err)
+		tmpls, err := q.ListTemplates(ctx, db, ListTemplatesParams{Limit: l})
+		require.NoError(t, err)
+		assert.Len(t, tmpls, int(l))
+		assert.True(t, sort.SliceIsSorted(tmpls, func(i, j int) bool { return tmpls[i].TemplateID < tmpls[j].TemplateID }))
+
+		l, err = q.ListCoursesLen(ctx, db)
+		require.NoError(t, err)
+		courses, err := q.ListCourses(ctx, db, ListCoursesParams{Limit: l})
+		require.NoError(t, err)
+		assert.Len(t, courses, int(l))
+
+		l, err = q.ListStudentsLen(ctx, db)
+		require.NoError(t, err)
+		students, err := q.ListStudents(ctx, db, ListStudentsParams{Limit: l, Offset: l - 1})
+		require.NoError(t, err)
+		assert.Len(t, students, 1)
+
+		l, err = q.ListCertificatesLen(ctx, db)
+		require.NoError(t, err)
+		certs, err := q.ListCertificates(ctx, db, ListCertificatesParams{Limit: l})
+		require.NoError(t, err)
+		assert.Len(t, certs, int(l))
+		ids := make([]string, 0, len(certs))
+		for _, c := range certs {
+			ids = append(ids, c.CertificateID)
+		}
+		assert.True(t, sort.StringsAreSorted(ids))
+	})
+}
@@ -4,16 +4,22 @@ package db
 
 import (
 	"context"
+	iofs "io/fs"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/eklmv/pdfcertificates/db/migrations"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -152,3 +158,51 @@ func randomData(tb testing.TB) []byte {
 	str = strings.ReplaceAll(str, ",", ", ")
 	return []byte(str)
 }
+
+func TestQueriesConformance(t *testing.T) {
+	t.Parallel()
+	db := migrateUp(t)
+
+	testQuerierConformance(t, New(), db)
+}
+
+// latestMigration return version of the last embedded postgres migration
+func latestMigration(tb testing.TB) uint {
+	tb.Helper()
+	names, err := iofs.Glob(migrations.FS, "*.up.sql")
+	require.NoError(tb, err)
+	var latest uint
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		require.NoError(tb, err)
+		latest = max(latest, uint(v))
+	}
+	require.NotZero(tb, latest)
+	return latest
+}
+
+func TestAutoMigrateConcurrent(t *testing.T) {
+	t.Parallel()
+	prepareTestDB(t)
+	n := 4
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = migrations.AutoMigrate(testDBUrl(t))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	v, dirty, err := getMigrate(t).Version()
+	require.NoError(t, err)
+	assert.False(t, dirty)
+	assert.Equal(t, latestMigration(t), v)
+}
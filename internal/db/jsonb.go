@@ -0,0 +1,214 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonbNormalize parses data and formats it the way postgres outputs jsonb:
+// keys of objects are deduplicated keeping the last value and sorted by length
+// first, separators are followed by a single space, numbers in exponent
+// notation are expanded
+func jsonbNormalize(data []byte) ([]byte, error) {
+	if !json.Valid(data) {
+		return nil, newPgError(codeInvalidTextRepresentation, "invalid input syntax for type json", "", "")
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	v, err := jsonbParse(d)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	jsonbWrite(&buf, v)
+	return buf.Bytes(), nil
+}
+
+type jsonbPair struct {
+	key   string
+	value any
+}
+
+// jsonbParse reads value from decoder, objects are parsed into pairs to keep
+// duplicate keys
+func jsonbParse(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '[' {
+			arr := []any{}
+			for d.More() {
+				v, err := jsonbParse(d)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			_, err := d.Token()
+			return arr, err
+		}
+		pairs := []jsonbPair{}
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			if err := jsonbCheckString(k.(string)); err != nil {
+				return nil, err
+			}
+			v, err := jsonbParse(d)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, jsonbPair{key: k.(string), value: v})
+		}
+		_, err := d.Token()
+		return jsonbObject(pairs), err
+	case string:
+		return t, jsonbCheckString(t)
+	default:
+		return t, nil
+	}
+}
+
+// jsonbCheckString rejects strings postgres can't store in jsonb
+func jsonbCheckString(s string) error {
+	if strings.ContainsRune(s, 0) {
+		return newPgError(codeUntranslatableCharacter, "unsupported Unicode escape sequence",
+			`\u0000 cannot be converted to text.`, "")
+	}
+	return nil
+}
+
+// jsonbObject drops duplicate keys keeping the last value and sorts keys by
+// length, then bytewise
+func jsonbObject(pairs []jsonbPair) []jsonbPair {
+	last := make(map[string]int, len(pairs))
+	for i, p := range pairs {
+		last[p.key] = i
+	}
+	res := make([]jsonbPair, 0, len(last))
+	for i, p := range pairs {
+		if last[p.key] == i {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if len(res[i].key) != len(res[j].key) {
+			return len(res[i].key) < len(res[j].key)
+		}
+		return res[i].key < res[j].key
+	})
+	return res
+}
+
+func jsonbWrite(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case []jsonbPair:
+		buf.WriteByte('{')
+		for i, p := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			jsonbWriteString(buf, p.key)
+			buf.WriteString(": ")
+			jsonbWrite(buf, p.value)
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			jsonbWrite(buf, e)
+		}
+		buf.WriteByte(']')
+	case string:
+		jsonbWriteString(buf, v)
+	case json.Number:
+		buf.WriteString(jsonbNumber(string(v)))
+	case bool:
+		fmt.Fprint(buf, v)
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// jsonbWriteString escapes string as postgres does, only quotes, backslashes
+// and control characters are escaped
+func jsonbWriteString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// jsonbNumber formats number as numeric, exponent is expanded keeping
+// significant fraction digits, negative zero loses its sign
+func jsonbNumber(n string) string {
+	neg := strings.HasPrefix(n, "-")
+	n = strings.TrimPrefix(n, "-")
+	mantissa, exp := n, 0
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		mantissa = n[:i]
+		fmt.Sscan(n[i+1:], &exp)
+	}
+	intPart, frac, _ := strings.Cut(mantissa, ".")
+	digits := intPart + frac
+	point := len(intPart) + exp
+	scale := len(frac) - exp
+	if scale < 0 {
+		scale = 0
+	}
+	for point > len(digits) {
+		digits += "0"
+	}
+	for point < 0 {
+		digits = "0" + digits
+		point++
+	}
+	for len(digits)-point < scale {
+		digits += "0"
+	}
+	intPart = strings.TrimLeft(digits[:point], "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	res := intPart
+	if scale > 0 {
+		res += "." + digits[point:point+scale]
+	}
+	if neg && strings.Trim(res, "0.") != "" {
+		res = "-" + res
+	}
+	return res
+}
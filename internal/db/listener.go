@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// InvalidationChannel is a channel notified by triggers on every change of
+// template, course, student or certificate, payload is "<table>:<id>".
+// Payload of certificate is followed by ":<template>:<course>:<student>" of
+// changed row, certificate moved to other owners is notified for old and new
+// ones.
+const InvalidationChannel = "cache_invalidation"
+
+// Invalidator drops cached data of changed rows, InvalidateAll is called when
+// notifications may have been missed
+type Invalidator interface {
+	Invalidate(table string, id string)
+	InvalidateAll()
+}
+
+// listenConn is a part of pgx.Conn used by Listener
+type listenConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// certificateInvalidator is implemented by invalidators which can narrow
+// invalidation of certificate down to lists of its template, course and
+// student
+type certificateInvalidator interface {
+	invalidateCertificate(id string, owners certOwners)
+}
+
+// Listener consumes invalidation notifications on dedicated connection and
+// passes them to invalidators, so caches of all instances stay consistent
+type Listener struct {
+	connect      func(ctx context.Context) (listenConn, error)
+	invalidators []Invalidator
+	retry        time.Duration
+	connected    bool
+}
+
+func NewListener(connString string, invalidators ...Invalidator) *Listener {
+	return &Listener{
+		connect: func(ctx context.Context) (listenConn, error) {
+			return pgx.Connect(ctx, connString)
+		},
+		invalidators: invalidators,
+		retry:        time.Second,
+	}
+}
+
+// Run listens for notifications until context is done, connection is
+// reestablished on failure and all invalidators are reset, as notifications
+// sent meanwhile are lost
+func (l *Listener) Run(ctx context.Context) error {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Error("invalidation listener failed, reconnecting", slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.retry):
+		}
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+	_, err = conn.Exec(ctx, "LISTEN "+InvalidationChannel)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	if l.connected {
+		for _, inv := range l.invalidators {
+			inv.InvalidateAll()
+		}
+	}
+	l.connected = true
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		nt, err := parseNotification(n.Payload)
+		if err != nil {
+			slog.Error("invalid invalidation notification", slog.String("payload", n.Payload), slog.Any("error", err))
+			continue
+		}
+		slog.Debug("invalidation notification received", slog.String("table", nt.table), slog.String("id", nt.id))
+		for _, inv := range l.invalidators {
+			nt.invalidate(inv)
+		}
+	}
+}
+
+// notification is a parsed payload, owners are known only for certificates
+type notification struct {
+	table  string
+	id     string
+	owners certOwners
+	owned  bool
+}
+
+func parseNotification(payload string) (notification, error) {
+	table, id, ok := strings.Cut(payload, ":")
+	if !ok || table == "" || id == "" {
+		return notification{}, errors.New("expected <table>:<id>")
+	}
+	n := notification{table: table, id: id}
+	if table != "certificate" || !strings.Contains(id, ":") {
+		return n, nil
+	}
+	fields := strings.Split(id, ":")
+	if len(fields) != 4 {
+		return notification{}, errors.New("expected certificate:<id>:<template>:<course>:<student>")
+	}
+	owners := make([]int32, 0, 3)
+	for _, f := range fields[1:] {
+		owner, err := strconv.ParseInt(f, 10, 32)
+		if err != nil {
+			return notification{}, fmt.Errorf("invalid owner of certificate: %w", err)
+		}
+		owners = append(owners, int32(owner))
+	}
+	n.id = fields[0]
+	n.owners = certOwners{template: owners[0], course: owners[1], student: owners[2]}
+	n.owned = true
+	return n, nil
+}
+
+// invalidate passes notification to invalidator, certificate with known
+// owners is invalidated narrowly if invalidator supports it
+func (n notification) invalidate(inv Invalidator) {
+	if ci, ok := inv.(certificateInvalidator); ok && n.owned {
+		ci.invalidateCertificate(n.id, n.owners)
+		return
+	}
+	inv.Invalidate(n.table, n.id)
+}
+
+// Invalidate removes cached response of changed row and lists it may appear
+// in, certificates of changed template, course or student are notified
+// separately, as their timestamps are updated. Owners of certificate are
+// unknown here, so all lists of certificates are removed.
+func (cq *CachedQueries) Invalidate(table string, id string) {
+	switch table {
+	case "certificate":
+		cq.invalidateCache(prefCert, id)
+		cq.invalidateScopePrefix(scopeCerts)
+	case "course":
+		cq.invalidateCache(prefCourse, id)
+		cq.invalidateScopes(scopeCourses)
+	case "student":
+		cq.invalidateCache(prefStudent, id)
+		cq.invalidateScopes(scopeStudents)
+	case "template":
+		cq.invalidateCache(prefTmpl, id)
+		cq.invalidateScopes(scopeTmpls)
+	default:
+		slog.Debug("invalidation of unknown table ignored", slog.String("table", table), slog.String("id", id))
+	}
+}
+
+// invalidateCertificate removes cached certificate and only lists of
+// certificates it appears in
+func (cq *CachedQueries) invalidateCertificate(id string, owners certOwners) {
+	cq.invalidateCache(prefCert, id)
+	cq.invalidateScopes(owners.scopes()...)
+}
+
+func (cq *CachedQueries) InvalidateAll() {
+	cq.purge()
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConn delivers payloads sent to notifications, closed notifications
+// channel fails connection
+type testConn struct {
+	notifications chan string
+	listened      []string
+}
+
+func (c *testConn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	c.listened = append(c.listened, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *testConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case payload, ok := <-c.notifications:
+		if !ok {
+			return nil, errors.New("connection lost")
+		}
+		return &pgconn.Notification{Channel: InvalidationChannel, Payload: payload}, nil
+	}
+}
+
+func (c *testConn) Close(ctx context.Context) error {
+	return nil
+}
+
+type testInvalidator struct {
+	mu          sync.Mutex
+	invalidated []string
+	resets      int
+}
+
+func (i *testInvalidator) Invalidate(table string, id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.invalidated = append(i.invalidated, table+":"+id)
+}
+
+func (i *testInvalidator) InvalidateAll() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.resets++
+}
+
+func (i *testInvalidator) state() ([]string, int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.invalidated...), i.resets
+}
+
+func prepListener(conns ...*testConn) (*Listener, *testInvalidator) {
+	inv := &testInvalidator{}
+	l := NewListener("", inv)
+	l.retry = time.Millisecond
+	var mu sync.Mutex
+	l.connect = func(ctx context.Context) (listenConn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(conns) == 0 {
+			return nil, errors.New("connection refused")
+		}
+		c := conns[0]
+		conns = conns[1:]
+		return c, nil
+	}
+	return l, inv
+}
+
+func TestListenerRun(t *testing.T) {
+	t.Run("notifications passed to invalidators, invalid payloads skipped", func(t *testing.T) {
+		conn := &testConn{notifications: make(chan string)}
+		l, inv := prepListener(conn)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- l.Run(ctx) }()
+
+		conn.notifications <- "course:1"
+		conn.notifications <- "invalid"
+		conn.notifications <- "certificate:0000000f"
+		conn.notifications <- "certificate:0000000e:1:2:3"
+		conn.notifications <- "certificate:0000000d:1:x:3"
+		cancel()
+
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, []string{"LISTEN " + InvalidationChannel}, conn.listened)
+		invalidated, resets := inv.state()
+		assert.Equal(t, []string{"course:1", "certificate:0000000f", "certificate:0000000e"}, invalidated)
+		assert.Equal(t, 0, resets)
+	})
+	t.Run("after reconnect all caches invalidated", func(t *testing.T) {
+		first := &testConn{notifications: make(chan string)}
+		second := &testConn{notifications: make(chan string)}
+		l, inv := prepListener(first, second)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- l.Run(ctx) }()
+
+		first.notifications <- "course:1"
+		close(first.notifications)
+		second.notifications <- "student:2"
+		cancel()
+
+		assert.ErrorIs(t, <-done, context.Canceled)
+		invalidated, resets := inv.state()
+		assert.Equal(t, []string{"course:1", "student:2"}, invalidated)
+		assert.Equal(t, 1, resets)
+	})
+	t.Run("failed connection retried until context done", func(t *testing.T) {
+		l, _ := prepListener()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := l.Run(ctx)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestCachedQueriesInvalidate(t *testing.T) {
+	t.Run("cached response of notified row removed", func(t *testing.T) {
+		cq, c, _ := prepCachedQueries(t)
+		for _, key := range []string{prefCert.key("00000001"), prefCourse.key("1"), prefStudent.key("1"), prefTmpl.key("1")} {
+			c.Add(key, newCachedResponse(nil))
+		}
+
+		cq.Invalidate("certificate", "00000001")
+		cq.Invalidate("course", "1")
+		cq.Invalidate("unknown", "1")
+
+		assert.ElementsMatch(t, []string{prefStudent.key("1"), prefTmpl.key("1")}, c.Keys())
+		cq.Invalidate("student", "1")
+		cq.Invalidate("template", "1")
+		assert.Empty(t, c.Keys())
+	})
+	t.Run("InvalidateAll purges cache", func(t *testing.T) {
+		cq, c, _ := prepCachedQueries(t)
+		c.Add(prefCourse.key("1"), newCachedResponse(nil))
+
+		cq.InvalidateAll()
+
+		require.Equal(t, uint64(0), c.Len())
+	})
+}
@@ -0,0 +1,537 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// codes of postgres errors returned by MemoryQueries and SQLiteQueries
+const (
+	codeForeignKeyViolation       = "23503"
+	codeCheckViolation            = "23514"
+	codeInvalidTextRepresentation = "22P02"
+	codeUntranslatableCharacter   = "22P05"
+	codeInvalidRowCountInLimit    = "2201W"
+	codeInvalidRowCountInOffset   = "2201X"
+	codeRaiseException            = "P0001"
+)
+
+func newPgError(code string, message string, detail string, constraint string) *pgconn.PgError {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        message,
+		Detail:         detail,
+		ConstraintName: constraint,
+	}
+}
+
+// genIDAttempts is a number of attempts of certificate id generation, same as
+// in gen_id trigger
+const genIDAttempts = 11
+
+// MemoryQueries is an in-memory Querier for tests and local development, it
+// follows behaviour of database schema: certificate ids generated as by
+// gen_id, certificate timestamps bumped as by update_timestamp, deletes of
+// referenced rows restricted, errors returned as *pgconn.PgError with codes
+// of postgres. db argument of queries is ignored, changes are visible
+// immediately and can't be rolled back.
+type MemoryQueries struct {
+	mu           sync.Mutex
+	templates    map[int32]Template
+	courses      map[int32]Course
+	students     map[int32]Student
+	certificates map[string]Certificate
+	// last values of serial sequences
+	templateSeq int32
+	courseSeq   int32
+	studentSeq  int32
+	clock       statementClock
+	genID       func() (string, error)
+}
+
+func NewMemoryQueries() *MemoryQueries {
+	return &MemoryQueries{
+		templates:    make(map[int32]Template),
+		courses:      make(map[int32]Course),
+		students:     make(map[int32]Student),
+		certificates: make(map[string]Certificate),
+		genID:        randomCertificateID,
+	}
+}
+
+func randomCertificateID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// statementClock return time of statements with precision of timestamptz,
+// time of statements is strictly increasing, so every update bumps timestamps
+type statementClock struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (c *statementClock) now() pgtype.Timestamptz {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := time.Now().Truncate(time.Microsecond)
+	if !t.After(c.last) {
+		t = c.last.Add(time.Microsecond)
+	}
+	c.last = t
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
+
+// jsonbOrEmpty return normalized data, nil data is stored as empty object
+func jsonbOrEmpty(data []byte) ([]byte, error) {
+	if data == nil {
+		return []byte("{}"), nil
+	}
+	return jsonbNormalize(data)
+}
+
+// checkPage rejects negative limit and offset as postgres does
+func checkPage(limit int64, offset int64) error {
+	if limit < 0 {
+		return newPgError(codeInvalidRowCountInLimit, "LIMIT must not be negative", "", "")
+	}
+	if offset < 0 {
+		return newPgError(codeInvalidRowCountInOffset, "OFFSET must not be negative", "", "")
+	}
+	return nil
+}
+
+// page return rows in range of limit and offset, nil if range is empty
+func page[T any](rows []T, limit int64, offset int64) ([]T, error) {
+	if err := checkPage(limit, offset); err != nil {
+		return nil, err
+	}
+	if offset >= int64(len(rows)) || limit == 0 {
+		return nil, nil
+	}
+	end := int64(len(rows))
+	if limit < end-offset {
+		end = offset + limit
+	}
+	return rows[offset:end], nil
+}
+
+// sortedRows return rows of table ordered by primary key
+func sortedRows[K int32 | string, V any](table map[K]V) []V {
+	keys := make([]K, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	rows := make([]V, 0, len(keys))
+	for _, k := range keys {
+		rows = append(rows, table[k])
+	}
+	return rows
+}
+
+func foreignKeyViolation(table string, column string, id int32) error {
+	return newPgError(codeForeignKeyViolation,
+		fmt.Sprintf(`insert or update on table "certificate" violates foreign key constraint "certificate_%s_fkey"`, column),
+		fmt.Sprintf(`Key (%s)=(%d) is not present in table "%s".`, column, id, table),
+		"certificate_"+column+"_fkey")
+}
+
+func restrictViolation(table string, column string, id int32) error {
+	return newPgError(codeForeignKeyViolation,
+		fmt.Sprintf(`update or delete on table "%s" violates foreign key constraint "certificate_%s_fkey" on table "certificate"`, table, column),
+		fmt.Sprintf(`Key (%s)=(%d) is still referenced from table "certificate".`, column, id),
+		"certificate_"+column+"_fkey")
+}
+
+// referenced reports whether any certificate is linked to row with id
+func (q *MemoryQueries) referenced(linked func(c Certificate) int32, id int32) bool {
+	for _, c := range q.certificates {
+		if linked(c) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// bumpTimestamps updates timestamps of certificates linked to row with id
+func (q *MemoryQueries) bumpTimestamps(linked func(c Certificate) int32, id int32) {
+	now := q.clock.now()
+	for k, c := range q.certificates {
+		if linked(c) == id {
+			c.Timestamp = now
+			q.certificates[k] = c
+		}
+	}
+}
+
+// filterCertificates return certificates linked to row with id ordered by
+// certificate id
+func (q *MemoryQueries) filterCertificates(linked func(c Certificate) int32, id int32) []Certificate {
+	var certs []Certificate
+	for _, c := range sortedRows(q.certificates) {
+		if linked(c) == id {
+			certs = append(certs, c)
+		}
+	}
+	return certs
+}
+
+func certTemplate(c Certificate) int32 { return c.TemplateID }
+func certCourse(c Certificate) int32   { return c.CourseID }
+func certStudent(c Certificate) int32  { return c.StudentID }
+
+func cloneCertificates(certs []Certificate) []Certificate {
+	for i := range certs {
+		certs[i].Data = bytes.Clone(certs[i].Data)
+	}
+	return certs
+}
+
+func (q *MemoryQueries) CreateCertificate(ctx context.Context, db DBTX, arg CreateCertificateParams) (Certificate, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Certificate{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := ""
+	for i := 0; i < genIDAttempts && id == ""; i++ {
+		newID, err := q.genID()
+		if err != nil {
+			return Certificate{}, err
+		}
+		if _, ok := q.certificates[newID]; !ok {
+			id = newID
+		}
+	}
+	if id == "" {
+		return Certificate{}, newPgError(codeRaiseException, "certificate_id generation failed, retry limit exceeded", "", "")
+	}
+	// foreign keys are checked in order of constraint names
+	if _, ok := q.courses[arg.CourseID]; !ok {
+		return Certificate{}, foreignKeyViolation("course", "course_id", arg.CourseID)
+	}
+	if _, ok := q.students[arg.StudentID]; !ok {
+		return Certificate{}, foreignKeyViolation("student", "student_id", arg.StudentID)
+	}
+	if _, ok := q.templates[arg.TemplateID]; !ok {
+		return Certificate{}, foreignKeyViolation("template", "template_id", arg.TemplateID)
+	}
+	cert := Certificate{
+		CertificateID: id,
+		TemplateID:    arg.TemplateID,
+		CourseID:      arg.CourseID,
+		StudentID:     arg.StudentID,
+		Timestamp:     q.clock.now(),
+		Data:          data,
+	}
+	q.certificates[id] = cert
+	return cloneCertificates([]Certificate{cert})[0], nil
+}
+
+func (q *MemoryQueries) CreateCourse(ctx context.Context, db DBTX, data []byte) (Course, error) {
+	data, err := jsonbOrEmpty(data)
+	if err != nil {
+		return Course{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.courseSeq++
+	course := Course{CourseID: q.courseSeq, Data: data}
+	q.courses[course.CourseID] = course
+	return Course{CourseID: course.CourseID, Data: bytes.Clone(data)}, nil
+}
+
+func (q *MemoryQueries) CreateStudent(ctx context.Context, db DBTX, data []byte) (Student, error) {
+	data, err := jsonbOrEmpty(data)
+	if err != nil {
+		return Student{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.studentSeq++
+	student := Student{StudentID: q.studentSeq, Data: data}
+	q.students[student.StudentID] = student
+	return Student{StudentID: student.StudentID, Data: bytes.Clone(data)}, nil
+}
+
+func (q *MemoryQueries) CreateTemplate(ctx context.Context, db DBTX, content string) (Template, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// sequence is advanced before check constraint is validated
+	q.templateSeq++
+	if content == "" {
+		return Template{}, newPgError(codeCheckViolation,
+			`new row for relation "template" violates check constraint "template_content_check"`, "", "template_content_check")
+	}
+	tmpl := Template{TemplateID: q.templateSeq, Content: content}
+	q.templates[tmpl.TemplateID] = tmpl
+	return tmpl, nil
+}
+
+func (q *MemoryQueries) DeleteCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cert, ok := q.certificates[certificateID]
+	if !ok {
+		return Certificate{}, pgx.ErrNoRows
+	}
+	delete(q.certificates, certificateID)
+	return cert, nil
+}
+
+func (q *MemoryQueries) DeleteCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	course, ok := q.courses[courseID]
+	if !ok {
+		return Course{}, pgx.ErrNoRows
+	}
+	if q.referenced(certCourse, courseID) {
+		return Course{}, restrictViolation("course", "course_id", courseID)
+	}
+	delete(q.courses, courseID)
+	return course, nil
+}
+
+func (q *MemoryQueries) DeleteStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	student, ok := q.students[studentID]
+	if !ok {
+		return Student{}, pgx.ErrNoRows
+	}
+	if q.referenced(certStudent, studentID) {
+		return Student{}, restrictViolation("student", "student_id", studentID)
+	}
+	delete(q.students, studentID)
+	return student, nil
+}
+
+func (q *MemoryQueries) DeleteTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tmpl, ok := q.templates[templateID]
+	if !ok {
+		return Template{}, pgx.ErrNoRows
+	}
+	if q.referenced(certTemplate, templateID) {
+		return Template{}, restrictViolation("template", "template_id", templateID)
+	}
+	delete(q.templates, templateID)
+	return tmpl, nil
+}
+
+func (q *MemoryQueries) GetCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cert, ok := q.certificates[certificateID]
+	if !ok {
+		return Certificate{}, pgx.ErrNoRows
+	}
+	return cloneCertificates([]Certificate{cert})[0], nil
+}
+
+func (q *MemoryQueries) GetCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	course, ok := q.courses[courseID]
+	if !ok {
+		return Course{}, pgx.ErrNoRows
+	}
+	return Course{CourseID: course.CourseID, Data: bytes.Clone(course.Data)}, nil
+}
+
+func (q *MemoryQueries) GetStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	student, ok := q.students[studentID]
+	if !ok {
+		return Student{}, pgx.ErrNoRows
+	}
+	return Student{StudentID: student.StudentID, Data: bytes.Clone(student.Data)}, nil
+}
+
+func (q *MemoryQueries) GetTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tmpl, ok := q.templates[templateID]
+	if !ok {
+		return Template{}, pgx.ErrNoRows
+	}
+	return tmpl, nil
+}
+
+func (q *MemoryQueries) ListCertificates(ctx context.Context, db DBTX, arg ListCertificatesParams) ([]Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	certs, err := page(sortedRows(q.certificates), arg.Limit, arg.Offset)
+	return cloneCertificates(certs), err
+}
+
+func (q *MemoryQueries) ListCertificatesByCourse(ctx context.Context, db DBTX, arg ListCertificatesByCourseParams) ([]Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	certs, err := page(q.filterCertificates(certCourse, arg.CourseID), arg.Limit, arg.Offset)
+	return cloneCertificates(certs), err
+}
+
+func (q *MemoryQueries) ListCertificatesByCourseLen(ctx context.Context, db DBTX, courseID int32) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.filterCertificates(certCourse, courseID))), nil
+}
+
+func (q *MemoryQueries) ListCertificatesByStudent(ctx context.Context, db DBTX, arg ListCertificatesByStudentParams) ([]Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	certs, err := page(q.filterCertificates(certStudent, arg.StudentID), arg.Limit, arg.Offset)
+	return cloneCertificates(certs), err
+}
+
+func (q *MemoryQueries) ListCertificatesByStudentLen(ctx context.Context, db DBTX, studentID int32) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.filterCertificates(certStudent, studentID))), nil
+}
+
+func (q *MemoryQueries) ListCertificatesByTemplate(ctx context.Context, db DBTX, arg ListCertificatesByTemplateParams) ([]Certificate, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	certs, err := page(q.filterCertificates(certTemplate, arg.TemplateID), arg.Limit, arg.Offset)
+	return cloneCertificates(certs), err
+}
+
+func (q *MemoryQueries) ListCertificatesByTemplateLen(ctx context.Context, db DBTX, templateID int32) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.filterCertificates(certTemplate, templateID))), nil
+}
+
+func (q *MemoryQueries) ListCertificatesLen(ctx context.Context, db DBTX) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.certificates)), nil
+}
+
+func (q *MemoryQueries) ListCourses(ctx context.Context, db DBTX, arg ListCoursesParams) ([]Course, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	courses, err := page(sortedRows(q.courses), arg.Limit, arg.Offset)
+	for i := range courses {
+		courses[i].Data = bytes.Clone(courses[i].Data)
+	}
+	return courses, err
+}
+
+func (q *MemoryQueries) ListCoursesLen(ctx context.Context, db DBTX) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.courses)), nil
+}
+
+func (q *MemoryQueries) ListStudents(ctx context.Context, db DBTX, arg ListStudentsParams) ([]Student, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	students, err := page(sortedRows(q.students), arg.Limit, arg.Offset)
+	for i := range students {
+		students[i].Data = bytes.Clone(students[i].Data)
+	}
+	return students, err
+}
+
+func (q *MemoryQueries) ListStudentsLen(ctx context.Context, db DBTX) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.students)), nil
+}
+
+func (q *MemoryQueries) ListTemplates(ctx context.Context, db DBTX, arg ListTemplatesParams) ([]Template, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return page(sortedRows(q.templates), arg.Limit, arg.Offset)
+}
+
+func (q *MemoryQueries) ListTemplatesLen(ctx context.Context, db DBTX) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.templates)), nil
+}
+
+func (q *MemoryQueries) UpdateCertificate(ctx context.Context, db DBTX, arg UpdateCertificateParams) (Certificate, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Certificate{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cert, ok := q.certificates[arg.CertificateID]
+	if !ok {
+		return Certificate{}, pgx.ErrNoRows
+	}
+	cert.Data = data
+	cert.Timestamp = q.clock.now()
+	q.certificates[cert.CertificateID] = cert
+	return cloneCertificates([]Certificate{cert})[0], nil
+}
+
+func (q *MemoryQueries) UpdateCourse(ctx context.Context, db DBTX, arg UpdateCourseParams) (Course, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Course{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.courses[arg.CourseID]; !ok {
+		return Course{}, pgx.ErrNoRows
+	}
+	q.courses[arg.CourseID] = Course{CourseID: arg.CourseID, Data: data}
+	q.bumpTimestamps(certCourse, arg.CourseID)
+	return Course{CourseID: arg.CourseID, Data: bytes.Clone(data)}, nil
+}
+
+func (q *MemoryQueries) UpdateStudent(ctx context.Context, db DBTX, arg UpdateStudentParams) (Student, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Student{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.students[arg.StudentID]; !ok {
+		return Student{}, pgx.ErrNoRows
+	}
+	q.students[arg.StudentID] = Student{StudentID: arg.StudentID, Data: data}
+	q.bumpTimestamps(certStudent, arg.StudentID)
+	return Student{StudentID: arg.StudentID, Data: bytes.Clone(data)}, nil
+}
+
+func (q *MemoryQueries) UpdateTemplate(ctx context.Context, db DBTX, arg UpdateTemplateParams) (Template, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.templates[arg.TemplateID]; !ok {
+		return Template{}, pgx.ErrNoRows
+	}
+	if arg.Content == "" {
+		return Template{}, newPgError(codeCheckViolation,
+			`new row for relation "template" violates check constraint "template_content_check"`, "", "template_content_check")
+	}
+	tmpl := Template{TemplateID: arg.TemplateID, Content: arg.Content}
+	q.templates[arg.TemplateID] = tmpl
+	q.bumpTimestamps(certTemplate, arg.TemplateID)
+	return tmpl, nil
+}
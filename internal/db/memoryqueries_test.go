@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryQueriesImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Querier)(nil), &MemoryQueries{})
+}
+
+func TestMemoryQueriesConformance(t *testing.T) {
+	testQuerierConformance(t, NewMemoryQueries(), nil)
+}
+
+func TestMemoryQueriesCertificateID(t *testing.T) {
+	t.Run("colliding id regenerated", func(t *testing.T) {
+		q := NewMemoryQueries()
+		ctx := context.Background()
+		ids := []string{"00000000", "00000000", "00000001"}
+		q.genID = func() (string, error) {
+			id := ids[0]
+			ids = ids[1:]
+			return id, nil
+		}
+		p := prepareQuerierCertificateParams(t, q)
+
+		first, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+		second, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+
+		assert.Equal(t, "00000000", first.CertificateID)
+		assert.Equal(t, "00000001", second.CertificateID)
+	})
+	t.Run("generation failed once attempts exceeded", func(t *testing.T) {
+		q := NewMemoryQueries()
+		ctx := context.Background()
+		var attempts int
+		q.genID = func() (string, error) {
+			attempts++
+			return "00000000", nil
+		}
+		p := prepareQuerierCertificateParams(t, q)
+		_, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+		attempts = 0
+
+		_, err = q.CreateCertificate(ctx, nil, p)
+
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr))
+		assert.Equal(t, codeRaiseException, pgErr.Code)
+		assert.Equal(t, genIDAttempts, attempts)
+	})
+}
+
+func TestMemoryQueriesDataIsolated(t *testing.T) {
+	t.Run("returned data can be modified without affecting stored rows", func(t *testing.T) {
+		q := NewMemoryQueries()
+		ctx := context.Background()
+		course, err := q.CreateCourse(ctx, nil, []byte(`{"a": 1}`))
+		require.NoError(t, err)
+
+		course.Data[1] = 'x'
+		got, err := q.GetCourse(ctx, nil, course.CourseID)
+		require.NoError(t, err)
+		got.Data[1] = 'x'
+		list, err := q.ListCourses(ctx, nil, ListCoursesParams{Limit: 1})
+		require.NoError(t, err)
+
+		assert.Equal(t, `{"a": 1}`, string(list[0].Data))
+	})
+}
+
+func prepareQuerierCertificateParams(tb testing.TB, q Querier) CreateCertificateParams {
+	tb.Helper()
+	ctx := context.Background()
+	tmpl, err := q.CreateTemplate(ctx, nil, "content")
+	require.NoError(tb, err)
+	course, err := q.CreateCourse(ctx, nil, nil)
+	require.NoError(tb, err)
+	student, err := q.CreateStudent(ctx, nil, nil)
+	require.NoError(tb, err)
+	return CreateCertificateParams{
+		TemplateID: tmpl.TemplateID,
+		CourseID:   course.CourseID,
+		StudentID:  student.StudentID,
+	}
+}
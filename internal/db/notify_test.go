@@ -0,0 +1,62 @@
+//go:build integration
+
+package db
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyTriggers(t *testing.T) {
+	t.Run("changes of all tables notified, certificates of updated course included", func(t *testing.T) {
+		db := migrateUp(t)
+		ctx := context.Background()
+		conn, err := pgx.Connect(ctx, testDBUrl(t))
+		require.NoError(t, err)
+		defer conn.Close(ctx)
+		_, err = conn.Exec(ctx, "LISTEN "+InvalidationChannel)
+		require.NoError(t, err)
+		q := New()
+
+		tmpl, err := q.CreateTemplate(ctx, db, "content")
+		require.NoError(t, err)
+		course, err := q.CreateCourse(ctx, db, []byte(`{}`))
+		require.NoError(t, err)
+		student, err := q.CreateStudent(ctx, db, []byte(`{}`))
+		require.NoError(t, err)
+		cert, err := q.CreateCertificate(ctx, db, CreateCertificateParams{
+			TemplateID: tmpl.TemplateID,
+			CourseID:   course.CourseID,
+			StudentID:  student.StudentID,
+			Data:       []byte(`{}`),
+		})
+		require.NoError(t, err)
+		_, err = q.UpdateCourse(ctx, db, UpdateCourseParams{CourseID: course.CourseID, Data: []byte(`{"a": 1}`)})
+		require.NoError(t, err)
+
+		owners := ":" + strconv.Itoa(int(tmpl.TemplateID)) + ":" + strconv.Itoa(int(course.CourseID)) + ":" + strconv.Itoa(int(student.StudentID))
+		exp := []string{
+			"template:" + strconv.Itoa(int(tmpl.TemplateID)),
+			"course:" + strconv.Itoa(int(course.CourseID)),
+			"student:" + strconv.Itoa(int(student.StudentID)),
+			"certificate:" + cert.CertificateID + owners,
+			"certificate:" + cert.CertificateID + owners,
+			"course:" + strconv.Itoa(int(course.CourseID)),
+		}
+		var got []string
+		for range exp {
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			n, err := conn.WaitForNotification(waitCtx)
+			cancel()
+			require.NoError(t, err)
+			got = append(got, n.Payload)
+		}
+		assert.Equal(t, exp, got)
+	})
+}
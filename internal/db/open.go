@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrTxNotSupported is returned by Begin of backends which can't run queries
+// in transaction
+var ErrTxNotSupported = errors.New("transactions are not supported by backend")
+
+// Backend is a Querier with connection passed to its queries, DB is nil for
+// backends which don't use it
+type Backend struct {
+	Querier
+	DB    DBTX
+	close func() error
+}
+
+// Begin starts transaction on DB of backend, only postgres backend supports
+// transactions, others return ErrTxNotSupported. Backend can be passed to
+// RunInTx.
+func (b *Backend) Begin(ctx context.Context) (pgx.Tx, error) {
+	db, ok := b.DB.(TxBeginner)
+	if !ok {
+		return nil, ErrTxNotSupported
+	}
+	return db.Begin(ctx)
+}
+
+func (b *Backend) Close() error {
+	if b.close == nil {
+		return nil
+	}
+	return b.close()
+}
+
+// sqlitePragmas are set on every sqlite connection, foreign keys are required
+// for restricted deletes
+var sqlitePragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(wal)"}
+
+// Open opens backend selected by scheme of dsn:
+//   - postgres:// or postgresql:// opens pool of postgres connections
+//   - sqlite://<path> opens sqlite database file
+//   - memory:// creates empty in-memory backend
+//
+// Schema of database should be migrated beforehand. Only postgres backend
+// supports transactions, queries of sqlite and memory backends ignore passed
+// DBTX and Begin of their backends return ErrTxNotSupported.
+func Open(ctx context.Context, dsn string) (*Backend, error) {
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid dsn, expected <scheme>://...")
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		pool, err := pgxpool.New(ctx, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open postgres: %w", err)
+		}
+		return &Backend{Querier: New(), DB: pool, close: func() error {
+			pool.Close()
+			return nil
+		}}, nil
+	case "sqlite":
+		db, err := sql.Open("sqlite", sqliteDSN(rest))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite: %w", err)
+		}
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open sqlite: %w", err)
+		}
+		return &Backend{Querier: NewSQLiteQueries(db), close: db.Close}, nil
+	case "memory":
+		return &Backend{Querier: NewMemoryQueries()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dsn scheme %q", scheme)
+	}
+}
+
+// sqliteDSN return dsn of sqlite driver for path with query, required pragmas
+// and immediate transactions are added to query
+func sqliteDSN(path string) string {
+	path, query, _ := strings.Cut(path, "?")
+	var params []string
+	if query != "" {
+		params = append(params, query)
+	}
+	for _, p := range sqlitePragmas {
+		params = append(params, "_pragma="+p)
+	}
+	if !strings.Contains(query, "_txlock=") {
+		params = append(params, "_txlock=immediate")
+	}
+	return "file:" + path + "?" + strings.Join(params, "&")
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eklmv/pdfcertificates/internal/cache"
+)
+
+// RenderFunc renders certificate and stores result, it is expected to fetch
+// actual certificate data by itself
+type RenderFunc func(ctx context.Context, certificateID string) error
+
+// Prerenderer re-renders queued certificates in background, one at a time
+// with configured interval between renders. Certificates accessed more
+// recently are rendered first, never accessed ones are rendered in order of
+// enqueue.
+type Prerenderer struct {
+	mu       sync.Mutex
+	queue    prerenderQueue
+	queued   map[string]*prerenderItem
+	accessed *cache.LRUCache[string, accessTime]
+	seq      uint64
+	wake     chan struct{}
+	render   RenderFunc
+	interval time.Duration
+	now      func() time.Time
+}
+
+type accessTime time.Time
+
+func (accessTime) Size() uint64 {
+	return 1
+}
+
+type prerenderItem struct {
+	id       string
+	accessed time.Time
+	seq      uint64
+	index    int
+}
+
+// NewPrerenderer creates prerenderer with minimal interval between renders,
+// access time is tracked for up to trackAccess most recently accessed
+// certificates, zero means unbounded
+func NewPrerenderer(render RenderFunc, interval time.Duration, trackAccess uint64) *Prerenderer {
+	return &Prerenderer{
+		queued:   make(map[string]*prerenderItem),
+		accessed: cache.NewLRUCache[string, accessTime](trackAccess),
+		wake:     make(chan struct{}, 1),
+		render:   render,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Touch records access to certificate, raising its priority if it is queued
+func (p *Prerenderer) Touch(certificateID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.accessed.Add(certificateID, accessTime(now))
+	if item, ok := p.queued[certificateID]; ok {
+		item.accessed = now
+		heap.Fix(&p.queue, item.index)
+	}
+}
+
+// Enqueue adds certificates to render queue, already queued are skipped
+func (p *Prerenderer) Enqueue(certificateIDs ...string) {
+	p.mu.Lock()
+	for _, id := range certificateIDs {
+		if _, ok := p.queued[id]; ok {
+			continue
+		}
+		item := &prerenderItem{id: id, seq: p.seq}
+		p.seq++
+		if accessed, ok := p.accessed.Peek(id); ok {
+			item.accessed = time.Time(accessed)
+		}
+		p.queued[id] = item
+		heap.Push(&p.queue, item)
+	}
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len return amount of queued certificates
+func (p *Prerenderer) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.Len()
+}
+
+func (p *Prerenderer) pop() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queue.Len() == 0 {
+		return "", false
+	}
+	item := heap.Pop(&p.queue).(*prerenderItem)
+	delete(p.queued, item.id)
+	return item.id, true
+}
+
+// Run renders queued certificates until context is done
+func (p *Prerenderer) Run(ctx context.Context) {
+	for {
+		id, ok := p.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+				continue
+			}
+		}
+		if err := p.render(ctx, id); err != nil {
+			slog.Error("failed to prerender certificate", slog.String("id", id), slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// prerenderQueue is a heap of queued certificates, the most recently
+// accessed on top
+type prerenderQueue []*prerenderItem
+
+func (q prerenderQueue) Len() int {
+	return len(q)
+}
+
+func (q prerenderQueue) Less(i, j int) bool {
+	if !q[i].accessed.Equal(q[j].accessed) {
+		return q[i].accessed.After(q[j].accessed)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q prerenderQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *prerenderQueue) Push(x any) {
+	item := x.(*prerenderItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *prerenderQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// PrerenderQueries enqueues certificates affected by updates of templates,
+// courses and students for background re-render, certificate requests are
+// recorded as accesses to prioritize queue
+type PrerenderQueries struct {
+	Querier
+	p *Prerenderer
+}
+
+func NewPrerenderQueries(querier Querier, p *Prerenderer) *PrerenderQueries {
+	return &PrerenderQueries{Querier: querier, p: p}
+}
+
+func (pq *PrerenderQueries) enqueue(ctx context.Context, db DBTX, p prefix, id int32) {
+	certs, err := listCertificatesOf(ctx, pq.Querier, db, p, id)
+	if err != nil {
+		slog.Error("failed to enqueue certificates for prerender", slog.String("prefix", p.String()),
+			slog.String("id", strconv.Itoa(int(id))), slog.Any("error", err))
+		return
+	}
+	ids := make([]string, 0, len(certs))
+	for _, c := range certs {
+		ids = append(ids, c.CertificateID)
+	}
+	afterCommit(db, func() { pq.p.Enqueue(ids...) })
+}
+
+func (pq *PrerenderQueries) GetCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
+	cert, err := pq.Querier.GetCertificate(ctx, db, certificateID)
+	if err == nil {
+		pq.p.Touch(certificateID)
+	}
+	return cert, err
+}
+
+func (pq *PrerenderQueries) UpdateCourse(ctx context.Context, db DBTX, arg UpdateCourseParams) (Course, error) {
+	course, err := pq.Querier.UpdateCourse(ctx, db, arg)
+	if err == nil {
+		pq.enqueue(ctx, db, prefCourse, arg.CourseID)
+	}
+	return course, err
+}
+
+func (pq *PrerenderQueries) UpdateStudent(ctx context.Context, db DBTX, arg UpdateStudentParams) (Student, error) {
+	student, err := pq.Querier.UpdateStudent(ctx, db, arg)
+	if err == nil {
+		pq.enqueue(ctx, db, prefStudent, arg.StudentID)
+	}
+	return student, err
+}
+
+func (pq *PrerenderQueries) UpdateTemplate(ctx context.Context, db DBTX, arg UpdateTemplateParams) (Template, error) {
+	tmpl, err := pq.Querier.UpdateTemplate(ctx, db, arg)
+	if err == nil {
+		pq.enqueue(ctx, db, prefTmpl, arg.TemplateID)
+	}
+	return tmpl, err
+}
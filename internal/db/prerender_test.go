@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRenders struct {
+	mu  sync.Mutex
+	ids []string
+	at  []time.Time
+	err error
+}
+
+func (r *testRenders) render(_ context.Context, certificateID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, certificateID)
+	r.at = append(r.at, time.Now())
+	return r.err
+}
+
+func (r *testRenders) rendered() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+func TestPrerenderQueriesImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Querier)(nil), &PrerenderQueries{})
+}
+
+func TestPrerendererQueue(t *testing.T) {
+	t.Run("recently accessed certificates rendered first, others in order of enqueue", func(t *testing.T) {
+		var r testRenders
+		p := NewPrerenderer(r.render, 0, 0)
+		now := time.Now()
+		p.now = func() time.Time { return now }
+		p.Touch("00000002")
+		now = now.Add(time.Second)
+		p.Touch("00000003")
+
+		p.Enqueue("00000000", "00000001", "00000002", "00000003", "00000001")
+
+		assert.Equal(t, 4, p.Len())
+		var got []string
+		for id, ok := p.pop(); ok; id, ok = p.pop() {
+			got = append(got, id)
+		}
+		assert.Equal(t, []string{"00000003", "00000002", "00000000", "00000001"}, got)
+	})
+	t.Run("access to queued certificate raises its priority", func(t *testing.T) {
+		var r testRenders
+		p := NewPrerenderer(r.render, 0, 0)
+		p.Enqueue("00000000", "00000001", "00000002")
+
+		p.Touch("00000002")
+
+		id, ok := p.pop()
+		require.True(t, ok)
+		assert.Equal(t, "00000002", id)
+	})
+	t.Run("only limited amount of accesses tracked", func(t *testing.T) {
+		var r testRenders
+		p := NewPrerenderer(r.render, 0, 1)
+		p.Touch("00000001")
+		p.Touch("00000002")
+
+		p.Enqueue("00000000", "00000001", "00000002")
+
+		assert.Equal(t, uint64(1), p.accessed.Len())
+		id, ok := p.pop()
+		require.True(t, ok)
+		assert.Equal(t, "00000002", id)
+		id, ok = p.pop()
+		require.True(t, ok)
+		assert.Equal(t, "00000000", id)
+	})
+}
+
+func TestPrerendererRun(t *testing.T) {
+	t.Run("render queued certificates with interval between renders", func(t *testing.T) {
+		var r testRenders
+		interval := 20 * time.Millisecond
+		p := NewPrerenderer(r.render, interval, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			p.Run(ctx)
+			close(done)
+		}()
+
+		p.Enqueue("00000000", "00000001", "00000002")
+
+		require.Eventually(t, func() bool { return len(r.rendered()) == 3 }, time.Second, time.Millisecond)
+		cancel()
+		<-done
+		assert.Equal(t, []string{"00000000", "00000001", "00000002"}, r.rendered())
+		for i := 1; i < len(r.at); i++ {
+			assert.GreaterOrEqual(t, r.at[i].Sub(r.at[i-1]), interval)
+		}
+		assert.Zero(t, p.Len())
+	})
+	t.Run("render failure doesn't stop worker", func(t *testing.T) {
+		r := testRenders{err: fmt.Errorf("failed")}
+		p := NewPrerenderer(r.render, 0, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		p.Enqueue("00000000", "00000001")
+
+		require.Eventually(t, func() bool { return len(r.rendered()) == 2 }, time.Second, time.Millisecond)
+	})
+}
+
+func TestPrerenderQueriesUpdate(t *testing.T) {
+	t.Run("certificates of updated course enqueued", func(t *testing.T) {
+		var r testRenders
+		ctx := context.Background()
+		m := NewMockQuerier(t)
+		p := NewPrerenderer(r.render, 0, 0)
+		pq := NewPrerenderQueries(m, p)
+		exp := Course{CourseID: 1, Data: []byte("{}")}
+		certs := []Certificate{{CertificateID: "00000000", CourseID: 1}, {CertificateID: "00000001", CourseID: 1}}
+		m.EXPECT().UpdateCourse(ctx, nil, UpdateCourseParams{CourseID: 1}).Return(exp, nil).Once()
+		m.EXPECT().ListCertificatesByCourseLen(ctx, nil, exp.CourseID).Return(2, nil).Once()
+		m.EXPECT().ListCertificatesByCourse(ctx, nil, ListCertificatesByCourseParams{
+			CourseID: exp.CourseID,
+			Limit:    2,
+			Offset:   0,
+		}).Return(certs, nil).Once()
+
+		got, err := pq.UpdateCourse(ctx, nil, UpdateCourseParams{CourseID: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+		assert.Equal(t, 2, p.Len())
+	})
+	t.Run("certificates of updated student enqueued", func(t *testing.T) {
+		var r testRenders
+		ctx := context.Background()
+		m := NewMockQuerier(t)
+		p := NewPrerenderer(r.render, 0, 0)
+		pq := NewPrerenderQueries(m, p)
+		exp := Student{StudentID: 1, Data: []byte("{}")}
+		m.EXPECT().UpdateStudent(ctx, nil, UpdateStudentParams{StudentID: 1}).Return(exp, nil).Once()
+		m.EXPECT().ListCertificatesByStudentLen(ctx, nil, exp.StudentID).Return(1, nil).Once()
+		m.EXPECT().ListCertificatesByStudent(ctx, nil, ListCertificatesByStudentParams{
+			StudentID: exp.StudentID,
+			Limit:     1,
+			Offset:    0,
+		}).Return([]Certificate{{CertificateID: "00000000", StudentID: 1}}, nil).Once()
+
+		_, err := pq.UpdateStudent(ctx, nil, UpdateStudentParams{StudentID: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, p.Len())
+	})
+	t.Run("certificates of updated template enqueued", func(t *testing.T) {
+		var r testRenders
+		ctx := context.Background()
+		m := NewMockQuerier(t)
+		p := NewPrerenderer(r.render, 0, 0)
+		pq := NewPrerenderQueries(m, p)
+		exp := Template{TemplateID: 1, Content: "<html></html>"}
+		m.EXPECT().UpdateTemplate(ctx, nil, UpdateTemplateParams{TemplateID: 1}).Return(exp, nil).Once()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, exp.TemplateID).Return(1, nil).Once()
+		m.EXPECT().ListCertificatesByTemplate(ctx, nil, ListCertificatesByTemplateParams{
+			TemplateID: exp.TemplateID,
+			Limit:      1,
+			Offset:     0,
+		}).Return([]Certificate{{CertificateID: "00000000", TemplateID: 1}}, nil).Once()
+
+		_, err := pq.UpdateTemplate(ctx, nil, UpdateTemplateParams{TemplateID: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, p.Len())
+	})
+	t.Run("nothing enqueued if update failed", func(t *testing.T) {
+		var r testRenders
+		ctx := context.Background()
+		m := NewMockQuerier(t)
+		p := NewPrerenderer(r.render, 0, 0)
+		pq := NewPrerenderQueries(m, p)
+		m.EXPECT().UpdateCourse(ctx, nil, UpdateCourseParams{CourseID: 1}).Return(Course{}, fmt.Errorf("failed")).Once()
+
+		_, err := pq.UpdateCourse(ctx, nil, UpdateCourseParams{CourseID: 1})
+
+		assert.Error(t, err)
+		assert.Zero(t, p.Len())
+	})
+	t.Run("certificate request recorded as access", func(t *testing.T) {
+		var r testRenders
+		ctx := context.Background()
+		m := NewMockQuerier(t)
+		p := NewPrerenderer(r.render, 0, 0)
+		pq := NewPrerenderQueries(m, p)
+		m.EXPECT().GetCertificate(ctx, nil, "00000001").Return(Certificate{CertificateID: "00000001"}, nil).Once()
+		p.Enqueue("00000000", "00000001")
+
+		_, err := pq.GetCertificate(ctx, nil, "00000001")
+
+		require.NoError(t, err)
+		id, ok := p.pop()
+		require.True(t, ok)
+		assert.Equal(t, "00000001", id)
+	})
+}
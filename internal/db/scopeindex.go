@@ -0,0 +1,162 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// scopeIndex tracks cached list and count responses by scope, so all pages
+// and counts of a list can be invalidated at once. Keys are tracked before
+// they are cached, so index may refer to keys never cached or already
+// evicted, they are pruned once index outgrows cache.
+type scopeIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{}
+	size int
+}
+
+// scopeIndexMinPrune is a size of index below which it is never pruned
+const scopeIndexMinPrune = 1024
+
+const (
+	scopeCerts    = "certificates"
+	scopeCourses  = "courses"
+	scopeStudents = "students"
+	scopeTmpls    = "templates"
+)
+
+// scopeOf return scope of list of templates, courses or students
+func scopeOf(p prefix) string {
+	switch p {
+	case prefCourse:
+		return scopeCourses
+	case prefStudent:
+		return scopeStudents
+	case prefTmpl:
+		return scopeTmpls
+	default:
+		return scopeCerts
+	}
+}
+
+// certScope return scope of list of certificates linked to template, course
+// or student with given id
+func certScope(p prefix, id int32) string {
+	return scopeCerts + "/" + p.key(strconv.Itoa(int(id)))
+}
+
+// certScopes return scopes of all lists certificate may appear in
+func certScopes(cert Certificate) []string {
+	return ownersOf(cert).scopes()
+}
+
+// scopes return scopes of all lists certificate of owners may appear in
+func (o certOwners) scopes() []string {
+	return []string{
+		scopeCerts,
+		certScope(prefTmpl, o.template),
+		certScope(prefCourse, o.course),
+		certScope(prefStudent, o.student),
+	}
+}
+
+// scopeOfKey return scope of cached list or count key
+func scopeOfKey(key string) (string, bool) {
+	if scope, ok := strings.CutPrefix(key, prefLen.String()); ok {
+		return scope, true
+	}
+	if rest, ok := strings.CutPrefix(key, prefList.String()); ok {
+		scope, _, _ := strings.Cut(rest, "?")
+		return scope, true
+	}
+	return "", false
+}
+
+func newScopeIndex() *scopeIndex {
+	i := &scopeIndex{}
+	i.reset()
+	return i
+}
+
+func (i *scopeIndex) add(scope string, key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	keys, ok := i.keys[scope]
+	if !ok {
+		keys = make(map[string]struct{})
+		i.keys[scope] = keys
+	}
+	if _, ok := keys[key]; !ok {
+		keys[key] = struct{}{}
+		i.size++
+	}
+}
+
+// take removes scopes from index, return keys tracked by them
+func (i *scopeIndex) take(scopes ...string) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var keys []string
+	for _, scope := range scopes {
+		keys = append(keys, i.takeLocked(scope)...)
+	}
+	return keys
+}
+
+// takePrefix removes all scopes starting with prefix, return keys tracked by
+// them
+func (i *scopeIndex) takePrefix(prefix string) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var keys []string
+	for scope := range i.keys {
+		if strings.HasPrefix(scope, prefix) {
+			keys = append(keys, i.takeLocked(scope)...)
+		}
+	}
+	return keys
+}
+
+func (i *scopeIndex) takeLocked(scope string) []string {
+	keys := make([]string, 0, len(i.keys[scope]))
+	for key := range i.keys[scope] {
+		keys = append(keys, key)
+	}
+	i.size -= len(keys)
+	delete(i.keys, scope)
+	return keys
+}
+
+func (i *scopeIndex) len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.size
+}
+
+func (i *scopeIndex) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = make(map[string]map[string]struct{})
+	i.size = 0
+}
+
+// prune removes keys which are no longer cached. Loads in flight would be
+// stored after being tracked, so they are discarded by discardLoads before
+// cache is checked.
+func (i *scopeIndex) prune(cached func(key string) bool, discardLoads func()) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	discardLoads()
+	for scope, keys := range i.keys {
+		for key := range keys {
+			if !cached(key) {
+				delete(keys, key)
+				i.size--
+			}
+		}
+		if len(keys) == 0 {
+			delete(i.keys, scope)
+		}
+	}
+}
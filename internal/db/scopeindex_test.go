@@ -0,0 +1,218 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeIndex(t *testing.T) {
+	t.Run("take return keys of given scopes only", func(t *testing.T) {
+		i := newScopeIndex()
+		i.add(scopeCourses, "a")
+		i.add(scopeCourses, "b")
+		i.add(scopeStudents, "c")
+
+		assert.ElementsMatch(t, []string{"a", "b"}, i.take(scopeCourses))
+		assert.Empty(t, i.take(scopeCourses))
+		assert.Equal(t, 1, i.len())
+	})
+	t.Run("take prefix return keys of all certificate scopes", func(t *testing.T) {
+		i := newScopeIndex()
+		i.add(scopeCerts, "a")
+		i.add(certScope(prefCourse, 1), "b")
+		i.add(scopeCourses, "c")
+
+		assert.ElementsMatch(t, []string{"a", "b"}, i.takePrefix(scopeCerts))
+		assert.Equal(t, 1, i.len())
+	})
+	t.Run("prune removes keys which are not cached and discards loads", func(t *testing.T) {
+		i := newScopeIndex()
+		i.add(scopeCourses, "a")
+		i.add(scopeCourses, "b")
+		var discarded bool
+
+		i.prune(func(key string) bool { return key == "b" }, func() { discarded = true })
+
+		assert.True(t, discarded)
+		assert.Equal(t, []string{"b"}, i.take(scopeCourses))
+	})
+}
+
+func TestCachedQueriesLists(t *testing.T) {
+	t.Run("list pages and counts cached separately", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		first := []Course{{CourseID: 1}, {CourseID: 2}}
+		second := []Course{{CourseID: 3}}
+		m.EXPECT().ListCourses(ctx, nil, ListCoursesParams{Limit: 2, Offset: 0}).Return(first, nil).Once()
+		m.EXPECT().ListCourses(ctx, nil, ListCoursesParams{Limit: 2, Offset: 2}).Return(second, nil).Once()
+		m.EXPECT().ListCoursesLen(ctx, nil).Return(3, nil).Once()
+
+		for i := 0; i < 2; i++ {
+			got, err := cq.ListCourses(ctx, nil, ListCoursesParams{Limit: 2, Offset: 0})
+			require.NoError(t, err)
+			assert.Equal(t, first, got)
+			got, err = cq.ListCourses(ctx, nil, ListCoursesParams{Limit: 2, Offset: 2})
+			require.NoError(t, err)
+			assert.Equal(t, second, got)
+			l, err := cq.ListCoursesLen(ctx, nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), l)
+		}
+
+		assert.Equal(t, uint64(3), c.Len())
+		m.AssertExpectations(t)
+	})
+	t.Run("created course invalidates course lists only", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		m.EXPECT().ListCoursesLen(ctx, nil).Return(0, nil).Once()
+		m.EXPECT().ListStudentsLen(ctx, nil).Return(0, nil).Once()
+		_, err := cq.ListCoursesLen(ctx, nil)
+		require.NoError(t, err)
+		_, err = cq.ListStudentsLen(ctx, nil)
+		require.NoError(t, err)
+
+		m.EXPECT().CreateCourse(ctx, nil, []byte{}).Return(Course{CourseID: 1}, nil).Once()
+		_, err = cq.CreateCourse(ctx, nil, []byte{})
+		require.NoError(t, err)
+
+		m.EXPECT().ListCoursesLen(ctx, nil).Return(1, nil).Once()
+		l, err := cq.ListCoursesLen(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), l)
+		l, err = cq.ListStudentsLen(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), l)
+		m.AssertExpectations(t)
+	})
+	t.Run("created certificate invalidates lists of its course, student and template", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		cert := Certificate{CertificateID: "00000000", TemplateID: 1, CourseID: 2, StudentID: 3}
+		m.EXPECT().ListCertificatesLen(ctx, nil).Return(0, nil).Once()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(0, nil).Once()
+		m.EXPECT().ListCertificatesByCourseLen(ctx, nil, int32(2)).Return(0, nil).Once()
+		m.EXPECT().ListCertificatesByStudentLen(ctx, nil, int32(3)).Return(0, nil).Once()
+		m.EXPECT().ListCertificatesByCourseLen(ctx, nil, int32(4)).Return(0, nil).Once()
+		lens := func() []int64 {
+			var res []int64
+			for _, f := range []func() (int64, error){
+				func() (int64, error) { return cq.ListCertificatesLen(ctx, nil) },
+				func() (int64, error) { return cq.ListCertificatesByTemplateLen(ctx, nil, 1) },
+				func() (int64, error) { return cq.ListCertificatesByCourseLen(ctx, nil, 2) },
+				func() (int64, error) { return cq.ListCertificatesByStudentLen(ctx, nil, 3) },
+				func() (int64, error) { return cq.ListCertificatesByCourseLen(ctx, nil, 4) },
+			} {
+				l, err := f()
+				require.NoError(t, err)
+				res = append(res, l)
+			}
+			return res
+		}
+		require.Equal(t, []int64{0, 0, 0, 0, 0}, lens())
+
+		m.EXPECT().CreateCertificate(ctx, nil, CreateCertificateParams{}).Return(cert, nil).Once()
+		_, err := cq.CreateCertificate(ctx, nil, CreateCertificateParams{})
+		require.NoError(t, err)
+
+		m.EXPECT().ListCertificatesLen(ctx, nil).Return(1, nil).Once()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(1, nil).Once()
+		m.EXPECT().ListCertificatesByCourseLen(ctx, nil, int32(2)).Return(1, nil).Once()
+		m.EXPECT().ListCertificatesByStudentLen(ctx, nil, int32(3)).Return(1, nil).Once()
+		assert.Equal(t, []int64{1, 1, 1, 1, 0}, lens())
+		m.AssertExpectations(t)
+	})
+	t.Run("updated student invalidates student and certificate lists", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		certs := []Certificate{{CertificateID: "00000000", StudentID: 1}}
+		params := ListCertificatesByCourseParams{CourseID: 2, Limit: 10}
+		m.EXPECT().ListCertificatesByCourse(ctx, nil, params).Return(certs, nil).Twice()
+		m.EXPECT().ListStudents(ctx, nil, ListStudentsParams{Limit: 10}).Return([]Student{{StudentID: 1}}, nil).Twice()
+		_, err := cq.ListCertificatesByCourse(ctx, nil, params)
+		require.NoError(t, err)
+		_, err = cq.ListStudents(ctx, nil, ListStudentsParams{Limit: 10})
+		require.NoError(t, err)
+
+		arg := UpdateStudentParams{StudentID: 1, Data: []byte{}}
+		m.EXPECT().UpdateStudent(ctx, nil, arg).Return(Student{StudentID: 1}, nil).Once()
+		_, err = cq.UpdateStudent(ctx, nil, arg)
+		require.NoError(t, err)
+
+		_, err = cq.ListCertificatesByCourse(ctx, nil, params)
+		require.NoError(t, err)
+		_, err = cq.ListStudents(ctx, nil, ListStudentsParams{Limit: 10})
+		require.NoError(t, err)
+		m.AssertExpectations(t)
+	})
+	t.Run("certificate notification invalidates certificate lists", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(0, nil).Once()
+		_, err := cq.ListCertificatesByTemplateLen(ctx, nil, 1)
+		require.NoError(t, err)
+
+		cq.Invalidate("certificate", "00000000")
+
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(1, nil).Once()
+		l, err := cq.ListCertificatesByTemplateLen(ctx, nil, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), l)
+		m.AssertExpectations(t)
+	})
+	t.Run("certificate notification with owners invalidates only lists of its owners", func(t *testing.T) {
+		cq, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(0, nil).Once()
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(2)).Return(0, nil).Once()
+		_, err := cq.ListCertificatesByTemplateLen(ctx, nil, 1)
+		require.NoError(t, err)
+		_, err = cq.ListCertificatesByTemplateLen(ctx, nil, 2)
+		require.NoError(t, err)
+		n, err := parseNotification("certificate:00000000:1:1:1")
+		require.NoError(t, err)
+
+		n.invalidate(cq)
+
+		m.EXPECT().ListCertificatesByTemplateLen(ctx, nil, int32(1)).Return(1, nil).Once()
+		l, err := cq.ListCertificatesByTemplateLen(ctx, nil, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), l)
+		l, err = cq.ListCertificatesByTemplateLen(ctx, nil, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), l)
+		m.AssertExpectations(t)
+	})
+	t.Run("restored lists invalidated as cached ones", func(t *testing.T) {
+		src, _, m := prepCachedQueries(t)
+		ctx := context.Background()
+		courses := []Course{{CourseID: 1, Data: []byte(`{}`)}}
+		m.EXPECT().ListCourses(ctx, nil, ListCoursesParams{Limit: 10}).Return(courses, nil).Once()
+		m.EXPECT().ListCoursesLen(ctx, nil).Return(1, nil).Once()
+		_, err := src.ListCourses(ctx, nil, ListCoursesParams{Limit: 10})
+		require.NoError(t, err)
+		_, err = src.ListCoursesLen(ctx, nil)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+
+		got, c, _ := prepCachedQueries(t)
+		restored, err := got.Restore(ctx, nil, &buf, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), restored)
+		list, err := got.ListCourses(ctx, nil, ListCoursesParams{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, courses, list)
+
+		got.Invalidate("course", "1")
+
+		assert.Equal(t, uint64(0), c.Len())
+		m.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteQueries is a Querier of sqlite database for single instance
+// deployments, schema is created by migrations of db/migrations/sqlite.
+// Certificate ids and timestamps are maintained here instead of triggers,
+// errors are returned as *pgconn.PgError with codes of postgres, so callers
+// handle both databases the same. Data is bound as text, as blobs are not
+// valid json for sqlite. db argument of queries is ignored, so queries can't
+// be run in transaction.
+type SQLiteQueries struct {
+	db    *sql.DB
+	clock statementClock
+	genID func() (string, error)
+}
+
+func NewSQLiteQueries(db *sql.DB) *SQLiteQueries {
+	return &SQLiteQueries{db: db, genID: randomCertificateID}
+}
+
+// sqliteError converts errors of sqlite to errors returned by postgres
+func sqliteError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch e.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return newPgError(codeForeignKeyViolation, e.Error(), "", "")
+	case sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+		// restricted deletes fail as triggers
+		if strings.Contains(e.Error(), "FOREIGN KEY") {
+			return newPgError(codeForeignKeyViolation, e.Error(), "", "")
+		}
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return newPgError(codeCheckViolation, e.Error(), "", "")
+	}
+	return err
+}
+
+type sqliteRow interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteCertificate(row sqliteRow) (Certificate, error) {
+	var c Certificate
+	var ts int64
+	err := row.Scan(&c.CertificateID, &c.TemplateID, &c.CourseID, &c.StudentID, &ts, &c.Data)
+	if err != nil {
+		return Certificate{}, sqliteError(err)
+	}
+	c.Timestamp = pgtype.Timestamptz{Time: time.UnixMicro(ts), Valid: true}
+	return c, nil
+}
+
+func scanSQLiteCourse(row sqliteRow) (Course, error) {
+	var c Course
+	err := row.Scan(&c.CourseID, &c.Data)
+	return c, sqliteError(err)
+}
+
+func scanSQLiteStudent(row sqliteRow) (Student, error) {
+	var s Student
+	err := row.Scan(&s.StudentID, &s.Data)
+	return s, sqliteError(err)
+}
+
+func scanSQLiteTemplate(row sqliteRow) (Template, error) {
+	var t Template
+	err := row.Scan(&t.TemplateID, &t.Content)
+	return t, sqliteError(err)
+}
+
+// sqliteList return rows of query, nil if there are none
+func sqliteList[T any](ctx context.Context, db *sql.DB, scan func(row sqliteRow) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	defer rows.Close()
+	var items []T
+	for rows.Next() {
+		i, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError(err)
+	}
+	return items, nil
+}
+
+func (q *SQLiteQueries) count(ctx context.Context, query string, args ...any) (int64, error) {
+	var n int64
+	err := q.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, sqliteError(err)
+}
+
+// updateLinked runs update of template, course or student and bumps
+// timestamps of certificates linked to it in one transaction
+func updateLinked[T any](ctx context.Context, q *SQLiteQueries, scan func(row sqliteRow) (T, error), column string, id int32, query string, args ...any) (T, error) {
+	var zero T
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return zero, err
+	}
+	defer tx.Rollback()
+	res, err := scan(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return zero, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE certificate SET timestamp = ? WHERE "+column+" = ?",
+		q.clock.now().Time.UnixMicro(), id)
+	if err != nil {
+		return zero, sqliteError(err)
+	}
+	return res, tx.Commit()
+}
+
+const sqliteCertificateColumns = "certificate_id, template_id, course_id, student_id, timestamp, data"
+
+func (q *SQLiteQueries) CreateCertificate(ctx context.Context, db DBTX, arg CreateCertificateParams) (Certificate, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Certificate{}, err
+	}
+	for i := 0; i < genIDAttempts; i++ {
+		id, err := q.genID()
+		if err != nil {
+			return Certificate{}, err
+		}
+		row := q.db.QueryRowContext(ctx, `INSERT INTO certificate (`+sqliteCertificateColumns+`)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING `+sqliteCertificateColumns,
+			id, arg.TemplateID, arg.CourseID, arg.StudentID, q.clock.now().Time.UnixMicro(), string(data))
+		cert, err := scanSQLiteCertificate(row)
+		var e *sqlite.Error
+		if errors.As(err, &e) && e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+			continue
+		}
+		return cert, err
+	}
+	return Certificate{}, newPgError(codeRaiseException, "certificate_id generation failed, retry limit exceeded", "", "")
+}
+
+func (q *SQLiteQueries) CreateCourse(ctx context.Context, db DBTX, data []byte) (Course, error) {
+	data, err := jsonbOrEmpty(data)
+	if err != nil {
+		return Course{}, err
+	}
+	return scanSQLiteCourse(q.db.QueryRowContext(ctx,
+		"INSERT INTO course (data) VALUES (?) RETURNING course_id, data", string(data)))
+}
+
+func (q *SQLiteQueries) CreateStudent(ctx context.Context, db DBTX, data []byte) (Student, error) {
+	data, err := jsonbOrEmpty(data)
+	if err != nil {
+		return Student{}, err
+	}
+	return scanSQLiteStudent(q.db.QueryRowContext(ctx,
+		"INSERT INTO student (data) VALUES (?) RETURNING student_id, data", string(data)))
+}
+
+func (q *SQLiteQueries) CreateTemplate(ctx context.Context, db DBTX, content string) (Template, error) {
+	return scanSQLiteTemplate(q.db.QueryRowContext(ctx,
+		"INSERT INTO template (content) VALUES (?) RETURNING template_id, content", content))
+}
+
+func (q *SQLiteQueries) DeleteCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
+	return scanSQLiteCertificate(q.db.QueryRowContext(ctx,
+		"DELETE FROM certificate WHERE certificate_id = ? RETURNING "+sqliteCertificateColumns, certificateID))
+}
+
+func (q *SQLiteQueries) DeleteCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
+	return scanSQLiteCourse(q.db.QueryRowContext(ctx,
+		"DELETE FROM course WHERE course_id = ? RETURNING course_id, data", courseID))
+}
+
+func (q *SQLiteQueries) DeleteStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
+	return scanSQLiteStudent(q.db.QueryRowContext(ctx,
+		"DELETE FROM student WHERE student_id = ? RETURNING student_id, data", studentID))
+}
+
+func (q *SQLiteQueries) DeleteTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
+	return scanSQLiteTemplate(q.db.QueryRowContext(ctx,
+		"DELETE FROM template WHERE template_id = ? RETURNING template_id, content", templateID))
+}
+
+func (q *SQLiteQueries) GetCertificate(ctx context.Context, db DBTX, certificateID string) (Certificate, error) {
+	return scanSQLiteCertificate(q.db.QueryRowContext(ctx,
+		"SELECT "+sqliteCertificateColumns+" FROM certificate WHERE certificate_id = ?", certificateID))
+}
+
+func (q *SQLiteQueries) GetCourse(ctx context.Context, db DBTX, courseID int32) (Course, error) {
+	return scanSQLiteCourse(q.db.QueryRowContext(ctx,
+		"SELECT course_id, data FROM course WHERE course_id = ?", courseID))
+}
+
+func (q *SQLiteQueries) GetStudent(ctx context.Context, db DBTX, studentID int32) (Student, error) {
+	return scanSQLiteStudent(q.db.QueryRowContext(ctx,
+		"SELECT student_id, data FROM student WHERE student_id = ?", studentID))
+}
+
+func (q *SQLiteQueries) GetTemplate(ctx context.Context, db DBTX, templateID int32) (Template, error) {
+	return scanSQLiteTemplate(q.db.QueryRowContext(ctx,
+		"SELECT template_id, content FROM template WHERE template_id = ?", templateID))
+}
+
+// listCertificatesWhere return page of certificates linked to row with id
+func (q *SQLiteQueries) listCertificatesWhere(ctx context.Context, column string, id int32, limit int64, offset int64) ([]Certificate, error) {
+	if err := checkPage(limit, offset); err != nil {
+		return nil, err
+	}
+	return sqliteList(ctx, q.db, scanSQLiteCertificate, fmt.Sprintf(
+		"SELECT %s FROM certificate WHERE %s = ? ORDER BY certificate_id LIMIT ? OFFSET ?", sqliteCertificateColumns, column),
+		id, limit, offset)
+}
+
+func (q *SQLiteQueries) ListCertificates(ctx context.Context, db DBTX, arg ListCertificatesParams) ([]Certificate, error) {
+	if err := checkPage(arg.Limit, arg.Offset); err != nil {
+		return nil, err
+	}
+	return sqliteList(ctx, q.db, scanSQLiteCertificate,
+		"SELECT "+sqliteCertificateColumns+" FROM certificate ORDER BY certificate_id LIMIT ? OFFSET ?", arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListCertificatesByCourse(ctx context.Context, db DBTX, arg ListCertificatesByCourseParams) ([]Certificate, error) {
+	return q.listCertificatesWhere(ctx, "course_id", arg.CourseID, arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListCertificatesByCourseLen(ctx context.Context, db DBTX, courseID int32) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM certificate WHERE course_id = ?", courseID)
+}
+
+func (q *SQLiteQueries) ListCertificatesByStudent(ctx context.Context, db DBTX, arg ListCertificatesByStudentParams) ([]Certificate, error) {
+	return q.listCertificatesWhere(ctx, "student_id", arg.StudentID, arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListCertificatesByStudentLen(ctx context.Context, db DBTX, studentID int32) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM certificate WHERE student_id = ?", studentID)
+}
+
+func (q *SQLiteQueries) ListCertificatesByTemplate(ctx context.Context, db DBTX, arg ListCertificatesByTemplateParams) ([]Certificate, error) {
+	return q.listCertificatesWhere(ctx, "template_id", arg.TemplateID, arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListCertificatesByTemplateLen(ctx context.Context, db DBTX, templateID int32) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM certificate WHERE template_id = ?", templateID)
+}
+
+func (q *SQLiteQueries) ListCertificatesLen(ctx context.Context, db DBTX) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM certificate")
+}
+
+func (q *SQLiteQueries) ListCourses(ctx context.Context, db DBTX, arg ListCoursesParams) ([]Course, error) {
+	if err := checkPage(arg.Limit, arg.Offset); err != nil {
+		return nil, err
+	}
+	return sqliteList(ctx, q.db, scanSQLiteCourse,
+		"SELECT course_id, data FROM course ORDER BY course_id LIMIT ? OFFSET ?", arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListCoursesLen(ctx context.Context, db DBTX) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM course")
+}
+
+func (q *SQLiteQueries) ListStudents(ctx context.Context, db DBTX, arg ListStudentsParams) ([]Student, error) {
+	if err := checkPage(arg.Limit, arg.Offset); err != nil {
+		return nil, err
+	}
+	return sqliteList(ctx, q.db, scanSQLiteStudent,
+		"SELECT student_id, data FROM student ORDER BY student_id LIMIT ? OFFSET ?", arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListStudentsLen(ctx context.Context, db DBTX) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM student")
+}
+
+func (q *SQLiteQueries) ListTemplates(ctx context.Context, db DBTX, arg ListTemplatesParams) ([]Template, error) {
+	if err := checkPage(arg.Limit, arg.Offset); err != nil {
+		return nil, err
+	}
+	return sqliteList(ctx, q.db, scanSQLiteTemplate,
+		"SELECT template_id, content FROM template ORDER BY template_id LIMIT ? OFFSET ?", arg.Limit, arg.Offset)
+}
+
+func (q *SQLiteQueries) ListTemplatesLen(ctx context.Context, db DBTX) (int64, error) {
+	return q.count(ctx, "SELECT count(*) FROM template")
+}
+
+func (q *SQLiteQueries) UpdateCertificate(ctx context.Context, db DBTX, arg UpdateCertificateParams) (Certificate, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return scanSQLiteCertificate(q.db.QueryRowContext(ctx,
+		"UPDATE certificate SET data = ?, timestamp = ? WHERE certificate_id = ? RETURNING "+sqliteCertificateColumns,
+		string(data), q.clock.now().Time.UnixMicro(), arg.CertificateID))
+}
+
+func (q *SQLiteQueries) UpdateCourse(ctx context.Context, db DBTX, arg UpdateCourseParams) (Course, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Course{}, err
+	}
+	return updateLinked(ctx, q, scanSQLiteCourse, "course_id", arg.CourseID,
+		"UPDATE course SET data = ? WHERE course_id = ? RETURNING course_id, data", string(data), arg.CourseID)
+}
+
+func (q *SQLiteQueries) UpdateStudent(ctx context.Context, db DBTX, arg UpdateStudentParams) (Student, error) {
+	data, err := jsonbOrEmpty(arg.Data)
+	if err != nil {
+		return Student{}, err
+	}
+	return updateLinked(ctx, q, scanSQLiteStudent, "student_id", arg.StudentID,
+		"UPDATE student SET data = ? WHERE student_id = ? RETURNING student_id, data", string(data), arg.StudentID)
+}
+
+func (q *SQLiteQueries) UpdateTemplate(ctx context.Context, db DBTX, arg UpdateTemplateParams) (Template, error) {
+	return updateLinked(ctx, q, scanSQLiteTemplate, "template_id", arg.TemplateID,
+		"UPDATE template SET content = ? WHERE template_id = ? RETURNING template_id, content", arg.Content, arg.TemplateID)
+}
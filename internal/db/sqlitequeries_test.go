@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func prepSQLite(tb testing.TB) *SQLiteQueries {
+	tb.Helper()
+	dsn := "sqlite://" + filepath.Join(tb.TempDir(), "test.db")
+	m, err := migrate.New("file://../../db/migrations/sqlite", dsn)
+	require.NoError(tb, err)
+	require.NoError(tb, m.Up())
+	sErr, dErr := m.Close()
+	require.NoError(tb, errors.Join(sErr, dErr))
+
+	b, err := Open(context.Background(), dsn)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { b.Close() })
+	return b.Querier.(*SQLiteQueries)
+}
+
+func TestSQLiteQueriesImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Querier)(nil), &SQLiteQueries{})
+}
+
+func TestSQLiteQueriesConformance(t *testing.T) {
+	testQuerierConformance(t, prepSQLite(t), nil)
+}
+
+func TestSQLiteQueriesCertificateID(t *testing.T) {
+	t.Run("colliding id regenerated", func(t *testing.T) {
+		q := prepSQLite(t)
+		ctx := context.Background()
+		ids := []string{"00000000", "00000000", "00000001"}
+		q.genID = func() (string, error) {
+			id := ids[0]
+			ids = ids[1:]
+			return id, nil
+		}
+		p := prepareQuerierCertificateParams(t, q)
+
+		first, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+		second, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+
+		assert.Equal(t, "00000000", first.CertificateID)
+		assert.Equal(t, "00000001", second.CertificateID)
+	})
+	t.Run("generation failed once attempts exceeded", func(t *testing.T) {
+		q := prepSQLite(t)
+		ctx := context.Background()
+		q.genID = func() (string, error) { return "00000000", nil }
+		p := prepareQuerierCertificateParams(t, q)
+		_, err := q.CreateCertificate(ctx, nil, p)
+		require.NoError(t, err)
+
+		_, err = q.CreateCertificate(ctx, nil, p)
+
+		var pgErr *pgconn.PgError
+		require.True(t, errors.As(err, &pgErr))
+		assert.Equal(t, codeRaiseException, pgErr.Code)
+	})
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("backend selected by dsn scheme", func(t *testing.T) {
+		ctx := context.Background()
+
+		b, err := Open(ctx, "memory://")
+		require.NoError(t, err)
+		assert.IsType(t, &MemoryQueries{}, b.Querier)
+		assert.NoError(t, b.Close())
+
+		b, err = Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "test.db"))
+		require.NoError(t, err)
+		assert.IsType(t, &SQLiteQueries{}, b.Querier)
+		assert.Nil(t, b.DB)
+		assert.NoError(t, b.Close())
+
+		b, err = Open(ctx, "postgres://user@localhost:5432/db")
+		require.NoError(t, err)
+		assert.IsType(t, &Queries{}, b.Querier)
+		assert.NotNil(t, b.DB)
+		assert.NoError(t, b.Close())
+	})
+	t.Run("transactions rejected by backends without them", func(t *testing.T) {
+		ctx := context.Background()
+		for _, dsn := range []string{"memory://", "sqlite://" + filepath.Join(t.TempDir(), "test.db")} {
+			b, err := Open(ctx, dsn)
+			require.NoError(t, err)
+
+			_, err = b.Begin(ctx)
+			assert.ErrorIs(t, err, ErrTxNotSupported)
+			called := false
+			err = RunInTx(ctx, b, func(tx *Tx) error {
+				called = true
+				return nil
+			})
+			assert.ErrorIs(t, err, ErrTxNotSupported)
+			assert.False(t, called)
+			assert.NoError(t, b.Close())
+		}
+	})
+	t.Run("unsupported scheme rejected", func(t *testing.T) {
+		_, err := Open(context.Background(), "mysql://localhost/db")
+		assert.ErrorContains(t, err, "unsupported")
+		_, err = Open(context.Background(), "test.db")
+		assert.ErrorContains(t, err, "invalid dsn")
+	})
+	t.Run("sqlite options preserved and required pragmas added", func(t *testing.T) {
+		dsn := sqliteDSN("/tmp/test.db?_txlock=exclusive")
+
+		assert.Contains(t, dsn, "file:/tmp/test.db?")
+		assert.Contains(t, dsn, "_txlock=exclusive")
+		assert.Contains(t, dsn, "_pragma=foreign_keys(1)")
+		assert.NotContains(t, dsn, "_txlock=immediate")
+	})
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxBeginner starts transactions, implemented by pgx.Conn, pgxpool.Pool and
+// pgx.Tx
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Tx is a transaction which buffers side effects of queries, such as cache
+// mutations, they are applied once transaction is committed and discarded on
+// rollback. Queries made with Tx bypass caches, as they may see uncommitted
+// changes.
+type Tx struct {
+	pgx.Tx
+	parent *Tx
+	buf    txBuffer
+}
+
+// txBuffer holds side effects in order they were made
+type txBuffer struct {
+	mu  sync.Mutex
+	ops []func()
+}
+
+func (b *txBuffer) add(op func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ops = append(b.ops, op)
+}
+
+func (b *txBuffer) take() []func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ops := b.ops
+	b.ops = nil
+	return ops
+}
+
+// WithTx wraps transaction, so side effects of queries made with it are
+// buffered until commit
+func WithTx(tx pgx.Tx) *Tx {
+	if t, ok := tx.(*Tx); ok {
+		return t
+	}
+	return &Tx{Tx: tx}
+}
+
+// Begin starts pseudo nested transaction, its side effects are passed to
+// parent on commit
+func (tx *Tx) Begin(ctx context.Context) (pgx.Tx, error) {
+	nested, err := tx.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: nested, parent: tx}, nil
+}
+
+// Commit commits transaction and applies buffered side effects, they are
+// discarded if commit failed
+func (tx *Tx) Commit(ctx context.Context) error {
+	if err := tx.Tx.Commit(ctx); err != nil {
+		tx.buf.take()
+		return err
+	}
+	for _, op := range tx.buf.take() {
+		if tx.parent != nil {
+			tx.parent.buf.add(op)
+		} else {
+			op()
+		}
+	}
+	return nil
+}
+
+// Rollback discards buffered side effects and rolls transaction back
+func (tx *Tx) Rollback(ctx context.Context) error {
+	tx.buf.take()
+	return tx.Tx.Rollback(ctx)
+}
+
+// afterCommit runs fn once changes made with db are committed, immediately if
+// db is not a Tx
+func afterCommit(db DBTX, fn func()) {
+	if tx, ok := db.(*Tx); ok {
+		tx.buf.add(fn)
+		return
+	}
+	fn()
+}
+
+// inTx reports whether db is a transaction buffering side effects
+func inTx(db DBTX) bool {
+	_, ok := db.(*Tx)
+	return ok
+}
+
+// RunInTx runs fn in transaction, it is committed if fn return nil and rolled
+// back otherwise
+func RunInTx(ctx context.Context, db TxBeginner, fn func(tx *Tx) error) (err error) {
+	t, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	tx := WithTx(t)
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
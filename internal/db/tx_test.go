@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testTx is a transaction without connection, only its outcome is recorded
+type testTx struct {
+	pgx.Tx
+	commitErr  error
+	committed  bool
+	rolledBack bool
+	nested     []*testTx
+}
+
+func (tx *testTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	nested := &testTx{}
+	tx.nested = append(tx.nested, nested)
+	return nested, nil
+}
+
+func (tx *testTx) Commit(ctx context.Context) error {
+	if tx.committed || tx.rolledBack {
+		return pgx.ErrTxClosed
+	}
+	if tx.commitErr != nil {
+		tx.rolledBack = true
+		return tx.commitErr
+	}
+	tx.committed = true
+	return nil
+}
+
+func (tx *testTx) Rollback(ctx context.Context) error {
+	if tx.committed || tx.rolledBack {
+		return pgx.ErrTxClosed
+	}
+	tx.rolledBack = true
+	return nil
+}
+
+// mockAnyTx matches transaction passed to querier
+var mockAnyTx = mock.AnythingOfType("*db.Tx")
+
+func TestRunInTx(t *testing.T) {
+	t.Run("cache mutations applied after commit", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		exp := Course{CourseID: 1}
+		m.EXPECT().CreateCourse(ctx, mockAnyTx, []byte{}).Return(exp, nil).Once()
+
+		err := RunInTx(ctx, db, func(tx *Tx) error {
+			_, err := cq.CreateCourse(ctx, tx, []byte{})
+			require.NoError(t, err)
+			assert.Equal(t, uint64(0), c.Len())
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.True(t, db.nested[0].committed)
+		assert.Equal(t, uint64(1), c.Len())
+		assert.Equal(t, exp, c.Values()[0].value)
+	})
+	t.Run("cache mutations discarded on rollback", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		m.EXPECT().CreateCourse(ctx, mockAnyTx, []byte{}).Return(Course{CourseID: 1}, nil).Once()
+
+		err := RunInTx(ctx, db, func(tx *Tx) error {
+			_, err := cq.CreateCourse(ctx, tx, []byte{})
+			require.NoError(t, err)
+			return fmt.Errorf("failed")
+		})
+
+		assert.ErrorContains(t, err, "failed")
+		assert.True(t, db.nested[0].rolledBack)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("cache mutations discarded if commit failed", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		m.EXPECT().CreateCourse(ctx, mockAnyTx, []byte{}).Return(Course{CourseID: 1}, nil).Once()
+
+		err := RunInTx(ctx, db, func(tx *Tx) error {
+			tx.Tx.(*testTx).commitErr = pgx.ErrTxCommitRollback
+			_, err := cq.CreateCourse(ctx, tx, []byte{})
+			return err
+		})
+
+		assert.ErrorIs(t, err, pgx.ErrTxCommitRollback)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("invalidation applied after commit", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		m.EXPECT().CreateCourse(ctx, nil, []byte{}).Return(Course{CourseID: 1}, nil).Once()
+		_, err := cq.CreateCourse(ctx, nil, []byte{})
+		require.NoError(t, err)
+		m.EXPECT().DeleteCourse(ctx, mockAnyTx, int32(1)).Return(Course{CourseID: 1}, nil).Once()
+
+		err = RunInTx(ctx, db, func(tx *Tx) error {
+			_, err := cq.DeleteCourse(ctx, tx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), c.Len())
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("queries in transaction bypass cache", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		m.EXPECT().GetCourse(ctx, mockAnyTx, int32(1)).Return(Course{CourseID: 1}, nil).Twice()
+
+		err := RunInTx(ctx, db, func(tx *Tx) error {
+			for i := 0; i < 2; i++ {
+				_, err := cq.GetCourse(ctx, tx, 1)
+				require.NoError(t, err)
+			}
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), c.Len())
+	})
+	t.Run("nested transaction passes mutations to parent on commit", func(t *testing.T) {
+		cq, c, m := prepCachedQueries(t)
+		ctx := context.Background()
+		db := &testTx{}
+		m.EXPECT().CreateCourse(ctx, mockAnyTx, []byte{}).Return(Course{CourseID: 1}, nil).Once()
+		m.EXPECT().CreateStudent(ctx, mockAnyTx, []byte{}).Return(Student{StudentID: 1}, nil).Once()
+
+		err := RunInTx(ctx, db, func(tx *Tx) error {
+			err := RunInTx(ctx, tx, func(tx *Tx) error {
+				_, err := cq.CreateCourse(ctx, tx, []byte{})
+				return err
+			})
+			require.NoError(t, err)
+			err = RunInTx(ctx, tx, func(tx *Tx) error {
+				_, err := cq.CreateStudent(ctx, tx, []byte{})
+				require.NoError(t, err)
+				return fmt.Errorf("failed")
+			})
+			require.Error(t, err)
+			assert.Equal(t, uint64(0), c.Len())
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{prefCourse.key("1")}, c.Keys())
+	})
+	t.Run("transaction rolled back on panic", func(t *testing.T) {
+		ctx := context.Background()
+		db := &testTx{}
+
+		assert.Panics(t, func() {
+			RunInTx(ctx, db, func(tx *Tx) error {
+				panic("failed")
+			})
+		})
+
+		assert.True(t, db.nested[0].rolledBack)
+	})
+}
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/eklmv/pdfcertificates/internal/cache"
@@ -9,72 +12,199 @@ import (
 
 type CachedStorage struct {
 	Storage
-	c cache.Cache[uint32, certFile]
+	c        cache.Cache[string, CertFile]
+	observer cache.Observer
+	hits     atomic.Uint64
+	misses   atomic.Uint64
 }
 
-type certFile struct {
+// CertFile is an entry of CachedStorage cache
+type CertFile struct {
 	file      []byte
 	timestamp time.Time
 	size      uint64
 }
 
-func (cf certFile) Size() uint64 {
+func (cf CertFile) Size() uint64 {
 	return cf.size
 }
 
 func NewCachedStorage(storage Storage) *CachedStorage {
-	c := cache.NewSafeCache(cache.NewLRUCache[uint32, certFile](0))
+	return NewCachedStorageWithCache(storage, cache.NewSafeCache(cache.NewLRUCache[string, CertFile](0)))
+}
+
+// NewCachedStorageWithCache creates CachedStorage on top of given cache, e.g.
+// ShardedCache, cache should be safe for concurrent use
+func NewCachedStorageWithCache(storage Storage, c cache.Cache[string, CertFile]) *CachedStorage {
 	return &CachedStorage{Storage: storage, c: c}
 }
 
+// SetObserver sets observer notified about each cache lookup, it should be set
+// before storage is used
+func (cs *CachedStorage) SetObserver(observer cache.Observer) {
+	cs.observer = observer
+}
+
 func (cs *CachedStorage) Add(id string, cert []byte, timestamp time.Time) error {
 	err := cs.Storage.Add(id, cert, timestamp)
 	if err == nil {
-		hash := cache.HashString(id)
-		cf := certFile{
+		cf := CertFile{
 			file:      cert,
 			timestamp: timestamp,
 		}
 		cf.size = cache.SizeOf(cf)
-		cs.c.Add(hash, cf)
+		cs.c.Add(id, cf)
 	}
 	return err
 }
 
 func (cs *CachedStorage) Get(id string, timestamp time.Time) (cert []byte, err error) {
-	hash := cache.HashString(id)
-	cf, ok := cs.c.Peek(hash)
+	cf, ok := cs.c.Peek(id)
 	if ok && (cf.timestamp.Equal(timestamp) || cf.timestamp.After(timestamp)) {
-		cs.c.Touch(hash)
-		slog.Info("sucessful storage cache hit", slog.String("id", id), slog.Time("timestamp", timestamp))
+		cs.c.Touch(id)
+		cs.hits.Add(1)
+		if cs.observer != nil {
+			cs.observer.Hit(id)
+		}
+		slog.Debug("successful storage cache hit", slog.String("id", id), slog.Time("timestamp", timestamp))
 		return cf.file, nil
 	}
+	cs.misses.Add(1)
+	if cs.observer != nil {
+		cs.observer.Miss(id)
+	}
 	cert, err = cs.Storage.Get(id, timestamp)
 	if err == nil {
-		cf := certFile{
+		cf := CertFile{
 			file:      cert,
 			timestamp: timestamp,
 		}
 		cf.size = cache.SizeOf(cf)
-		cs.c.Add(hash, cf)
+		cs.c.Add(id, cf)
 	}
 	return
 }
 
 func (cs *CachedStorage) Delete(id string) {
-	hash := cache.HashString(id)
-	_, ok := cs.c.Peek(hash)
+	_, ok := cs.c.Peek(id)
 	if ok {
-		cs.c.Remove(hash)
+		cs.c.Remove(id)
 	}
 	cs.Storage.Delete(id)
 }
 
 func (cs *CachedStorage) Exists(id string, timestamp time.Time) bool {
-	hash := cache.HashString(id)
-	cf, ok := cs.c.Peek(hash)
+	cf, ok := cs.c.Peek(id)
 	if ok && (cf.timestamp.Equal(timestamp) || cf.timestamp.After(timestamp)) {
 		return true
 	}
 	return cs.Storage.Exists(id, timestamp)
 }
+
+// ListVersions return versions of certificate kept by underlying storage
+func (cs *CachedStorage) ListVersions(id string) ([]time.Time, error) {
+	vs, err := versioned(cs.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(id)
+}
+
+// GetVersion return version of certificate kept by underlying storage,
+// versions are not cached
+func (cs *CachedStorage) GetVersion(id string, timestamp time.Time) ([]byte, error) {
+	vs, err := versioned(cs.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return vs.GetVersion(id, timestamp)
+}
+
+// Stats describes underlying storage, hits and misses are counted for
+// in-memory cache
+func (cs *CachedStorage) Stats() Stats {
+	stats := cs.Storage.Stats()
+	stats.Hits = cs.hits.Load()
+	stats.Misses = cs.misses.Load()
+	return stats
+}
+
+// CacheStats return statistics of in-memory cache, lookups don't go through
+// cache Get, so hits and misses are counted by storage itself
+func (cs *CachedStorage) CacheStats() cache.Stats {
+	stats := cs.c.Stats()
+	stats.Hits = cs.hits.Load()
+	stats.Misses = cs.misses.Load()
+	return stats
+}
+
+// certFileCodec encodes cached certificates for snapshots
+type certFileCodec struct{}
+
+type encodedCertFile struct {
+	File      []byte
+	Timestamp time.Time
+}
+
+func (certFileCodec) Marshal(cf CertFile) ([]byte, error) {
+	return cache.GobCodec[encodedCertFile]{}.Marshal(encodedCertFile{File: cf.file, Timestamp: cf.timestamp})
+}
+
+func (certFileCodec) Unmarshal(data []byte) (CertFile, error) {
+	e, err := cache.GobCodec[encodedCertFile]{}.Unmarshal(data)
+	if err != nil {
+		return CertFile{}, err
+	}
+	cf := CertFile{file: e.File, timestamp: e.Timestamp}
+	cf.size = cache.SizeOf(cf)
+	return cf, nil
+}
+
+// Snapshot writes cached certificates, so cache can be restored after restart
+func (cs *CachedStorage) Snapshot(w io.Writer) error {
+	s, ok := cs.c.(cache.Snapshotter[string, CertFile])
+	if !ok {
+		return fmt.Errorf("snapshot of %T is not supported", cs.c)
+	}
+	return s.Snapshot(w, certFileCodec{})
+}
+
+// Restore loads cached certificates of snapshot, certificates which are no
+// longer stored or were replaced with newer version are skipped
+func (cs *CachedStorage) Restore(r io.Reader) (uint64, error) {
+	s, ok := cs.c.(cache.Snapshotter[string, CertFile])
+	if !ok {
+		return 0, fmt.Errorf("restore of %T is not supported", cs.c)
+	}
+	latest := make(map[string]time.Time)
+	err := cs.Storage.Walk(func(id string, timestamp time.Time) error {
+		latest[id] = timestamp
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored certificates: %w", err)
+	}
+	restored, err := s.Restore(r, certFileCodec{}, func(id string, cf CertFile, _ time.Time) bool {
+		ts, ok := latest[id]
+		return ok && ts.Equal(cf.timestamp)
+	})
+	if err != nil {
+		return restored, err
+	}
+	slog.Info("restored storage cache snapshot", slog.Uint64("restored", restored))
+	return restored, nil
+}
+
+// Invalidate removes changed certificate from in-memory cache, underlying
+// storage is not affected. Implements invalidator of db listener, changes of
+// other tables are ignored, as certificates depending on them are notified
+// separately.
+func (cs *CachedStorage) Invalidate(table string, id string) {
+	if table == "certificate" {
+		cs.c.Remove(id)
+	}
+}
+
+func (cs *CachedStorage) InvalidateAll() {
+	cs.c.Purge()
+}
@@ -1,17 +1,20 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/eklmv/pdfcertificates/internal/cache"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
 func TestCachedStorageImplementsInterface(t *testing.T) {
 	assert.Implements(t, (*Storage)(nil), &CachedStorage{})
+	assert.Implements(t, (*VersionedStorage)(nil), &CachedStorage{})
 }
 
 func TestCachedStorageAdd(t *testing.T) {
@@ -28,7 +31,7 @@ func TestCachedStorageAdd(t *testing.T) {
 
 		require.NoError(t, err)
 		assert.Equal(t, uint64(1), cs.c.Len())
-		assert.Equal(t, cache.HashString(id), cs.c.Keys()[0])
+		assert.Equal(t, id, cs.c.Keys()[0])
 		assert.Equal(t, cert, cs.c.Values()[0].file)
 		m.AssertExpectations(t)
 	})
@@ -92,7 +95,7 @@ func TestCachedStorageGet(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, exp, got)
 		assert.Equal(t, uint64(1), cs.c.Len())
-		assert.Equal(t, cache.HashString(id), cs.c.Keys()[0])
+		assert.Equal(t, id, cs.c.Keys()[0])
 		assert.Equal(t, exp, cs.c.Values()[0].file)
 		m.AssertExpectations(t)
 	})
@@ -170,3 +173,212 @@ func TestCachedStorageExists(t *testing.T) {
 		m.AssertExpectations(t)
 	})
 }
+
+func TestCachedStorageStats(t *testing.T) {
+	t.Run("describe underlying storage, count cache hits and misses", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		cs := NewCachedStorage(m)
+		m.EXPECT().Get(id, timestamp).Return(cert, nil).Once()
+		m.EXPECT().Stats().Return(Stats{Objects: 1, Bytes: uint64(len(cert)), Hits: 5, Misses: 5}).Once()
+
+		_, err := cs.Get(id, timestamp)
+		require.NoError(t, err)
+		_, err = cs.Get(id, timestamp)
+		require.NoError(t, err)
+		stats := cs.Stats()
+
+		assert.Equal(t, Stats{Objects: 1, Bytes: uint64(len(cert)), Hits: 1, Misses: 1}, stats)
+	})
+}
+
+func TestCachedStorageCollidingIDs(t *testing.T) {
+	t.Run("certificates with colliding hashes of ids cached separately", func(t *testing.T) {
+		// FNV-1a 32-bit hashes of ids are equal
+		first, second := "0004a0f5", "000bec20"
+		require.Equal(t, cache.HashString(first), cache.HashString(second))
+		firstCert, secondCert := []byte("first certificate"), []byte("second certificate")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		cs := NewCachedStorage(m)
+		m.EXPECT().Add(first, firstCert, timestamp).Return(nil).Once()
+		m.EXPECT().Add(second, secondCert, timestamp).Return(nil).Once()
+
+		err := cs.Add(first, firstCert, timestamp)
+		require.NoError(t, err)
+		err = cs.Add(second, secondCert, timestamp)
+		require.NoError(t, err)
+
+		got, err := cs.Get(first, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, firstCert, got)
+		got, err = cs.Get(second, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, secondCert, got)
+	})
+}
+
+func TestCachedStorageWithCache(t *testing.T) {
+	t.Run("certificates cached in given sharded cache", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		c := cache.NewShardedCache[string, CertFile](4, 0, cache.HashKey)
+		cs := NewCachedStorageWithCache(m, c)
+		m.EXPECT().Get(id, timestamp).Return(cert, nil).Once()
+
+		_, err := cs.Get(id, timestamp)
+		require.NoError(t, err)
+		got, err := cs.Get(id, timestamp)
+		require.NoError(t, err)
+
+		assert.Equal(t, cert, got)
+		assert.Equal(t, uint64(1), c.Len())
+	})
+}
+
+func TestCachedStorageVersions(t *testing.T) {
+	t.Run("versions passed through to underlying storage", func(t *testing.T) {
+		id := "00000000"
+		fs, err := NewFileSystemWithConfig(testDir(t), FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		cs := NewCachedStorage(fs)
+		timestamp := time.Now()
+		err = cs.Add(id, []byte("first"), timestamp)
+		require.NoError(t, err)
+		err = cs.Add(id, []byte("second"), timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		versions, err := cs.ListVersions(id)
+		require.NoError(t, err)
+		got, err := cs.GetVersion(id, timestamp)
+		require.NoError(t, err)
+
+		assert.Equal(t, []time.Time{timestamp, timestamp.Add(time.Hour)}, versions)
+		assert.Equal(t, []byte("first"), got)
+	})
+	t.Run("underlying storage without versions rejected", func(t *testing.T) {
+		cs := NewCachedStorage(NewMockStorage(t))
+
+		_, err := cs.ListVersions("00000000")
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+		_, err = cs.GetVersion("00000000", time.Now())
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+	})
+}
+
+type testObserver struct {
+	hits   []string
+	misses []string
+}
+
+func (o *testObserver) Hit(key string) {
+	o.hits = append(o.hits, key)
+}
+
+func (o *testObserver) Miss(key string) {
+	o.misses = append(o.misses, key)
+}
+
+func TestCachedStorageObserver(t *testing.T) {
+	t.Run("observer notified about hits and misses, stats counted by storage", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		cs := NewCachedStorage(m)
+		o := &testObserver{}
+		cs.SetObserver(o)
+		m.EXPECT().Get(id, timestamp).Return(exp, nil).Once()
+
+		_, err := cs.Get(id, timestamp)
+		require.NoError(t, err)
+		got, err := cs.Get(id, timestamp)
+		require.NoError(t, err)
+
+		assert.Equal(t, exp, got)
+		assert.Equal(t, []string{id}, o.hits)
+		assert.Equal(t, []string{id}, o.misses)
+		stats := cs.CacheStats()
+		assert.Equal(t, uint64(1), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+		assert.Equal(t, uint64(1), stats.Adds)
+		assert.Equal(t, uint64(1), stats.Len)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedStorageSnapshot(t *testing.T) {
+	t.Run("restore certificates which are still stored with the same timestamp", func(t *testing.T) {
+		timestamp := time.Now().Truncate(time.Second)
+		m := NewMockStorage(t)
+		src := NewCachedStorage(m)
+		ids := []string{"00000000", "00000001", "00000002"}
+		for _, id := range ids {
+			m.EXPECT().Add(id, []byte(id), timestamp).Return(nil).Once()
+			require.NoError(t, src.Add(id, []byte(id), timestamp))
+		}
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+
+		stored := map[string]time.Time{
+			// replaced with newer version
+			"00000000": timestamp.Add(time.Hour),
+			"00000001": timestamp,
+			// "00000002" deleted
+		}
+		m.EXPECT().Walk(mock.Anything).RunAndReturn(func(fn func(string, time.Time) error) error {
+			for id, ts := range stored {
+				if err := fn(id, ts); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Once()
+		got := NewCachedStorage(m)
+		restored, err := got.Restore(&buf)
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), restored)
+		assert.Equal(t, []string{"00000001"}, got.c.Keys())
+		cert, err := got.Get("00000001", timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("00000001"), cert)
+		m.AssertExpectations(t)
+	})
+	t.Run("failed walk of underlying storage return error", func(t *testing.T) {
+		m := NewMockStorage(t)
+		src := NewCachedStorage(m)
+		var buf bytes.Buffer
+		require.NoError(t, src.Snapshot(&buf))
+		m.EXPECT().Walk(mock.Anything).Return(fmt.Errorf("walk failed")).Once()
+
+		_, err := NewCachedStorage(m).Restore(&buf)
+
+		assert.Error(t, err)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestCachedStorageInvalidate(t *testing.T) {
+	t.Run("only cached certificate removed, underlying storage not affected", func(t *testing.T) {
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		cs := NewCachedStorage(m)
+		for _, id := range []string{"00000000", "00000001"} {
+			m.EXPECT().Add(id, []byte(id), timestamp).Return(nil).Once()
+			require.NoError(t, cs.Add(id, []byte(id), timestamp))
+		}
+
+		cs.Invalidate("certificate", "00000000")
+		cs.Invalidate("course", "00000001")
+
+		assert.Equal(t, []string{"00000001"}, cs.c.Keys())
+		cs.InvalidateAll()
+		assert.Equal(t, uint64(0), cs.c.Len())
+		m.AssertExpectations(t)
+	})
+}
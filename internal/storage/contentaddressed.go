@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	iofs "io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentAddressed stores each unique certificate file once as a blob named
+// by sha256 of its content, each version of certificate refers to blob through
+// small index file named by id and timestamp, blob is removed when the last
+// reference to it is deleted. All versions are kept until certificate is
+// deleted, Get serves the latest one, like in FileSystem.
+//
+// Encryption with random nonces makes equal certificates differ, so
+// EncryptedStorage on top of ContentAddressed defeats deduplication.
+type ContentAddressed struct {
+	mu     sync.Mutex
+	path   string
+	refs   map[string][]casRef
+	blobs  map[string]uint64
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type casRef struct {
+	timestamp time.Time
+	hash      string
+	size      uint64
+}
+
+const (
+	casBlobsDir = "blobs/"
+	casIndexDir = "index/"
+)
+
+func NewContentAddressed(absPath string) (*ContentAddressed, error) {
+	absPath = fsEnsureTrailingSlash(absPath)
+	for _, dir := range []string{absPath + casBlobsDir, absPath + casIndexDir} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			slog.Error("failed to initialize new content addressed storage",
+				slog.String("absPath", absPath), slog.Any("error", err))
+			return nil, err
+		}
+	}
+	return &ContentAddressed{
+		path:  absPath,
+		refs:  make(map[string][]casRef),
+		blobs: make(map[string]uint64),
+	}, nil
+}
+
+func (ca *ContentAddressed) blobLink(hash string) string {
+	return ca.path + casBlobsDir + hash[0:2] + "/" + hash[2:4] + "/" + hash
+}
+
+// validHash reports whether hash is a lowercase hex encoded sha256, anything
+// else can't be used as a name of blob
+func validHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	b, err := hex.DecodeString(hash)
+	return err == nil && hex.EncodeToString(b) == hash
+}
+
+func (ca *ContentAddressed) refLink(id string, timestamp time.Time) string {
+	return ca.path + casIndexDir + id + "_" + strconv.FormatInt(timestamp.UnixNano(), 10) + ".ref"
+}
+
+func writeFileAtomic(link string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(link), 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(link), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), link)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// retain increments reference counter of blob, writing it if necessary,
+// should be called with mutex locked
+func (ca *ContentAddressed) retain(hash string, cert []byte) error {
+	if ca.blobs[hash] == 0 {
+		if err := writeFileAtomic(ca.blobLink(hash), cert); err != nil {
+			return err
+		}
+	}
+	ca.blobs[hash]++
+	return nil
+}
+
+// release decrements reference counter of blob, removing it if it is no longer
+// referenced, should be called with mutex locked
+func (ca *ContentAddressed) release(hash string) {
+	if ca.blobs[hash] > 1 {
+		ca.blobs[hash]--
+		return
+	}
+	delete(ca.blobs, hash)
+	if err := os.Remove(ca.blobLink(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("failed to remove unreferenced blob", slog.String("hash", hash), slog.Any("error", err))
+	}
+}
+
+// put stores certificate as version of id with timestamp, previous content of
+// the same version is released, should be called with mutex locked
+func (ca *ContentAddressed) put(id string, cert []byte, timestamp time.Time) error {
+	sum := sha256.Sum256(cert)
+	hash := hex.EncodeToString(sum[:])
+	err := ca.retain(hash, cert)
+	if err == nil {
+		err = writeFileAtomic(ca.refLink(id, timestamp), []byte(hash))
+		if err != nil {
+			ca.release(hash)
+		}
+	}
+	if err != nil {
+		slog.Error("failed to store certificate", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return err
+	}
+	ref := casRef{timestamp: timestamp, hash: hash, size: uint64(len(cert))}
+	refs := ca.refs[id]
+	i := sort.Search(len(refs), func(i int) bool { return !refs[i].timestamp.Before(timestamp) })
+	if i < len(refs) && refs[i].timestamp.Equal(timestamp) {
+		old := refs[i].hash
+		refs[i] = ref
+		ca.release(old)
+		return nil
+	}
+	refs = append(refs, casRef{})
+	copy(refs[i+1:], refs[i:])
+	refs[i] = ref
+	ca.refs[id] = refs
+	return nil
+}
+
+// latest return reference to the latest version of certificate, should be
+// called with mutex locked
+func (ca *ContentAddressed) latest(id string) (casRef, bool) {
+	refs := ca.refs[id]
+	if len(refs) == 0 {
+		return casRef{}, false
+	}
+	return refs[len(refs)-1], true
+}
+
+// version return reference to version of certificate with exact timestamp,
+// should be called with mutex locked
+func (ca *ContentAddressed) version(id string, timestamp time.Time) (casRef, bool) {
+	for _, ref := range ca.refs[id] {
+		if ref.timestamp.Equal(timestamp) {
+			return ref, true
+		}
+	}
+	return casRef{}, false
+}
+
+func (ca *ContentAddressed) removeRef(id string, timestamp time.Time) {
+	err := os.Remove(ca.refLink(id, timestamp))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("failed to remove certificate reference", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+	}
+}
+
+func (ca *ContentAddressed) Add(id string, cert []byte, timestamp time.Time) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ref, ok := ca.latest(id)
+	if ok && (ref.timestamp.Equal(timestamp) || ref.timestamp.After(timestamp)) {
+		slog.Info("same or newer certificate already stored", slog.String("id", id),
+			slog.Time("requested timestamp", timestamp), slog.Time("stored timestamp", ref.timestamp))
+		return nil
+	}
+	return ca.put(id, cert, timestamp)
+}
+
+// Replace overwrites content of stored version of certificate with the same id
+// and timestamp
+func (ca *ContentAddressed) Replace(id string, cert []byte, timestamp time.Time) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if _, ok := ca.version(id, timestamp); !ok {
+		err := CertificateFileNotFoundError
+		slog.Error("failed to replace certificate", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return err
+	}
+	return ca.put(id, cert, timestamp)
+}
+
+func (ca *ContentAddressed) Get(id string, timestamp time.Time) (cert []byte, err error) {
+	ca.mu.Lock()
+	ref, ok := ca.latest(id)
+	ca.mu.Unlock()
+	if ok && (ref.timestamp.Equal(timestamp) || ref.timestamp.After(timestamp)) {
+		return ca.read(id, timestamp, ref)
+	}
+	ca.misses.Add(1)
+	err = CertificateFileNotFoundError
+	slog.Error("requested certificate not found", slog.String("id", id),
+		slog.Time("timestamp", timestamp), slog.Any("error", err))
+	return nil, err
+}
+
+func (ca *ContentAddressed) read(id string, timestamp time.Time, ref casRef) ([]byte, error) {
+	cert, err := os.ReadFile(ca.blobLink(ref.hash))
+	if err != nil {
+		slog.Error("failed to read certificate blob", slog.String("id", id),
+			slog.Time("requested timestamp", timestamp), slog.Time("stored timestamp", ref.timestamp),
+			slog.String("hash", ref.hash), slog.Any("error", err))
+		ca.misses.Add(1)
+		return nil, err
+	}
+	ca.hits.Add(1)
+	return cert, nil
+}
+
+// ListVersions return timestamps of all stored versions of certificate, from
+// the oldest to the latest
+func (ca *ContentAddressed) ListVersions(id string) ([]time.Time, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	refs := ca.refs[id]
+	if len(refs) == 0 {
+		err := CertificateFileNotFoundError
+		slog.Error("requested certificate not found", slog.String("id", id), slog.Any("error", err))
+		return nil, err
+	}
+	timestamps := make([]time.Time, 0, len(refs))
+	for _, ref := range refs {
+		timestamps = append(timestamps, ref.timestamp)
+	}
+	return timestamps, nil
+}
+
+// GetVersion return version of certificate with exact timestamp
+func (ca *ContentAddressed) GetVersion(id string, timestamp time.Time) ([]byte, error) {
+	ca.mu.Lock()
+	ref, ok := ca.version(id, timestamp)
+	ca.mu.Unlock()
+	if !ok {
+		ca.misses.Add(1)
+		err := CertificateFileNotFoundError
+		slog.Error("requested certificate version not found", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return nil, err
+	}
+	return ca.read(id, timestamp, ref)
+}
+
+// Delete removes all versions of certificate
+func (ca *ContentAddressed) Delete(id string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	for _, ref := range ca.refs[id] {
+		ca.removeRef(id, ref.timestamp)
+		ca.release(ref.hash)
+	}
+	delete(ca.refs, id)
+}
+
+func (ca *ContentAddressed) Exists(id string, timestamp time.Time) bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ref, ok := ca.latest(id)
+	return ok && (ref.timestamp.Equal(timestamp) || ref.timestamp.After(timestamp))
+}
+
+// Load rebuilds index and reference counters from disk, references to missing
+// blobs and unreferenced blobs are removed, malformed references are skipped
+func (ca *ContentAddressed) Load() error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	refs := make(map[string][]casRef)
+	blobs := make(map[string]uint64)
+	err := filepath.WalkDir(ca.path+casIndexDir, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		id, timestamp, err := fromFileName(entry.Name())
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash := string(content)
+		if !validHash(hash) {
+			slog.Warn("malformed certificate reference skipped", slog.String("path", path))
+			return nil
+		}
+		info, err := os.Stat(ca.blobLink(hash))
+		if errors.Is(err, os.ErrNotExist) {
+			slog.Warn("certificate reference to missing blob removed", slog.String("id", id),
+				slog.Time("timestamp", timestamp), slog.String("hash", hash), slog.Any("error", err))
+			return os.Remove(path)
+		}
+		// reference is kept, as blob may be readable again later, and load
+		// is aborted, otherwise its blob would be removed as unreferenced
+		if err != nil {
+			return err
+		}
+		refs[id] = append(refs[id], casRef{timestamp: timestamp, hash: hash, size: uint64(info.Size())})
+		blobs[hash]++
+		return nil
+	})
+	if err == nil {
+		err = filepath.WalkDir(ca.path+casBlobsDir, func(path string, entry iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.Type().IsRegular() || blobs[entry.Name()] > 0 {
+				return nil
+			}
+			slog.Info("removing unreferenced blob", slog.String("hash", entry.Name()))
+			return os.Remove(path)
+		})
+	}
+	if err != nil {
+		slog.Error("failed to load content addressed storage", slog.String("path", ca.path),
+			slog.Any("error", err))
+		return err
+	}
+	for _, versions := range refs {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].timestamp.Before(versions[j].timestamp)
+		})
+	}
+	ca.refs = refs
+	ca.blobs = blobs
+	return nil
+}
+
+// Walk calls fn for the latest version of each stored certificate
+func (ca *ContentAddressed) Walk(fn func(id string, timestamp time.Time) error) error {
+	ca.mu.Lock()
+	refs := make(map[string]time.Time, len(ca.refs))
+	for id := range ca.refs {
+		ref, _ := ca.latest(id)
+		refs[id] = ref.timestamp
+	}
+	ca.mu.Unlock()
+	for id, timestamp := range refs {
+		if err := fn(id, timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List return the latest versions of stored certificates with their original
+// sizes
+func (ca *ContentAddressed) List() ([]Object, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	objects := make([]Object, 0, len(ca.refs))
+	for id := range ca.refs {
+		ref, _ := ca.latest(id)
+		objects = append(objects, Object{ID: id, Timestamp: ref.timestamp, Size: ref.size})
+	}
+	return objects, nil
+}
+
+// Stats describes the latest versions of stored certificates, Bytes is a size
+// of deduplicated blobs of all versions, which is actually used on disk
+func (ca *ContentAddressed) Stats() Stats {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	var stats Stats
+	blobs := make(map[string]uint64, len(ca.blobs))
+	for id, refs := range ca.refs {
+		ref, _ := ca.latest(id)
+		stats.add(Object{ID: id, Timestamp: ref.timestamp})
+		for _, ref := range refs {
+			blobs[ref.hash] = ref.size
+		}
+	}
+	for _, size := range blobs {
+		stats.Bytes += size
+	}
+	stats.Hits = ca.hits.Load()
+	stats.Misses = ca.misses.Load()
+	return stats
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentAddressedImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Storage)(nil), &ContentAddressed{})
+	assert.Implements(t, (*VersionedStorage)(nil), &ContentAddressed{})
+}
+
+func testHash(cert []byte) string {
+	sum := sha256.Sum256(cert)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestContentAddressedAdd(t *testing.T) {
+	t.Run("identical certificates stored as single blob", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+
+		err = ca.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = ca.Add("00000001", cert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		assert.FileExists(t, ca.blobLink(testHash(cert)))
+		assert.Equal(t, map[string]uint64{testHash(cert): 2}, ca.blobs)
+		assert.FileExists(t, ca.refLink("00000000", timestamp))
+		assert.FileExists(t, ca.refLink("00000001", timestamp.Add(time.Hour)))
+	})
+	t.Run("newer certificate stored as new version, previous version kept", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		newer := []byte("Newer certificate")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+
+		err = ca.Add(id, newer, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		assert.FileExists(t, ca.blobLink(testHash(cert)))
+		assert.FileExists(t, ca.refLink(id, timestamp))
+		assert.FileExists(t, ca.blobLink(testHash(newer)))
+		assert.FileExists(t, ca.refLink(id, timestamp.Add(time.Hour)))
+		got, err := ca.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, newer, got)
+		got, err = ca.GetVersion(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, cert, got)
+	})
+	t.Run("re-rendered identical certificate reuses the same blob", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+
+		err = ca.Add(id, cert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		assert.FileExists(t, ca.blobLink(testHash(cert)))
+		assert.Equal(t, map[string]uint64{testHash(cert): 2}, ca.blobs)
+		assert.FileExists(t, ca.refLink(id, timestamp))
+		assert.FileExists(t, ca.refLink(id, timestamp.Add(time.Hour)))
+	})
+	t.Run("certificate with older timestamp should not be stored", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, exp, timestamp)
+		require.NoError(t, err)
+
+		err = ca.Add(id, []byte("Older certificate"), timestamp.Add(-time.Hour))
+		require.NoError(t, err)
+
+		got, err := ca.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+}
+
+func TestContentAddressedGet(t *testing.T) {
+	t.Run("return stored certificate for same or older timestamp", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, exp, timestamp)
+		require.NoError(t, err)
+
+		got, err := ca.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+
+		got, err = ca.Get(id, timestamp.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+	t.Run("return not found error if requested timestamp is newer than stored", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, []byte("Hello, world!"), timestamp)
+		require.NoError(t, err)
+
+		got, err := ca.Get(id, timestamp.Add(time.Hour))
+
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+		assert.Empty(t, got)
+		assert.False(t, ca.Exists(id, timestamp.Add(time.Hour)))
+	})
+}
+
+func TestContentAddressedVersions(t *testing.T) {
+	t.Run("list all versions from the oldest to the latest", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		ca, err := NewContentAddressed(testDir(t))
+		require.NoError(t, err)
+		for i, ts := range timestamps {
+			err = ca.Add(id, []byte(strconv.Itoa(i)), ts)
+			require.NoError(t, err)
+		}
+
+		got, err := ca.ListVersions(id)
+
+		require.NoError(t, err)
+		assert.Equal(t, timestamps, got)
+		for i, ts := range timestamps {
+			cert, err := ca.GetVersion(id, ts)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(strconv.Itoa(i)), cert)
+		}
+	})
+	t.Run("return not found error for missing version", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(testDir(t))
+		require.NoError(t, err)
+
+		_, err = ca.ListVersions(id)
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+
+		err = ca.Add(id, []byte("Hello, world!"), timestamp)
+		require.NoError(t, err)
+
+		_, err = ca.GetVersion(id, timestamp.Add(-time.Hour))
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+	})
+	t.Run("replace releases blob of replaced version only", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		replaced := []byte("Replaced certificate")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(testDir(t))
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		err = ca.Replace(id, replaced, timestamp)
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]uint64{testHash(cert): 1, testHash(replaced): 1}, ca.blobs)
+		got, err := ca.GetVersion(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, replaced, got)
+	})
+}
+
+func TestContentAddressedDelete(t *testing.T) {
+	t.Run("blob removed only after last reference deleted", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = ca.Add("00000001", cert, timestamp)
+		require.NoError(t, err)
+
+		ca.Delete("00000000")
+
+		assert.False(t, ca.Exists("00000000", timestamp))
+		assert.NoFileExists(t, ca.refLink("00000000", timestamp))
+		assert.FileExists(t, ca.blobLink(testHash(cert)))
+
+		ca.Delete("00000001")
+
+		assert.NoFileExists(t, ca.blobLink(testHash(cert)))
+		assert.Empty(t, ca.blobs)
+	})
+	t.Run("delete releases blobs of all versions", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		newer := []byte("Newer certificate")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		err = ca.Add(id, newer, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		ca.Delete(id)
+
+		assert.Empty(t, ca.blobs)
+		assert.NoFileExists(t, ca.blobLink(testHash(cert)))
+		assert.NoFileExists(t, ca.blobLink(testHash(newer)))
+		assert.NoFileExists(t, ca.refLink(id, timestamp))
+		assert.NoFileExists(t, ca.refLink(id, timestamp.Add(time.Hour)))
+	})
+}
+
+func TestContentAddressedLoad(t *testing.T) {
+	t.Run("restore references and counters, remove unreferenced blobs", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		writeCa, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = writeCa.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = writeCa.Add("00000001", cert, timestamp)
+		require.NoError(t, err)
+		orphan := []byte("orphan")
+		err = writeFileAtomic(writeCa.blobLink(testHash(orphan)), orphan)
+		require.NoError(t, err)
+
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Load()
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]uint64{testHash(cert): 2}, ca.blobs)
+		assert.NoFileExists(t, ca.blobLink(testHash(orphan)))
+		got, err := ca.Get("00000001", timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, cert, got)
+	})
+	t.Run("restore all versions of each certificate", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		writeCa, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = writeCa.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		err = writeCa.Add(id, cert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Load()
+
+		require.NoError(t, err)
+		assert.FileExists(t, ca.refLink(id, timestamp))
+		assert.Equal(t, map[string]uint64{testHash(cert): 2}, ca.blobs)
+		assert.True(t, ca.Exists(id, timestamp.Add(time.Hour)))
+		got, err := ca.ListVersions(id)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.True(t, timestamp.Equal(got[0]))
+		assert.True(t, timestamp.Add(time.Hour).Equal(got[1]))
+	})
+	t.Run("reference kept if blob can't be checked", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		// blob directory replaced with file, so stat of blob fails with error
+		// other than not exist
+		dir := filepath.Dir(ca.blobLink(testHash(cert)))
+		require.NoError(t, os.RemoveAll(dir))
+		require.NoError(t, os.WriteFile(dir, nil, 0666))
+
+		err = ca.Load()
+
+		assert.Error(t, err)
+		assert.FileExists(t, ca.refLink(id, timestamp))
+	})
+	t.Run("reference to missing blob removed", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(ca.blobLink(testHash(cert))))
+
+		err = ca.Load()
+
+		require.NoError(t, err)
+		assert.NoFileExists(t, ca.refLink(id, timestamp))
+		assert.False(t, ca.Exists(id, timestamp))
+	})
+	t.Run("malformed references skipped", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(path)
+		require.NoError(t, err)
+		err = ca.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		for i, content := range []string{"", "abc", strings.Repeat("z", 64), strings.ToUpper(testHash(cert))} {
+			err = os.WriteFile(ca.refLink(strconv.Itoa(i), timestamp), []byte(content), 0666)
+			require.NoError(t, err)
+		}
+
+		err = ca.Load()
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]uint64{testHash(cert): 1}, ca.blobs)
+		assert.True(t, ca.Exists("00000000", timestamp))
+		assert.False(t, ca.Exists("0", timestamp))
+	})
+}
+
+func TestContentAddressedStats(t *testing.T) {
+	t.Run("bytes count deduplicated blobs", func(t *testing.T) {
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		ca, err := NewContentAddressed(testDir(t))
+		require.NoError(t, err)
+		err = ca.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = ca.Add("00000001", cert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		objects, err := ca.List()
+		stats := ca.Stats()
+
+		require.NoError(t, err)
+		assert.Len(t, objects, 2)
+		for _, obj := range objects {
+			assert.Equal(t, uint64(len(cert)), obj.Size)
+		}
+		assert.Equal(t, uint64(2), stats.Objects)
+		assert.Equal(t, uint64(len(cert)), stats.Bytes)
+		assert.True(t, timestamp.Equal(stats.Oldest))
+		assert.True(t, timestamp.Add(time.Hour).Equal(stats.Newest))
+	})
+}
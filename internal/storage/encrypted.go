@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// EncryptedStorage encrypts certificates with AES-GCM before passing them to
+// underlying storage, optionally compressing them first. Each encrypted file
+// has a header with id of the key used, so keys can be rotated.
+type EncryptedStorage struct {
+	Storage
+	keys     map[string]cipher.AEAD
+	keyID    string
+	compress bool
+}
+
+// encrypted file format:
+// magic | version | flags | key id length | key id | nonce | ciphertext
+var encMagic = []byte("PCE")
+
+const (
+	encVersion      byte = 1
+	encFlagCompress byte = 1 << 0
+)
+
+var (
+	UnknownKeyError           = errors.New("unknown encryption key")
+	InvalidEncryptedFileError = errors.New("invalid encrypted certificate file")
+)
+
+func NewEncryptedStorage(storage Storage, keys map[string][]byte, keyID string, compress bool) (*EncryptedStorage, error) {
+	if _, ok := keys[keyID]; !ok {
+		err := fmt.Errorf("%w: %s", UnknownKeyError, keyID)
+		slog.Error("failed to initialize encrypted storage", slog.String("keyID", keyID), slog.Any("error", err))
+		return nil, err
+	}
+	es := &EncryptedStorage{
+		Storage:  storage,
+		keys:     make(map[string]cipher.AEAD, len(keys)),
+		keyID:    keyID,
+		compress: compress,
+	}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			err := fmt.Errorf("key id length should be in range [1, 255]: %q", id)
+			slog.Error("failed to initialize encrypted storage", slog.String("keyID", id), slog.Any("error", err))
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			slog.Error("failed to initialize encrypted storage", slog.String("keyID", id), slog.Any("error", err))
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			slog.Error("failed to initialize encrypted storage", slog.String("keyID", id), slog.Any("error", err))
+			return nil, err
+		}
+		es.keys[id] = aead
+	}
+	return es, nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encMagic)
+}
+
+func (es *EncryptedStorage) encrypt(id string, cert []byte) ([]byte, error) {
+	var flags byte
+	if es.compress {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		_, err := zw.Write(cert)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		cert = buf.Bytes()
+		flags |= encFlagCompress
+	}
+	aead := es.keys[es.keyID]
+	header := append([]byte{}, encMagic...)
+	header = append(header, encVersion, flags, byte(len(es.keyID)))
+	header = append(header, es.keyID...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// header and certificate id are authenticated, so encrypted file can't be
+	// tampered with or served for another certificate
+	aad := append(append([]byte{}, header...), id...)
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, cert, aad), nil
+}
+
+func parseHeader(data []byte) (header []byte, flags byte, keyID string, err error) {
+	n := len(encMagic)
+	if len(data) < n+3 || data[n] != encVersion {
+		err = InvalidEncryptedFileError
+		return
+	}
+	flags = data[n+1]
+	l := int(data[n+2])
+	if len(data) < n+3+l {
+		err = InvalidEncryptedFileError
+		return
+	}
+	keyID = string(data[n+3 : n+3+l])
+	header = data[:n+3+l]
+	return
+}
+
+func (es *EncryptedStorage) decrypt(id string, data []byte) ([]byte, error) {
+	header, flags, keyID, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := es.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", UnknownKeyError, keyID)
+	}
+	rest := data[len(header):]
+	if len(rest) < aead.NonceSize() {
+		return nil, InvalidEncryptedFileError
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	aad := append(append([]byte{}, header...), id...)
+	cert, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	if flags&encFlagCompress != 0 {
+		zr, err := gzip.NewReader(bytes.NewReader(cert))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return cert, nil
+}
+
+func (es *EncryptedStorage) Add(id string, cert []byte, timestamp time.Time) error {
+	data, err := es.encrypt(id, cert)
+	if err != nil {
+		slog.Error("failed to encrypt certificate", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return err
+	}
+	return es.Storage.Add(id, data, timestamp)
+}
+
+func (es *EncryptedStorage) Get(id string, timestamp time.Time) (cert []byte, err error) {
+	data, err := es.Storage.Get(id, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return es.open(id, timestamp, data)
+}
+
+// ListVersions return versions of certificate kept by underlying storage
+func (es *EncryptedStorage) ListVersions(id string) ([]time.Time, error) {
+	vs, err := versioned(es.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(id)
+}
+
+// GetVersion return decrypted version of certificate kept by underlying
+// storage
+func (es *EncryptedStorage) GetVersion(id string, timestamp time.Time) ([]byte, error) {
+	vs, err := versioned(es.Storage)
+	if err != nil {
+		return nil, err
+	}
+	data, err := vs.GetVersion(id, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return es.open(id, timestamp, data)
+}
+
+// open decrypts stored data, plain unencrypted data is returned as is
+func (es *EncryptedStorage) open(id string, timestamp time.Time, data []byte) (cert []byte, err error) {
+	if !isEncrypted(data) {
+		slog.Warn("stored certificate is not encrypted", slog.String("id", id), slog.Time("timestamp", timestamp))
+		return data, nil
+	}
+	cert, err = es.decrypt(id, data)
+	if err != nil {
+		slog.Error("failed to decrypt certificate", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Rotate re-encrypts all stored certificates which are not encrypted with
+// current key and compression settings, including plain unencrypted files and
+// previous versions if underlying storage keeps them. Underlying storage
+// should implement Replacer, able to replace previous versions as well.
+func (es *EncryptedStorage) Rotate() (rotated int, err error) {
+	r, ok := es.Storage.(Replacer)
+	if !ok {
+		err = fmt.Errorf("underlying storage doesn't support rotation: %T", es.Storage)
+		slog.Error("failed to rotate encryption key", slog.Any("error", err))
+		return
+	}
+	vs, versioned := es.Storage.(VersionedStorage)
+	rotate := func(id string, timestamp time.Time, data []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		ok, err := es.rotate(r, id, data, timestamp)
+		if ok {
+			rotated++
+		}
+		return err
+	}
+	err = es.Storage.Walk(func(id string, timestamp time.Time) error {
+		if !versioned {
+			data, err := es.Storage.Get(id, timestamp)
+			return rotate(id, timestamp, data, err)
+		}
+		timestamps, err := vs.ListVersions(id)
+		if err != nil {
+			return err
+		}
+		for _, ts := range timestamps {
+			data, err := vs.GetVersion(id, ts)
+			if err := rotate(id, ts, data, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to rotate encryption key", slog.String("keyID", es.keyID),
+			slog.Int("rotated", rotated), slog.Any("error", err))
+	}
+	return
+}
+
+// rotate replaces stored data with data encrypted by current key, reporting
+// whether it was replaced
+func (es *EncryptedStorage) rotate(r Replacer, id string, data []byte, timestamp time.Time) (bool, error) {
+	cert := data
+	if isEncrypted(data) {
+		_, flags, keyID, err := parseHeader(data)
+		if err != nil {
+			return false, err
+		}
+		if keyID == es.keyID && (flags&encFlagCompress != 0) == es.compress {
+			return false, nil
+		}
+		cert, err = es.decrypt(id, data)
+		if err != nil {
+			return false, err
+		}
+	}
+	data, err := es.encrypt(id, cert)
+	if err != nil {
+		return false, err
+	}
+	if err := r.Replace(id, data, timestamp); err != nil {
+		return false, err
+	}
+	return true, nil
+}
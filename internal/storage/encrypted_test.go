@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptedStorageImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Storage)(nil), &EncryptedStorage{})
+	assert.Implements(t, (*VersionedStorage)(nil), &EncryptedStorage{})
+}
+
+func TestNewEncryptedStorage(t *testing.T) {
+	t.Run("current key should be present in keys", func(t *testing.T) {
+		m := NewMockStorage(t)
+
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k2", false)
+
+		assert.ErrorIs(t, err, UnknownKeyError)
+		assert.Nil(t, es)
+	})
+	t.Run("invalid key size not accepted", func(t *testing.T) {
+		m := NewMockStorage(t)
+
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": []byte("short")}, "k1", false)
+
+		assert.Error(t, err)
+		assert.Nil(t, es)
+	})
+}
+
+func TestEncryptedStorageAddGet(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run("stored certificate is encrypted and decrypted on get", func(t *testing.T) {
+			id := "00000000"
+			exp := []byte("Hello, world! Hello, world! Hello, world!")
+			timestamp := time.Now()
+			m := NewMockStorage(t)
+			es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", compress)
+			require.NoError(t, err)
+			var stored []byte
+			m.EXPECT().Add(id, mock.Anything, timestamp).Run(func(_ string, cert []byte, _ time.Time) {
+				stored = cert
+			}).Return(nil).Once()
+
+			err = es.Add(id, exp, timestamp)
+			require.NoError(t, err)
+
+			assert.True(t, isEncrypted(stored))
+			assert.NotContains(t, string(stored), "Hello")
+
+			m.EXPECT().Get(id, timestamp).Return(stored, nil).Once()
+			got, err := es.Get(id, timestamp)
+
+			require.NoError(t, err)
+			assert.Equal(t, exp, got)
+		})
+	}
+	t.Run("encrypted certificate can't be decrypted for another id", func(t *testing.T) {
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+		stored, err := es.encrypt("00000000", cert)
+		require.NoError(t, err)
+
+		m.EXPECT().Get("00000001", timestamp).Return(stored, nil).Once()
+		got, err := es.Get("00000001", timestamp)
+
+		assert.Error(t, err)
+		assert.Empty(t, got)
+	})
+	t.Run("certificate encrypted with unknown key can't be decrypted", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		old, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+		stored, err := old.encrypt(id, cert)
+		require.NoError(t, err)
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k2": testKey(2)}, "k2", false)
+		require.NoError(t, err)
+
+		m.EXPECT().Get(id, timestamp).Return(stored, nil).Once()
+		got, err := es.Get(id, timestamp)
+
+		assert.ErrorIs(t, err, UnknownKeyError)
+		assert.Empty(t, got)
+	})
+	t.Run("unencrypted certificate returned as is", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("%PDF-1.7")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+
+		m.EXPECT().Get(id, timestamp).Return(exp, nil).Once()
+		got, err := es.Get(id, timestamp)
+
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+}
+
+func TestEncryptedStorageRotate(t *testing.T) {
+	t.Run("re-encrypt stored certificates with current key", func(t *testing.T) {
+		path := testDir(t)
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		timestamp := time.Now()
+		old, err := NewEncryptedStorage(fs, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+		err = old.Add("00000000", []byte("encrypted"), timestamp)
+		require.NoError(t, err)
+		err = fs.Add("00000001", []byte("plain"), timestamp)
+		require.NoError(t, err)
+		rotating, err := NewEncryptedStorage(fs, map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", true)
+		require.NoError(t, err)
+
+		rotated, err := rotating.Rotate()
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, rotated)
+		es, err := NewEncryptedStorage(fs, map[string][]byte{"k2": testKey(2)}, "k2", true)
+		require.NoError(t, err)
+		got, err := es.Get("00000000", timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("encrypted"), got)
+		got, err = es.Get("00000001", timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("plain"), got)
+
+		rotated, err = es.Rotate()
+
+		require.NoError(t, err)
+		assert.Zero(t, rotated)
+	})
+	t.Run("re-encrypt previous versions with current key", func(t *testing.T) {
+		id := "00000000"
+		fs, err := NewFileSystemWithConfig(testDir(t), FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		old, err := NewEncryptedStorage(fs, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+		for i, ts := range timestamps {
+			err = old.Add(id, []byte(fmt.Sprintf("version %d", i)), ts)
+			require.NoError(t, err)
+		}
+		rotating, err := NewEncryptedStorage(fs, map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", false)
+		require.NoError(t, err)
+
+		rotated, err := rotating.Rotate()
+
+		require.NoError(t, err)
+		assert.Equal(t, len(timestamps), rotated)
+		es, err := NewEncryptedStorage(fs, map[string][]byte{"k2": testKey(2)}, "k2", false)
+		require.NoError(t, err)
+		got, err := es.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, timestamps, got)
+		for i, ts := range timestamps {
+			cert, err := es.GetVersion(id, ts)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("version %d", i)), cert)
+		}
+	})
+	t.Run("underlying storage without walk and replace can't be rotated", func(t *testing.T) {
+		m := NewMockStorage(t)
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+
+		_, err = es.Rotate()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestEncryptedStorageVersions(t *testing.T) {
+	t.Run("previous versions decrypted", func(t *testing.T) {
+		id := "00000000"
+		fs, err := NewFileSystemWithConfig(testDir(t), FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		es, err := NewEncryptedStorage(fs, map[string][]byte{"k1": testKey(1)}, "k1", true)
+		require.NoError(t, err)
+		timestamp := time.Now()
+		err = es.Add(id, []byte("first"), timestamp)
+		require.NoError(t, err)
+		err = es.Add(id, []byte("second"), timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		got, err := es.GetVersion(id, timestamp)
+
+		require.NoError(t, err)
+		assert.Equal(t, []byte("first"), got)
+		stored, err := fs.GetVersion(id, timestamp)
+		require.NoError(t, err)
+		assert.NotEqual(t, []byte("first"), stored)
+	})
+	t.Run("underlying storage without versions rejected", func(t *testing.T) {
+		m := NewMockStorage(t)
+		es, err := NewEncryptedStorage(m, map[string][]byte{"k1": testKey(1)}, "k1", false)
+		require.NoError(t, err)
+
+		_, err = es.ListVersions("00000000")
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+		_, err = es.GetVersion("00000000", time.Now())
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+	})
+}
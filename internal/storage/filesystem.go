@@ -1,33 +1,96 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	iofs "io/fs"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/eklmv/pdfcertificates/internal/cache"
 )
 
 type FileSystem struct {
-	c    cache.Cache[uint32, fsCertLink]
-	path string
+	c cache.Cache[string, fsCertLink]
+	j *janitor
+	// links of index entries being replaced, their files are kept on eviction
+	keep sync.Map
+	// previous versions of certificates, from oldest to newest, and their
+	// total size
+	versions map[string][]fsCertLink
+	vbytes   uint64
+	vmu      sync.Mutex
+	cfg      FileSystemConfig
+	path     string
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+// FileSystemConfig describes limits applied to stored certificate files,
+// zero value means no limits. Unless version history is enabled only the
+// latest version of each certificate is kept, older versions are removed as
+// soon as newer one stored.
+type FileSystemConfig struct {
+	// Quota is a maximum total size of stored files in bytes, including
+	// previous versions, the oldest previous versions and then least recently
+	// served files are removed to fit new ones
+	Quota uint64
+	// MaxIdle is a maximum duration since last access before file is removed
+	MaxIdle time.Duration
+	// Layout of files inside storage directory, Load supports any layout
+	Layout Layout
+	// Versions is a retention of previous versions of each certificate
+	Versions VersionRetention
 }
 
 type fsCertLink struct {
+	id        string
 	link      string
 	timestamp time.Time
 	size      uint64
+	// unix nano time of last access, shared between copies of the link
+	accessed *atomic.Int64
+}
+
+func newFsCertLink(id string, link string, timestamp time.Time, size uint64, accessed time.Time) fsCertLink {
+	cl := fsCertLink{
+		id:        id,
+		link:      link,
+		timestamp: timestamp,
+		size:      size,
+		accessed:  new(atomic.Int64),
+	}
+	cl.accessed.Store(accessed.UnixNano())
+	return cl
+}
+
+func (cl fsCertLink) touch(t time.Time) {
+	cl.accessed.Store(t.UnixNano())
+}
+
+func (cl fsCertLink) lastAccess() time.Time {
+	return time.Unix(0, cl.accessed.Load())
 }
 
 func (cu fsCertLink) Size() uint64 {
 	return cu.size
 }
 
+var QuotaExceededError = errors.New("certificate file exceeds storage quota")
+
 func NewFileSystem(absPath string) (*FileSystem, error) {
+	return NewFileSystemWithConfig(absPath, FileSystemConfig{})
+}
+
+func NewFileSystemWithConfig(absPath string, cfg FileSystemConfig) (*FileSystem, error) {
 	absPath = fsEnsureTrailingSlash(absPath)
 	_, err := os.Stat(absPath)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -43,7 +106,12 @@ func NewFileSystem(absPath string) (*FileSystem, error) {
 			slog.String("absPath", absPath), slog.Any("error", err))
 		return nil, err
 	}
-	fs := &FileSystem{path: absPath}
+	fs := &FileSystem{
+		path:     absPath,
+		j:        newJanitor(),
+		versions: make(map[string][]fsCertLink),
+		cfg:      cfg,
+	}
 	fs.initCache()
 	return fs, nil
 }
@@ -57,12 +125,99 @@ func fsEnsureTrailingSlash(path string) string {
 }
 
 func (fs *FileSystem) initCache() {
-	fs.c = cache.NewSafeCache(cache.NewLRUCacheWithEviction[uint32, fsCertLink](0, fsOnEviction))
+	fs.c = cache.NewSafeCache(cache.NewLRUCacheWithEviction[string, fsCertLink](fs.cfg.Quota, fs.onEviction))
 }
 
-// TODO: replace naive single attempt with retry system
-func fsOnEviction(_ uint32, value fsCertLink) {
-	_ = os.Remove(value.link)
+func (fs *FileSystem) onEviction(_ string, value fsCertLink) {
+	if _, ok := fs.keep.Load(value.link); ok {
+		return
+	}
+	fs.j.tryRemove(value.link)
+}
+
+// StartJanitor runs background retries of failed file removals and periodic
+// reconciliation of storage directory against index with retention rules
+// applied, until ctx is done
+func (fs *FileSystem) StartJanitor(ctx context.Context, retryInterval time.Duration, reconcileInterval time.Duration) {
+	go func() {
+		retry := time.NewTicker(retryInterval)
+		defer retry.Stop()
+		reconcile := time.NewTicker(reconcileInterval)
+		defer reconcile.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry.C:
+				fs.j.retry()
+			case <-reconcile.C:
+				fs.ApplyRetention()
+				_ = fs.Reconcile()
+			}
+		}
+	}()
+}
+
+// Reconcile removes certificate files which are not present in index
+func (fs *FileSystem) Reconcile() error {
+	live := make(map[string]struct{})
+	for _, cl := range append(fs.c.Values(), fs.versionLinks()...) {
+		live[cl.link] = struct{}{}
+	}
+	threshold := fs.j.timeNow().Add(-janitorOrphanGrace)
+	err := fs.walkFiles(func(link string, entry iofs.DirEntry) error {
+		if _, ok := live[link]; ok {
+			return nil
+		}
+		if _, _, err := fromFileName(entry.Name()); err != nil {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(threshold) {
+			return nil
+		}
+		slog.Info("removing orphaned certificate file", slog.String("link", link))
+		fs.j.tryRemove(link)
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to reconcile file system storage", slog.String("path", fs.path),
+			slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// ApplyRetention removes files which were not accessed longer than allowed
+// and previous versions exceeding version retention
+func (fs *FileSystem) ApplyRetention() {
+	fs.vmu.Lock()
+	for id := range fs.versions {
+		fs.pruneVersions(id)
+	}
+	fs.vmu.Unlock()
+	if fs.cfg.MaxIdle == 0 {
+		return
+	}
+	threshold := fs.j.timeNow().Add(-fs.cfg.MaxIdle)
+	for _, id := range fs.c.Keys() {
+		cl, ok := fs.c.Peek(id)
+		if ok && cl.lastAccess().Before(threshold) {
+			slog.Info("removing certificate file by retention policy", slog.String("link", cl.link),
+				slog.Time("last access", cl.lastAccess()))
+			fs.c.Remove(id)
+		}
+	}
+}
+
+// PendingDeletions return amount of files waiting for removal retry
+func (fs *FileSystem) PendingDeletions() uint64 {
+	return fs.j.pendingLen()
+}
+
+// FailedDeletions return amount of files which exceeded removal retry limit
+func (fs *FileSystem) FailedDeletions() uint64 {
+	return fs.j.failedLen()
 }
 
 func toFileName(id string, timestamp time.Time) string {
@@ -92,43 +247,50 @@ func fromFileName(fileName string) (id string, timestamp time.Time, err error) {
 }
 
 func (fs *FileSystem) Add(id string, cert []byte, timestamp time.Time) error {
-	hash := cache.HashString(id)
-	cl, ok := fs.c.Peek(hash)
+	cl, ok := fs.c.Peek(id)
 	if ok && (cl.timestamp.Equal(timestamp) || cl.timestamp.After(timestamp)) {
 		slog.Info("same or newer certificate already stored", slog.String("id", id),
 			slog.Time("requested timestamp", timestamp), slog.Time("stored timestamp", cl.timestamp))
 		return nil
 	}
-	link := fs.path + toFileName(id, timestamp)
-	err := os.WriteFile(link, cert, 0666)
+	if fs.cfg.Quota != 0 && uint64(len(cert)) > fs.cfg.Quota {
+		err := QuotaExceededError
+		slog.Error("failed to store certificate file", slog.String("id", id), slog.Time("timestamp", timestamp),
+			slog.Int("size", len(cert)), slog.Uint64("quota", fs.cfg.Quota), slog.Any("error", err))
+		return err
+	}
+	link := fs.toLink(id, timestamp)
+	fs.j.cancel(link)
+	err := os.MkdirAll(filepath.Dir(link), 0777)
+	if err == nil {
+		err = os.WriteFile(link, cert, 0666)
+	}
 	if err != nil {
 		slog.Info("failed to store certificate file", slog.String("id", id), slog.Any("cert", cert),
 			slog.Time("timestamp", timestamp), slog.Any("error", err))
 		return err
 	}
-	cl = fsCertLink{
-		link:      link,
-		timestamp: timestamp,
-	}
-	cl.size = cache.SizeOf(cl)
-	fs.c.Add(hash, cl)
+	fs.index(id, newFsCertLink(id, link, timestamp, uint64(len(cert)), fs.j.timeNow()))
 	return err
 }
 
 func (fs *FileSystem) Get(id string, timestamp time.Time) (cert []byte, err error) {
-	hash := cache.HashString(id)
-	cl, ok := fs.c.Peek(hash)
+	cl, ok := fs.c.Peek(id)
 	if ok && (cl.timestamp.Equal(timestamp) || cl.timestamp.After(timestamp)) {
 		cert, err := os.ReadFile(cl.link)
 		if err != nil {
 			slog.Error("failed to read certificate file", slog.String("id", id),
 				slog.Time("requested timestamp", timestamp), slog.Time("stored timestamp", cl.timestamp),
 				slog.String("link", cl.link), slog.Any("error", err))
+			fs.misses.Add(1)
 			return nil, err
 		}
-		fs.c.Touch(hash)
+		cl.touch(fs.j.timeNow())
+		fs.c.Touch(id)
+		fs.hits.Add(1)
 		return cert, nil
 	}
+	fs.misses.Add(1)
 	err = CertificateFileNotFoundError
 	slog.Error("requested certificate not found", slog.String("id", id),
 		slog.Time("timestamp", timestamp), slog.Any("error", err))
@@ -136,16 +298,15 @@ func (fs *FileSystem) Get(id string, timestamp time.Time) (cert []byte, err erro
 }
 
 func (fs *FileSystem) Delete(id string) {
-	hash := cache.HashString(id)
-	_, ok := fs.c.Peek(hash)
+	_, ok := fs.c.Peek(id)
 	if ok {
-		fs.c.Remove(hash)
+		fs.c.Remove(id)
 	}
+	fs.removeVersions(id)
 }
 
 func (fs *FileSystem) Exists(id string, timestamp time.Time) bool {
-	hash := cache.HashString(id)
-	cl, ok := fs.c.Peek(hash)
+	cl, ok := fs.c.Peek(id)
 	if ok && (cl.timestamp.Equal(timestamp) || cl.timestamp.After(timestamp)) {
 		return true
 	}
@@ -153,34 +314,114 @@ func (fs *FileSystem) Exists(id string, timestamp time.Time) bool {
 }
 
 func (fs *FileSystem) Load() error {
-	list, err := os.ReadDir(fs.path)
+	type loaded struct {
+		id        string
+		timestamp time.Time
+		link      string
+		size      uint64
+		modTime   time.Time
+	}
+	var files []loaded
+	err := fs.walkFiles(func(link string, entry iofs.DirEntry) error {
+		id, timestamp, err := fromFileName(entry.Name())
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, loaded{
+			id:        id,
+			timestamp: timestamp,
+			link:      link,
+			size:      uint64(info.Size()),
+			modTime:   info.ModTime(),
+		})
+		return nil
+	})
 	if err != nil {
 		slog.Error("failed to load file system storage", slog.String("path", fs.path),
 			slog.Any("error", err))
 		return err
 	}
-	for _, entry := range list {
-		if entry.Type().IsRegular() {
-			id, timestamp, err := fromFileName(entry.Name())
-			if err != nil {
-				slog.Error("failed to load file system storage", slog.String("path", fs.path),
-					slog.Any("error", err))
-				return err
-			}
-			info, err := entry.Info()
-			if err != nil {
-				slog.Error("failed to load file system storage", slog.String("path", fs.path),
-					slog.Any("error", err))
-				return err
+	// oldest files added first, so they are evicted first if quota exceeded
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		fs.j.cancel(f.link)
+		cl := newFsCertLink(f.id, f.link, f.timestamp, f.size, f.modTime)
+		stored, ok := fs.c.Peek(f.id)
+		// indexed file itself, found again if it was added or loaded before
+		if ok && (stored.link == f.link || stored.timestamp.Equal(f.timestamp)) {
+			continue
+		}
+		if ok && stored.timestamp.After(f.timestamp) {
+			if fs.cfg.Versions.enabled() {
+				fs.addVersion(f.id, cl)
+				fs.fitQuota()
+			} else {
+				fs.j.tryRemove(f.link)
 			}
-			size := uint64(info.Size())
-			hash := cache.HashString(id)
-			fs.c.Add(hash, fsCertLink{
-				link:      fs.path + entry.Name(),
-				timestamp: timestamp,
-				size:      size,
-			})
+			continue
 		}
+		fs.index(f.id, cl)
 	}
 	return nil
 }
+
+// Replace atomically overwrites content of stored certificate file with the
+// same id and timestamp, either the latest or previous version
+func (fs *FileSystem) Replace(id string, cert []byte, timestamp time.Time) error {
+	cl, ok := fs.c.Peek(id)
+	if !ok || !cl.timestamp.Equal(timestamp) {
+		return fs.replaceVersion(id, cert, timestamp)
+	}
+	err := writeFileAtomic(cl.link, cert)
+	if err != nil {
+		slog.Error("failed to replace certificate file", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return err
+	}
+	replaced := cl
+	replaced.size = uint64(len(cert))
+	fs.keep.Store(cl.link, struct{}{})
+	fs.c.Add(id, replaced)
+	fs.keep.Delete(cl.link)
+	fs.fitQuota()
+	return nil
+}
+
+// Walk calls fn for each stored certificate, from least to most recently used
+func (fs *FileSystem) Walk(fn func(id string, timestamp time.Time) error) error {
+	for _, cl := range fs.c.Values() {
+		if err := fn(cl.id, cl.timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List return the latest versions of stored certificates, from least to most
+// recently used
+func (fs *FileSystem) List() ([]Object, error) {
+	values := fs.c.Values()
+	objects := make([]Object, 0, len(values))
+	for _, cl := range values {
+		objects = append(objects, Object{ID: cl.id, Timestamp: cl.timestamp, Size: cl.size})
+	}
+	return objects, nil
+}
+
+// Stats describes all stored certificate files, including previous versions,
+// same as for quota
+func (fs *FileSystem) Stats() Stats {
+	var stats Stats
+	for _, cl := range append(fs.c.Values(), fs.versionLinks()...) {
+		stats.add(Object{ID: cl.id, Timestamp: cl.timestamp, Size: cl.size})
+	}
+	stats.Hits = fs.hits.Load()
+	stats.Misses = fs.misses.Load()
+	return stats
+}
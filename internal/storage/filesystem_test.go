@@ -3,11 +3,13 @@ package storage
 import (
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/eklmv/pdfcertificates/internal/cache"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -228,4 +230,259 @@ func TestFileSystemLoad(t *testing.T) {
 		}
 		assert.Equal(t, expCerts, gotCerts)
 	})
+	t.Run("load after add keeps stored certificate", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+
+		err = fs.Load()
+
+		require.NoError(t, err)
+		got, err := fs.Get(id, timestamp)
+		assert.NoError(t, err)
+		assert.Equal(t, cert, got)
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+	})
+	t.Run("repeated load keeps stored certificate", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		writeFs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = writeFs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		require.NoError(t, fs.Load())
+
+		err = fs.Load()
+
+		require.NoError(t, err)
+		got, err := fs.Get(id, timestamp)
+		assert.NoError(t, err)
+		assert.Equal(t, cert, got)
+	})
+}
+
+func TestFileSystemQuota(t *testing.T) {
+	t.Run("least recently served certificates removed to fit quota", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Quota: uint64(len(cert) * 2)})
+		require.NoError(t, err)
+		err = fs.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = fs.Add("00000001", cert, timestamp)
+		require.NoError(t, err)
+		_, err = fs.Get("00000000", timestamp)
+		require.NoError(t, err)
+
+		err = fs.Add("00000002", cert, timestamp)
+		require.NoError(t, err)
+
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName("00000000", timestamp))
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName("00000001", timestamp))
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName("00000002", timestamp))
+		assert.Equal(t, uint64(len(cert)*2), fs.c.Size())
+	})
+	t.Run("certificate bigger than quota should not be stored", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Quota: uint64(len(cert) - 1)})
+		require.NoError(t, err)
+
+		err = fs.Add(id, cert, timestamp)
+
+		assert.ErrorIs(t, err, QuotaExceededError)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+	})
+	t.Run("loaded files exceeding quota removed starting from the oldest", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		writeFs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			id := strconv.Itoa(i)
+			err = writeFs.Add(id, cert, timestamp)
+			require.NoError(t, err)
+			mtime := timestamp.Add(time.Duration(i) * time.Minute)
+			err = os.Chtimes(fsEnsureTrailingSlash(path)+toFileName(id, timestamp), mtime, mtime)
+			require.NoError(t, err)
+		}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Quota: uint64(len(cert) * 2)})
+		require.NoError(t, err)
+
+		err = fs.Load()
+
+		require.NoError(t, err)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName("0", timestamp))
+		assert.True(t, fs.Exists("1", timestamp))
+		assert.True(t, fs.Exists("2", timestamp))
+	})
+}
+
+func TestFileSystemApplyRetention(t *testing.T) {
+	t.Run("remove certificates not accessed longer than max idle duration", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{MaxIdle: time.Hour})
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+		err = fs.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = fs.Add("00000001", cert, timestamp)
+		require.NoError(t, err)
+		clock.Advance(time.Hour / 2)
+		_, err = fs.Get("00000001", timestamp)
+		require.NoError(t, err)
+		clock.Advance(time.Hour/2 + time.Second)
+
+		fs.ApplyRetention()
+
+		assert.False(t, fs.Exists("00000000", timestamp))
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName("00000000", timestamp))
+		assert.True(t, fs.Exists("00000001", timestamp))
+	})
+}
+
+func TestFileSystemReplace(t *testing.T) {
+	t.Run("overwrite stored certificate keeping its timestamp", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		exp := []byte("replaced certificate")
+		timestamp := time.Now()
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = fs.Add(id, []byte("certificate"), timestamp)
+		require.NoError(t, err)
+
+		err = fs.Replace(id, exp, timestamp)
+
+		require.NoError(t, err)
+		got, err := fs.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+		assert.Equal(t, uint64(len(exp)), fs.c.Size())
+	})
+	t.Run("return not found error if certificate with same timestamp not stored", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = fs.Add(id, []byte("certificate"), timestamp)
+		require.NoError(t, err)
+
+		err = fs.Replace(id, []byte("replaced"), timestamp.Add(time.Hour))
+
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+	})
+}
+
+func TestFileSystemWalk(t *testing.T) {
+	t.Run("visit all stored certificates from least to most recently used", func(t *testing.T) {
+		path := testDir(t)
+		amount := 4
+		timestamp := time.Now()
+		var expIDs, gotIDs []string
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		for i := 0; i < amount; i++ {
+			id := strconv.Itoa(i)
+			expIDs = append(expIDs, id)
+			err = fs.Add(id, []byte("certificate"), timestamp)
+			require.NoError(t, err)
+		}
+
+		err = fs.Walk(func(id string, ts time.Time) error {
+			gotIDs = append(gotIDs, id)
+			assert.True(t, timestamp.Equal(ts))
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, expIDs, gotIDs)
+	})
+}
+
+func TestFileSystemListAndStats(t *testing.T) {
+	t.Run("list and describe stored certificates, count hits and misses", func(t *testing.T) {
+		path := testDir(t)
+		timestamp := time.Now()
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = fs.Add("00000000", []byte("certificate"), timestamp.Add(-time.Hour))
+		require.NoError(t, err)
+		err = fs.Add("00000001", []byte("larger certificate"), timestamp)
+		require.NoError(t, err)
+
+		_, err = fs.Get("00000000", timestamp.Add(-time.Hour))
+		require.NoError(t, err)
+		_, err = fs.Get("00000002", timestamp)
+		require.Error(t, err)
+		objects, err := fs.List()
+		stats := fs.Stats()
+
+		require.NoError(t, err)
+		assert.Equal(t, []Object{
+			{ID: "00000001", Timestamp: timestamp, Size: uint64(len("larger certificate"))},
+			{ID: "00000000", Timestamp: timestamp.Add(-time.Hour), Size: uint64(len("certificate"))},
+		}, objects)
+		assert.Equal(t, Stats{
+			Objects: 2,
+			Bytes:   uint64(len("certificate") + len("larger certificate")),
+			Oldest:  timestamp.Add(-time.Hour),
+			Newest:  timestamp,
+			Hits:    1,
+			Misses:  1,
+		}, stats)
+	})
+	t.Run("empty storage has zero stats", func(t *testing.T) {
+		fs, err := NewFileSystem(testDir(t))
+		require.NoError(t, err)
+
+		objects, err := fs.List()
+
+		require.NoError(t, err)
+		assert.Empty(t, objects)
+		assert.Equal(t, Stats{}, fs.Stats())
+	})
+}
+
+func TestFileSystemCollidingIDs(t *testing.T) {
+	t.Run("certificates with colliding hashes of ids stored separately", func(t *testing.T) {
+		// FNV-1a 32-bit hashes of ids are equal
+		first, second := "0004a0f5", "000bec20"
+		require.Equal(t, cache.HashString(first), cache.HashString(second))
+		firstCert, secondCert := []byte("first certificate"), []byte("second certificate")
+		timestamp := time.Now()
+		fs, err := NewFileSystem(testDir(t))
+		require.NoError(t, err)
+
+		err = fs.Add(first, firstCert, timestamp)
+		require.NoError(t, err)
+		err = fs.Add(second, secondCert, timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		got, err := fs.Get(first, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, firstCert, got)
+		assert.False(t, fs.Exists(second, timestamp.Add(2*time.Hour)))
+		got, err = fs.Get(second, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, secondCert, got)
+		assert.Equal(t, uint64(2), fs.Stats().Objects)
+	})
 }
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	janitorBaseBackoff = time.Second
+	janitorMaxBackoff  = 5 * time.Minute
+	janitorMaxAttempts = 10
+	// files younger than grace period are never treated as orphans, they could
+	// belong to Add which wrote file but not yet indexed it
+	janitorOrphanGrace = time.Minute
+)
+
+type janitor struct {
+	mu      sync.Mutex
+	pending map[string]*removal
+	failed  map[string]*removal
+	remove  func(name string) error
+	now     func() time.Time
+}
+
+type removal struct {
+	attempts int
+	next     time.Time
+	err      error
+}
+
+func newJanitor() *janitor {
+	return &janitor{
+		pending: make(map[string]*removal),
+		failed:  make(map[string]*removal),
+		remove:  os.Remove,
+		now:     time.Now,
+	}
+}
+
+// timeNow return current time of janitor clock, safe to use concurrently with setNow
+func (j *janitor) timeNow() time.Time {
+	j.mu.Lock()
+	now := j.now
+	j.mu.Unlock()
+	return now()
+}
+
+// setNow replaces janitor clock
+func (j *janitor) setNow(now func() time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.now = now
+}
+
+func backoff(attempts int) time.Duration {
+	d := janitorBaseBackoff
+	for i := 1; i < attempts && d < janitorMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > janitorMaxBackoff {
+		d = janitorMaxBackoff
+	}
+	return d
+}
+
+func (j *janitor) attempt(link string) error {
+	err := j.remove(link)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// tryRemove makes immediate attempt to remove file, scheduling retry on failure
+func (j *janitor) tryRemove(link string) {
+	err := j.attempt(link)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err == nil {
+		delete(j.pending, link)
+		delete(j.failed, link)
+		return
+	}
+	r, ok := j.pending[link]
+	if !ok {
+		r = &removal{}
+	}
+	j.schedule(link, r, err)
+}
+
+func (j *janitor) schedule(link string, r *removal, err error) {
+	r.attempts++
+	r.err = err
+	if r.attempts >= janitorMaxAttempts {
+		delete(j.pending, link)
+		j.failed[link] = r
+		slog.Error("failed to remove certificate file, retry limit exceeded", slog.String("link", link),
+			slog.Int("attempts", r.attempts), slog.Any("error", err))
+		return
+	}
+	r.next = j.now().Add(backoff(r.attempts))
+	j.pending[link] = r
+	slog.Warn("failed to remove certificate file, retry scheduled", slog.String("link", link),
+		slog.Int("attempts", r.attempts), slog.Time("next", r.next), slog.Any("error", err))
+}
+
+// cancel drops scheduled removal, used when file with the same link is stored again
+func (j *janitor) cancel(link string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.pending, link)
+	delete(j.failed, link)
+}
+
+// retry attempts removal of all pending files with expired backoff
+func (j *janitor) retry() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	for link, r := range j.pending {
+		if r.next.After(now) {
+			continue
+		}
+		err := j.attempt(link)
+		if err == nil {
+			delete(j.pending, link)
+			continue
+		}
+		j.schedule(link, r, err)
+	}
+}
+
+func (j *janitor) pendingLen() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return uint64(len(j.pending))
+}
+
+func (j *janitor) failedLen() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return uint64(len(j.failed))
+}
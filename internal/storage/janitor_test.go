@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func failingRemove(failures int) func(name string) error {
+	return func(name string) error {
+		if failures > 0 {
+			failures--
+			return fmt.Errorf("failed")
+		}
+		return os.Remove(name)
+	}
+}
+
+func TestJanitorBackoff(t *testing.T) {
+	t.Run("backoff doubles with each attempt and limited by max backoff", func(t *testing.T) {
+		assert.Equal(t, janitorBaseBackoff, backoff(1))
+		assert.Equal(t, 2*janitorBaseBackoff, backoff(2))
+		assert.Equal(t, 4*janitorBaseBackoff, backoff(3))
+		assert.Equal(t, janitorMaxBackoff, backoff(janitorMaxAttempts*10))
+	})
+}
+
+func TestFileSystemEvictionRetry(t *testing.T) {
+	t.Run("failed removal of evicted file should be retried after backoff", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+		fs.j.remove = failingRemove(1)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+
+		fs.Delete(id)
+
+		link := fsEnsureTrailingSlash(path) + toFileName(id, timestamp)
+		assert.FileExists(t, link)
+		assert.Equal(t, uint64(1), fs.PendingDeletions())
+
+		fs.j.retry()
+		assert.FileExists(t, link)
+		assert.Equal(t, uint64(1), fs.PendingDeletions())
+
+		clock.Advance(backoff(1))
+		fs.j.retry()
+		assert.NoFileExists(t, link)
+		assert.Zero(t, fs.PendingDeletions())
+		assert.Zero(t, fs.FailedDeletions())
+	})
+	t.Run("removal exceeded retry limit should be counted as failed", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+		fs.j.remove = failingRemove(janitorMaxAttempts)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+
+		fs.Delete(id)
+		for i := 0; i < janitorMaxAttempts; i++ {
+			clock.Advance(janitorMaxBackoff)
+			fs.j.retry()
+		}
+
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+		assert.Zero(t, fs.PendingDeletions())
+		assert.Equal(t, uint64(1), fs.FailedDeletions())
+	})
+	t.Run("storing file with the same link should cancel scheduled removal", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+		fs.j.remove = failingRemove(1)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		fs.Delete(id)
+		require.Equal(t, uint64(1), fs.PendingDeletions())
+
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		clock.Advance(janitorMaxBackoff)
+		fs.j.retry()
+
+		assert.Zero(t, fs.PendingDeletions())
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+	})
+}
+
+func TestFileSystemReconcile(t *testing.T) {
+	t.Run("remove orphaned files, keep indexed and recently written files", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		err = fs.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		indexed := fsEnsureTrailingSlash(path) + toFileName("00000000", timestamp)
+		orphan := fsEnsureTrailingSlash(path) + toFileName("00000001", timestamp)
+		recent := fsEnsureTrailingSlash(path) + toFileName("00000002", timestamp)
+		foreign := fsEnsureTrailingSlash(path) + "foreign.txt"
+		for _, name := range []string{orphan, recent, foreign} {
+			err = os.WriteFile(name, cert, 0666)
+			require.NoError(t, err)
+		}
+		old := timestamp.Add(-2 * janitorOrphanGrace)
+		for _, name := range []string{indexed, orphan, foreign} {
+			err = os.Chtimes(name, old, old)
+			require.NoError(t, err)
+		}
+
+		err = fs.Reconcile()
+
+		require.NoError(t, err)
+		assert.FileExists(t, indexed)
+		assert.NoFileExists(t, orphan)
+		assert.FileExists(t, recent)
+		assert.FileExists(t, foreign)
+	})
+	t.Run("reconcile removes files which exceeded retry limit", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+		fs.j.remove = failingRemove(janitorMaxAttempts)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		fs.Delete(id)
+		for i := 0; i < janitorMaxAttempts; i++ {
+			clock.Advance(janitorMaxBackoff)
+			fs.j.retry()
+		}
+		require.Equal(t, uint64(1), fs.FailedDeletions())
+
+		err = fs.Reconcile()
+
+		require.NoError(t, err)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+		assert.Zero(t, fs.FailedDeletions())
+	})
+}
+
+func TestFileSystemStartJanitor(t *testing.T) {
+	t.Run("janitor retries pending removals in background", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp}
+		fs, err := NewFileSystem(path)
+		require.NoError(t, err)
+		fs.j.remove = failingRemove(1)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		fs.Delete(id)
+		require.Equal(t, uint64(1), fs.PendingDeletions())
+		clock.Advance(janitorMaxBackoff)
+		fs.j.setNow(clock.Now)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		fs.StartJanitor(ctx, time.Millisecond, time.Hour)
+
+		assert.Eventually(t, func() bool {
+			return fs.PendingDeletions() == 0
+		}, time.Second, time.Millisecond)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+	})
+}
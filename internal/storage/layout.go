@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eklmv/pdfcertificates/internal/cache"
+)
+
+// Layout defines placement of certificate files inside storage directory
+type Layout int
+
+const (
+	// FlatLayout stores all files in storage directory: {id}_{ts}.pdf
+	FlatLayout Layout = iota
+	// ShardedLayout stores files in two levels of subdirectories named by
+	// hash prefix of certificate id: ab/cd/{id}_{ts}.pdf
+	ShardedLayout
+)
+
+func (l Layout) String() string {
+	switch l {
+	case FlatLayout:
+		return "flat"
+	case ShardedLayout:
+		return "sharded"
+	default:
+		return fmt.Sprintf("Layout(%d)", int(l))
+	}
+}
+
+// dir return directory of certificate file relative to storage directory
+func (l Layout) dir(id string) string {
+	switch l {
+	case ShardedLayout:
+		hash := fmt.Sprintf("%08x", cache.HashString(id))
+		return hash[0:2] + "/" + hash[2:4] + "/"
+	default:
+		return ""
+	}
+}
+
+func (fs *FileSystem) toLink(id string, timestamp time.Time) string {
+	return fs.path + fs.cfg.Layout.dir(id) + toFileName(id, timestamp)
+}
+
+// walkFiles calls fn for each regular file in storage directory and its
+// subdirectories, regardless of layout, hidden files are skipped
+func (fs *FileSystem) walkFiles(fn func(link string, entry iofs.DirEntry) error) error {
+	return filepath.WalkDir(fs.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(fs.path, path)
+		if err != nil {
+			return err
+		}
+		return fn(fs.path+filepath.ToSlash(rel), entry)
+	})
+}
+
+// MigrateLayout moves loaded certificate files which placement doesn't match
+// configured layout, recency of files is preserved
+func (fs *FileSystem) MigrateLayout() error {
+	for _, id := range fs.c.Keys() {
+		cl, ok := fs.c.Peek(id)
+		if !ok {
+			continue
+		}
+		link := fs.toLink(cl.id, cl.timestamp)
+		if link == cl.link {
+			fs.c.Touch(id)
+			continue
+		}
+		if err := moveFile(cl.link, link); err != nil {
+			return err
+		}
+		moved := cl
+		moved.link = link
+		fs.c.Add(id, moved)
+	}
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	for _, versions := range fs.versions {
+		for i, cl := range versions {
+			link := fs.toLink(cl.id, cl.timestamp)
+			if link == cl.link {
+				continue
+			}
+			if err := moveFile(cl.link, link); err != nil {
+				return err
+			}
+			versions[i].link = link
+		}
+	}
+	return nil
+}
+
+func moveFile(from string, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), 0777)
+	if err == nil {
+		err = os.Rename(from, to)
+	}
+	if err != nil {
+		slog.Error("failed to migrate certificate file", slog.String("from", from),
+			slog.String("to", to), slog.Any("error", err))
+	}
+	return err
+}
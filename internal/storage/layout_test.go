@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eklmv/pdfcertificates/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutDir(t *testing.T) {
+	t.Run("flat layout places files in storage directory", func(t *testing.T) {
+		assert.Empty(t, FlatLayout.dir("00000000"))
+	})
+	t.Run("sharded layout places files in directories named by hash prefix", func(t *testing.T) {
+		id := "00000000"
+		hash := fmt.Sprintf("%08x", cache.HashString(id))
+
+		got := ShardedLayout.dir(id)
+
+		assert.Equal(t, hash[0:2]+"/"+hash[2:4]+"/", got)
+	})
+}
+
+func TestLayoutString(t *testing.T) {
+	t.Run("known layouts named, unknown layouts formatted with value", func(t *testing.T) {
+		assert.Equal(t, "flat", FlatLayout.String())
+		assert.Equal(t, "sharded", ShardedLayout.String())
+		assert.Equal(t, "Layout(7)", Layout(7).String())
+		assert.Equal(t, "Layout(-1)", fmt.Sprint(Layout(-1)))
+	})
+}
+
+func TestFileSystemShardedLayout(t *testing.T) {
+	t.Run("store certificate in sharded directory", func(t *testing.T) {
+		path := testDir(t)
+		exp := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Layout: ShardedLayout})
+		require.NoError(t, err)
+
+		err = fs.Add(id, exp, timestamp)
+		require.NoError(t, err)
+
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+ShardedLayout.dir(id)+toFileName(id, timestamp))
+		got, err := fs.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+	t.Run("load files stored in both flat and sharded layouts", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		flat, err := NewFileSystem(path)
+		require.NoError(t, err)
+		sharded, err := NewFileSystemWithConfig(path, FileSystemConfig{Layout: ShardedLayout})
+		require.NoError(t, err)
+		err = flat.Add("00000000", cert, timestamp)
+		require.NoError(t, err)
+		err = sharded.Add("00000001", cert, timestamp)
+		require.NoError(t, err)
+
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Layout: ShardedLayout})
+		require.NoError(t, err)
+		err = fs.Load()
+
+		require.NoError(t, err)
+		assert.True(t, fs.Exists("00000000", timestamp))
+		assert.True(t, fs.Exists("00000001", timestamp))
+	})
+	t.Run("reconcile removes orphaned files from sharded directories", func(t *testing.T) {
+		path := testDir(t)
+		cert := []byte("Hello, world!")
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Layout: ShardedLayout})
+		require.NoError(t, err)
+		err = fs.Add(id, cert, timestamp)
+		require.NoError(t, err)
+		link := fsEnsureTrailingSlash(path) + ShardedLayout.dir(id) + toFileName(id, timestamp)
+		old := timestamp.Add(-2 * janitorOrphanGrace)
+		err = os.Chtimes(link, old, old)
+		require.NoError(t, err)
+		fs.initCache()
+
+		err = fs.Reconcile()
+
+		require.NoError(t, err)
+		assert.NoFileExists(t, link)
+	})
+}
+
+func TestFileSystemMigrateLayout(t *testing.T) {
+	t.Run("move files from flat to sharded layout preserving recency", func(t *testing.T) {
+		path := testDir(t)
+		amount := 4
+		timestamp := time.Now()
+		var ids []string
+		flat, err := NewFileSystem(path)
+		require.NoError(t, err)
+		for i := 0; i < amount; i++ {
+			id := strconv.Itoa(i)
+			ids = append(ids, id)
+			err = flat.Add(id, []byte("certificate: "+id), timestamp)
+			require.NoError(t, err)
+		}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Layout: ShardedLayout})
+		require.NoError(t, err)
+		err = fs.Load()
+		require.NoError(t, err)
+		keys := fs.c.Keys()
+
+		err = fs.MigrateLayout()
+
+		require.NoError(t, err)
+		assert.Equal(t, keys, fs.c.Keys())
+		for _, id := range ids {
+			assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+			assert.FileExists(t, fsEnsureTrailingSlash(path)+ShardedLayout.dir(id)+toFileName(id, timestamp))
+			got, err := fs.Get(id, timestamp)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("certificate: "+id), got)
+		}
+	})
+}
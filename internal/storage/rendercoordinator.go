@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/eklmv/pdfcertificates/internal/cache"
+)
+
+// RenderCoordinator collapses concurrent renders of the same certificate
+// version into one, rendered certificate is added to storage once and the
+// same bytes are returned to all waiting callers
+type RenderCoordinator struct {
+	storage Storage
+	group   cache.FlightGroup[renderKey, []byte]
+}
+
+type renderKey struct {
+	id        string
+	timestamp int64
+}
+
+func NewRenderCoordinator(storage Storage) *RenderCoordinator {
+	return &RenderCoordinator{storage: storage}
+}
+
+// GetOrRender return stored certificate if it is not older than timestamp,
+// otherwise certificate is rendered and stored. Failure to store rendered
+// certificate is logged, but certificate is still returned.
+func (rc *RenderCoordinator) GetOrRender(id string, timestamp time.Time, render func() ([]byte, error)) ([]byte, error) {
+	if cert, ok := rc.stored(id, timestamp); ok {
+		return cert, nil
+	}
+	key := renderKey{id: id, timestamp: timestamp.UnixNano()}
+	cert, err, shared := rc.group.Do(key, func() ([]byte, error) {
+		// certificate could be stored by flight finished right before this one
+		if cert, ok := rc.stored(id, timestamp); ok {
+			return cert, nil
+		}
+		cert, err := render()
+		if err != nil {
+			slog.Error("failed to render certificate", slog.String("id", id),
+				slog.Time("timestamp", timestamp), slog.Any("error", err))
+			return nil, err
+		}
+		if err := rc.storage.Add(id, cert, timestamp); err != nil {
+			slog.Error("failed to store rendered certificate", slog.String("id", id),
+				slog.Time("timestamp", timestamp), slog.Any("error", err))
+		}
+		return cert, nil
+	})
+	if shared {
+		slog.Info("concurrent certificate renders collapsed", slog.String("id", id),
+			slog.Time("timestamp", timestamp))
+	}
+	return cert, err
+}
+
+func (rc *RenderCoordinator) stored(id string, timestamp time.Time) ([]byte, bool) {
+	if !rc.storage.Exists(id, timestamp) {
+		return nil, false
+	}
+	cert, err := rc.storage.Get(id, timestamp)
+	return cert, err == nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCoordinatorGetOrRender(t *testing.T) {
+	t.Run("return stored certificate, avoid render", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		rc := NewRenderCoordinator(m)
+		m.EXPECT().Exists(id, timestamp).Return(true).Once()
+		m.EXPECT().Get(id, timestamp).Return(exp, nil).Once()
+
+		got, err := rc.GetOrRender(id, timestamp, func() ([]byte, error) {
+			t.Fatal("render should not be called")
+			return nil, nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+	t.Run("concurrent requests rendered and added to cached storage once", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		workers := 20
+		m := NewMockStorage(t)
+		rc := NewRenderCoordinator(NewCachedStorage(m))
+		m.EXPECT().Exists(id, timestamp).Return(false).Maybe()
+		m.EXPECT().Add(id, exp, timestamp).Return(nil).Once()
+		var renders atomic.Int32
+		release := make(chan struct{})
+		render := func() ([]byte, error) {
+			renders.Add(1)
+			<-release
+			return exp, nil
+		}
+
+		results := make([][]byte, workers)
+		var complete sync.WaitGroup
+		complete.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func(i int) {
+				defer complete.Done()
+				cert, err := rc.GetOrRender(id, timestamp, render)
+				assert.NoError(t, err)
+				results[i] = cert
+			}(i)
+		}
+		require.Eventually(t, func() bool { return renders.Load() == 1 }, time.Second, time.Millisecond)
+		close(release)
+		complete.Wait()
+
+		assert.Equal(t, int32(1), renders.Load())
+		for _, cert := range results {
+			assert.Equal(t, exp, cert)
+		}
+	})
+	t.Run("render error returned, nothing stored", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		rc := NewRenderCoordinator(m)
+		m.EXPECT().Exists(id, timestamp).Return(false).Twice()
+
+		got, err := rc.GetOrRender(id, timestamp, func() ([]byte, error) {
+			return nil, fmt.Errorf("failed")
+		})
+
+		assert.ErrorContains(t, err, "failed")
+		assert.Empty(t, got)
+	})
+	t.Run("rendered certificate returned if storing failed", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		m := NewMockStorage(t)
+		rc := NewRenderCoordinator(m)
+		m.EXPECT().Exists(id, timestamp).Return(false).Twice()
+		m.EXPECT().Add(id, exp, timestamp).Return(fmt.Errorf("failed")).Once()
+
+		got, err := rc.GetOrRender(id, timestamp, func() ([]byte, error) {
+			return exp, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+}
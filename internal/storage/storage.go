@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -11,6 +12,75 @@ type Storage interface {
 	Delete(id string)
 	Exists(id string, timestamp time.Time) bool
 	Load() error
+	Walker
+	List() ([]Object, error)
+	Stats() Stats
 }
 
-var CertificateFileNotFoundError = errors.New("certificate file not found")
+var (
+	CertificateFileNotFoundError = errors.New("certificate file not found")
+	VersionsNotSupportedError    = errors.New("storage doesn't keep versions of certificates")
+)
+
+// Object describes stored certificate
+type Object struct {
+	ID        string
+	Timestamp time.Time
+	Size      uint64
+}
+
+// Stats describes stored certificates and usage of storage
+type Stats struct {
+	// Objects is an amount of stored certificates
+	Objects uint64
+	// Bytes is a total size of stored certificates
+	Bytes uint64
+	// Oldest and Newest are bounds of timestamps of stored certificates,
+	// zero if storage is empty
+	Oldest time.Time
+	Newest time.Time
+	// Hits and Misses count Get calls served and not served by storage
+	Hits   uint64
+	Misses uint64
+}
+
+func (s *Stats) add(obj Object) {
+	s.Objects++
+	s.Bytes += obj.Size
+	if s.Oldest.IsZero() || obj.Timestamp.Before(s.Oldest) {
+		s.Oldest = obj.Timestamp
+	}
+	if s.Newest.IsZero() || obj.Timestamp.After(s.Newest) {
+		s.Newest = obj.Timestamp
+	}
+}
+
+// Walker enumerates stored certificates
+type Walker interface {
+	Walk(fn func(id string, timestamp time.Time) error) error
+}
+
+// Replacer is implemented by storages able to overwrite stored certificate
+// without changing its timestamp
+type Replacer interface {
+	Replace(id string, cert []byte, timestamp time.Time) error
+}
+
+// VersionedStorage is implemented by storages keeping history of previous
+// versions of certificates. Decorators implement it by passing calls through,
+// returning VersionsNotSupportedError if underlying storage doesn't keep
+// versions.
+type VersionedStorage interface {
+	Storage
+	ListVersions(id string) ([]time.Time, error)
+	GetVersion(id string, timestamp time.Time) ([]byte, error)
+}
+
+// versioned return storage as VersionedStorage if it keeps versions
+func versioned(s Storage) (VersionedStorage, error) {
+	vs, ok := s.(VersionedStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", VersionsNotSupportedError, s)
+	}
+	return vs, nil
+}
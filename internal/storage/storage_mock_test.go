@@ -208,6 +208,63 @@ func (_c *MockStorage_Get_Call) RunAndReturn(run func(string, time.Time) ([]byte
 	return _c
 }
 
+// List provides a mock function with given fields:
+func (_m *MockStorage) List() ([]Object, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 []Object
+	var r1 error
+	if rf, ok := ret.Get(0).(func() ([]Object, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() []Object); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]Object)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStorage_List_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'List'
+type MockStorage_List_Call struct {
+	*mock.Call
+}
+
+// List is a helper method to define mock.On call
+func (_e *MockStorage_Expecter) List() *MockStorage_List_Call {
+	return &MockStorage_List_Call{Call: _e.mock.On("List")}
+}
+
+func (_c *MockStorage_List_Call) Run(run func()) *MockStorage_List_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockStorage_List_Call) Return(_a0 []Object, _a1 error) *MockStorage_List_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStorage_List_Call) RunAndReturn(run func() ([]Object, error)) *MockStorage_List_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Load provides a mock function with given fields:
 func (_m *MockStorage) Load() error {
 	ret := _m.Called()
@@ -253,6 +310,97 @@ func (_c *MockStorage_Load_Call) RunAndReturn(run func() error) *MockStorage_Loa
 	return _c
 }
 
+// Stats provides a mock function with given fields:
+func (_m *MockStorage) Stats() Stats {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 Stats
+	if rf, ok := ret.Get(0).(func() Stats); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(Stats)
+	}
+
+	return r0
+}
+
+// MockStorage_Stats_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Stats'
+type MockStorage_Stats_Call struct {
+	*mock.Call
+}
+
+// Stats is a helper method to define mock.On call
+func (_e *MockStorage_Expecter) Stats() *MockStorage_Stats_Call {
+	return &MockStorage_Stats_Call{Call: _e.mock.On("Stats")}
+}
+
+func (_c *MockStorage_Stats_Call) Run(run func()) *MockStorage_Stats_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockStorage_Stats_Call) Return(_a0 Stats) *MockStorage_Stats_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_Stats_Call) RunAndReturn(run func() Stats) *MockStorage_Stats_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Walk provides a mock function with given fields: fn
+func (_m *MockStorage) Walk(fn func(string, time.Time) error) error {
+	ret := _m.Called(fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Walk")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(func(string, time.Time) error) error); ok {
+		r0 = rf(fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStorage_Walk_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Walk'
+type MockStorage_Walk_Call struct {
+	*mock.Call
+}
+
+// Walk is a helper method to define mock.On call
+//   - fn func(string , time.Time) error
+func (_e *MockStorage_Expecter) Walk(fn interface{}) *MockStorage_Walk_Call {
+	return &MockStorage_Walk_Call{Call: _e.mock.On("Walk", fn)}
+}
+
+func (_c *MockStorage_Walk_Call) Run(run func(fn func(string, time.Time) error)) *MockStorage_Walk_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(func(string, time.Time) error))
+	})
+	return _c
+}
+
+func (_c *MockStorage_Walk_Call) Return(_a0 error) *MockStorage_Walk_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_Walk_Call) RunAndReturn(run func(func(string, time.Time) error) error) *MockStorage_Walk_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockStorage creates a new instance of MockStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockStorage(t interface {
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// TieredStorage composes fast local storage with durable remote one. Writes
+// go through to remote storage first, reads are served from local storage,
+// falling back to remote storage and populating local one with the result.
+type TieredStorage struct {
+	local  Storage
+	remote Storage
+	warm   func(id string, timestamp time.Time) bool
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewTieredStorage(local Storage, remote Storage) *TieredStorage {
+	return &TieredStorage{local: local, remote: remote}
+}
+
+// SetWarmFilter sets filter of certificates copied from remote to local
+// storage on Load
+func (ts *TieredStorage) SetWarmFilter(filter func(id string, timestamp time.Time) bool) {
+	ts.warm = filter
+}
+
+func (ts *TieredStorage) Add(id string, cert []byte, timestamp time.Time) error {
+	err := ts.remote.Add(id, cert, timestamp)
+	if err != nil {
+		return err
+	}
+	if err := ts.local.Add(id, cert, timestamp); err != nil {
+		slog.Warn("failed to store certificate in local tier", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+	}
+	return nil
+}
+
+func (ts *TieredStorage) Get(id string, timestamp time.Time) (cert []byte, err error) {
+	if ts.local.Exists(id, timestamp) {
+		cert, err = ts.local.Get(id, timestamp)
+		if err == nil {
+			ts.hits.Add(1)
+			return cert, nil
+		}
+		slog.Warn("failed to read certificate from local tier, fallback to remote", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+	}
+	ts.misses.Add(1)
+	cert, err = ts.remote.Get(id, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.local.Add(id, cert, timestamp); err != nil {
+		slog.Warn("failed to populate local tier", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+	}
+	return cert, nil
+}
+
+func (ts *TieredStorage) Delete(id string) {
+	ts.remote.Delete(id)
+	ts.local.Delete(id)
+}
+
+func (ts *TieredStorage) Exists(id string, timestamp time.Time) bool {
+	return ts.local.Exists(id, timestamp) || ts.remote.Exists(id, timestamp)
+}
+
+// Load loads both tiers, then copies certificates accepted by warm filter
+// from remote to local storage
+func (ts *TieredStorage) Load() error {
+	if err := ts.local.Load(); err != nil {
+		return err
+	}
+	if err := ts.remote.Load(); err != nil {
+		return err
+	}
+	if ts.warm == nil {
+		return nil
+	}
+	warmed := 0
+	err := ts.remote.Walk(func(id string, timestamp time.Time) error {
+		if !ts.warm(id, timestamp) || ts.local.Exists(id, timestamp) {
+			return nil
+		}
+		cert, err := ts.remote.Get(id, timestamp)
+		if err == nil {
+			err = ts.local.Add(id, cert, timestamp)
+		}
+		if err != nil {
+			slog.Warn("failed to warm local tier", slog.String("id", id),
+				slog.Time("timestamp", timestamp), slog.Any("error", err))
+			return nil
+		}
+		warmed++
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to warm local tier", slog.Any("error", err))
+		return err
+	}
+	slog.Info("local tier warmed", slog.Int("certificates", warmed))
+	return nil
+}
+
+// ListVersions return versions of certificate kept by remote storage
+func (ts *TieredStorage) ListVersions(id string) ([]time.Time, error) {
+	vs, err := versioned(ts.remote)
+	if err != nil {
+		return nil, err
+	}
+	return vs.ListVersions(id)
+}
+
+// GetVersion return version of certificate kept by remote storage, local
+// storage only serves the latest versions
+func (ts *TieredStorage) GetVersion(id string, timestamp time.Time) ([]byte, error) {
+	vs, err := versioned(ts.remote)
+	if err != nil {
+		return nil, err
+	}
+	return vs.GetVersion(id, timestamp)
+}
+
+// Walk calls fn for each certificate stored in remote storage
+func (ts *TieredStorage) Walk(fn func(id string, timestamp time.Time) error) error {
+	return ts.remote.Walk(fn)
+}
+
+// List return certificates stored in remote storage
+func (ts *TieredStorage) List() ([]Object, error) {
+	return ts.remote.List()
+}
+
+// Stats describes remote storage, hits count reads served by local storage
+// and misses count reads fallen back to remote storage
+func (ts *TieredStorage) Stats() Stats {
+	stats := ts.remote.Stats()
+	stats.Hits = ts.hits.Load()
+	stats.Misses = ts.misses.Load()
+	return stats
+}
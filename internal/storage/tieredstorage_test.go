@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredStorageImplementsInterface(t *testing.T) {
+	assert.Implements(t, (*Storage)(nil), &TieredStorage{})
+	assert.Implements(t, (*VersionedStorage)(nil), &TieredStorage{})
+}
+
+func TestTieredStorageAdd(t *testing.T) {
+	t.Run("certificate stored in both tiers", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		remote.EXPECT().Add(id, cert, timestamp).Return(nil).Once()
+		local.EXPECT().Add(id, cert, timestamp).Return(nil).Once()
+		err := ts.Add(id, cert, timestamp)
+
+		assert.NoError(t, err)
+	})
+	t.Run("failure of remote tier returned, local tier not affected", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		remote.EXPECT().Add(id, cert, timestamp).Return(fmt.Errorf("failed")).Once()
+		err := ts.Add(id, cert, timestamp)
+
+		assert.ErrorContains(t, err, "failed")
+	})
+	t.Run("failure of local tier is not an error", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		remote.EXPECT().Add(id, cert, timestamp).Return(nil).Once()
+		local.EXPECT().Add(id, cert, timestamp).Return(fmt.Errorf("failed")).Once()
+		err := ts.Add(id, cert, timestamp)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestTieredStorageGet(t *testing.T) {
+	t.Run("serve certificate from local tier, avoid remote call", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		local.EXPECT().Exists(id, timestamp).Return(true).Once()
+		local.EXPECT().Get(id, timestamp).Return(exp, nil).Once()
+		got, err := ts.Get(id, timestamp)
+
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+	t.Run("fallback to remote tier and populate local tier", func(t *testing.T) {
+		id := "00000000"
+		exp := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		local.EXPECT().Exists(id, timestamp).Return(false).Once()
+		remote.EXPECT().Get(id, timestamp).Return(exp, nil).Once()
+		local.EXPECT().Add(id, exp, timestamp).Return(nil).Once()
+		got, err := ts.Get(id, timestamp)
+
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+	})
+	t.Run("return error if certificate not found in both tiers", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		local.EXPECT().Exists(id, timestamp).Return(false).Once()
+		remote.EXPECT().Get(id, timestamp).Return(nil, CertificateFileNotFoundError).Once()
+		got, err := ts.Get(id, timestamp)
+
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+		assert.Empty(t, got)
+	})
+}
+
+func TestTieredStorageDelete(t *testing.T) {
+	t.Run("certificate deleted from both tiers", func(t *testing.T) {
+		id := "00000000"
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		remote.EXPECT().Delete(id).Once()
+		local.EXPECT().Delete(id).Once()
+		ts.Delete(id)
+	})
+}
+
+func TestTieredStorageExists(t *testing.T) {
+	t.Run("check local tier, then remote tier", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+
+		local.EXPECT().Exists(id, timestamp).Return(true).Once()
+		assert.True(t, ts.Exists(id, timestamp))
+
+		local.EXPECT().Exists(id, timestamp).Return(false).Once()
+		remote.EXPECT().Exists(id, timestamp).Return(true).Once()
+		assert.True(t, ts.Exists(id, timestamp))
+
+		local.EXPECT().Exists(id, timestamp).Return(false).Once()
+		remote.EXPECT().Exists(id, timestamp).Return(false).Once()
+		assert.False(t, ts.Exists(id, timestamp))
+	})
+}
+
+func TestTieredStorageLoad(t *testing.T) {
+	t.Run("warm local tier with certificates accepted by filter", func(t *testing.T) {
+		timestamp := time.Now()
+		local, err := NewFileSystem(testDir(t) + "/local")
+		require.NoError(t, err)
+		writeRemote, err := NewFileSystem(testDir(t) + "/remote")
+		require.NoError(t, err)
+		err = writeRemote.Add("00000000", []byte("warm"), timestamp)
+		require.NoError(t, err)
+		err = writeRemote.Add("00000001", []byte("cold"), timestamp.Add(-time.Hour))
+		require.NoError(t, err)
+		remote, err := NewFileSystem(testDir(t) + "/remote")
+		require.NoError(t, err)
+		ts := NewTieredStorage(local, remote)
+		ts.SetWarmFilter(func(_ string, ts time.Time) bool {
+			return !ts.Before(timestamp)
+		})
+
+		err = ts.Load()
+
+		require.NoError(t, err)
+		assert.True(t, local.Exists("00000000", timestamp))
+		assert.False(t, local.Exists("00000001", timestamp.Add(-time.Hour)))
+		assert.True(t, ts.Exists("00000001", timestamp.Add(-time.Hour)))
+	})
+}
+
+func TestTieredStorageStats(t *testing.T) {
+	t.Run("describe remote tier, count local hits and misses", func(t *testing.T) {
+		id := "00000000"
+		cert := []byte("Hello, world!")
+		timestamp := time.Now()
+		local, remote := NewMockStorage(t), NewMockStorage(t)
+		ts := NewTieredStorage(local, remote)
+		local.EXPECT().Exists(id, timestamp).Return(false).Once()
+		remote.EXPECT().Get(id, timestamp).Return(cert, nil).Once()
+		local.EXPECT().Add(id, cert, timestamp).Return(nil).Once()
+		local.EXPECT().Exists(id, timestamp).Return(true).Once()
+		local.EXPECT().Get(id, timestamp).Return(cert, nil).Once()
+		remote.EXPECT().Stats().Return(Stats{Objects: 1, Bytes: uint64(len(cert))}).Once()
+
+		_, err := ts.Get(id, timestamp)
+		require.NoError(t, err)
+		_, err = ts.Get(id, timestamp)
+		require.NoError(t, err)
+		stats := ts.Stats()
+
+		assert.Equal(t, Stats{Objects: 1, Bytes: uint64(len(cert)), Hits: 1, Misses: 1}, stats)
+	})
+}
+
+func TestTieredStorageVersions(t *testing.T) {
+	t.Run("versions served by remote tier", func(t *testing.T) {
+		id := "00000000"
+		local, err := NewFileSystem(testDir(t) + "/local")
+		require.NoError(t, err)
+		remote, err := NewFileSystemWithConfig(testDir(t)+"/remote", FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		ts := NewTieredStorage(local, remote)
+		timestamp := time.Now()
+		err = ts.Add(id, []byte("first"), timestamp)
+		require.NoError(t, err)
+		err = ts.Add(id, []byte("second"), timestamp.Add(time.Hour))
+		require.NoError(t, err)
+
+		versions, err := ts.ListVersions(id)
+		require.NoError(t, err)
+		got, err := ts.GetVersion(id, timestamp)
+		require.NoError(t, err)
+
+		assert.Equal(t, []time.Time{timestamp, timestamp.Add(time.Hour)}, versions)
+		assert.Equal(t, []byte("first"), got)
+	})
+	t.Run("remote tier without versions rejected", func(t *testing.T) {
+		ts := NewTieredStorage(NewMockStorage(t), NewMockStorage(t))
+
+		_, err := ts.ListVersions("00000000")
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+		_, err = ts.GetVersion("00000000", time.Now())
+		assert.ErrorIs(t, err, VersionsNotSupportedError)
+	})
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// VersionRetention describes how many previous versions of each certificate
+// are kept besides the latest one, zero value disables version history.
+// Previous versions are counted towards storage quota, the oldest of them are
+// removed first once it is exceeded.
+type VersionRetention struct {
+	// Keep is a maximum amount of previous versions kept for each certificate
+	Keep int
+	// MaxAge is a maximum age of previous version, based on its timestamp
+	MaxAge time.Duration
+}
+
+func (vr VersionRetention) enabled() bool {
+	return vr.Keep > 0 || vr.MaxAge > 0
+}
+
+// addVersion keeps link in history of previous versions, link already kept
+// is ignored
+func (fs *FileSystem) addVersion(id string, cl fsCertLink) {
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	for _, v := range fs.versions[id] {
+		if v.link == cl.link {
+			return
+		}
+	}
+	versions := append(fs.versions[id], cl)
+	fs.vbytes += cl.size
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].timestamp.Before(versions[j].timestamp)
+	})
+	fs.versions[id] = versions
+	fs.pruneVersions(id)
+}
+
+// pruneVersions removes previous versions exceeding retention, should be
+// called with versions mutex locked
+func (fs *FileSystem) pruneVersions(id string) {
+	versions := fs.versions[id]
+	keep := fs.cfg.Versions.Keep
+	threshold := fs.j.timeNow().Add(-fs.cfg.Versions.MaxAge)
+	for len(versions) > 0 {
+		exceeded := keep > 0 && len(versions) > keep
+		expired := fs.cfg.Versions.MaxAge > 0 && versions[0].timestamp.Before(threshold)
+		if !exceeded && !expired {
+			break
+		}
+		slog.Info("removing previous certificate version by retention policy",
+			slog.String("link", versions[0].link), slog.Time("timestamp", versions[0].timestamp))
+		fs.j.tryRemove(versions[0].link)
+		fs.vbytes -= versions[0].size
+		versions = versions[1:]
+	}
+	if len(versions) == 0 {
+		delete(fs.versions, id)
+		return
+	}
+	fs.versions[id] = versions
+}
+
+func (fs *FileSystem) removeVersions(id string) {
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	for _, cl := range fs.versions[id] {
+		fs.j.tryRemove(cl.link)
+		fs.vbytes -= cl.size
+	}
+	delete(fs.versions, id)
+}
+
+// replaceVersion overwrites content of previous version of certificate
+func (fs *FileSystem) replaceVersion(id string, cert []byte, timestamp time.Time) error {
+	fs.vmu.Lock()
+	i := -1
+	for j, cl := range fs.versions[id] {
+		if cl.timestamp.Equal(timestamp) {
+			i = j
+		}
+	}
+	err := CertificateFileNotFoundError
+	if i != -1 {
+		cl := fs.versions[id][i]
+		err = writeFileAtomic(cl.link, cert)
+		if err == nil {
+			fs.vbytes = fs.vbytes - cl.size + uint64(len(cert))
+			fs.versions[id][i].size = uint64(len(cert))
+		}
+	}
+	fs.vmu.Unlock()
+	if err != nil {
+		slog.Error("failed to replace certificate file", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return err
+	}
+	fs.fitQuota()
+	return nil
+}
+
+// fitQuota removes the oldest previous versions of all certificates until
+// they fit into quota together with the latest versions, which are kept
+// within quota by index itself
+func (fs *FileSystem) fitQuota() {
+	if fs.cfg.Quota == 0 {
+		return
+	}
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	for fs.vbytes > 0 && fs.c.Size()+fs.vbytes > fs.cfg.Quota {
+		var oldest string
+		for id, versions := range fs.versions {
+			if oldest == "" || versions[0].timestamp.Before(fs.versions[oldest][0].timestamp) {
+				oldest = id
+			}
+		}
+		versions := fs.versions[oldest]
+		slog.Info("removing previous certificate version to fit quota",
+			slog.String("link", versions[0].link), slog.Time("timestamp", versions[0].timestamp))
+		fs.j.tryRemove(versions[0].link)
+		fs.vbytes -= versions[0].size
+		if len(versions) == 1 {
+			delete(fs.versions, oldest)
+		} else {
+			fs.versions[oldest] = versions[1:]
+		}
+	}
+}
+
+func (fs *FileSystem) versionLinks() []fsCertLink {
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	var links []fsCertLink
+	for _, versions := range fs.versions {
+		links = append(links, versions...)
+	}
+	return links
+}
+
+// index stores link as the latest version of certificate, replaced version
+// is kept in history if it is enabled
+func (fs *FileSystem) index(id string, cl fsCertLink) {
+	old, ok := fs.c.Peek(id)
+	if ok && old.link != cl.link && fs.cfg.Versions.enabled() {
+		fs.keep.Store(old.link, struct{}{})
+		defer fs.keep.Delete(old.link)
+		fs.addVersion(id, old)
+	}
+	fs.c.Add(id, cl)
+	fs.fitQuota()
+}
+
+// ListVersions return timestamps of all stored versions of certificate,
+// including the latest one, from oldest to newest
+func (fs *FileSystem) ListVersions(id string) ([]time.Time, error) {
+	var timestamps []time.Time
+	fs.vmu.Lock()
+	for _, cl := range fs.versions[id] {
+		timestamps = append(timestamps, cl.timestamp)
+	}
+	fs.vmu.Unlock()
+	if cl, ok := fs.c.Peek(id); ok {
+		timestamps = append(timestamps, cl.timestamp)
+	}
+	if len(timestamps) == 0 {
+		err := CertificateFileNotFoundError
+		slog.Error("requested certificate not found", slog.String("id", id), slog.Any("error", err))
+		return nil, err
+	}
+	return timestamps, nil
+}
+
+// GetVersion return version of certificate with exactly the same timestamp
+func (fs *FileSystem) GetVersion(id string, timestamp time.Time) ([]byte, error) {
+	link := ""
+	if cl, ok := fs.c.Peek(id); ok && cl.timestamp.Equal(timestamp) {
+		link = cl.link
+	}
+	fs.vmu.Lock()
+	for _, cl := range fs.versions[id] {
+		if cl.timestamp.Equal(timestamp) {
+			link = cl.link
+		}
+	}
+	fs.vmu.Unlock()
+	if link == "" {
+		err := CertificateFileNotFoundError
+		slog.Error("requested certificate version not found", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.Any("error", err))
+		return nil, err
+	}
+	cert, err := os.ReadFile(link)
+	if err != nil {
+		slog.Error("failed to read certificate file", slog.String("id", id),
+			slog.Time("timestamp", timestamp), slog.String("link", link), slog.Any("error", err))
+		return nil, err
+	}
+	return cert, nil
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSystemImplementsVersionedInterface(t *testing.T) {
+	assert.Implements(t, (*VersionedStorage)(nil), &FileSystem{})
+}
+
+func addVersions(tb testing.TB, fs *FileSystem, id string, timestamps []time.Time) {
+	tb.Helper()
+	for i, timestamp := range timestamps {
+		err := fs.Add(id, []byte(fmt.Sprintf("version %d", i)), timestamp)
+		require.NoError(tb, err)
+	}
+}
+
+func TestFileSystemVersions(t *testing.T) {
+	t.Run("previous versions kept and available by exact timestamp", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+
+		addVersions(t, fs, id, timestamps)
+
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, timestamps, got)
+		for i, timestamp := range timestamps {
+			cert, err := fs.GetVersion(id, timestamp)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("version %d", i)), cert)
+			assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+		}
+		cert, err := fs.Get(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("version 2"), cert)
+	})
+	t.Run("only configured amount of previous versions kept", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Versions: VersionRetention{Keep: 1}})
+		require.NoError(t, err)
+
+		addVersions(t, fs, id, timestamps)
+
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, timestamps[1:], got)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamps[0]))
+		_, err = fs.GetVersion(id, timestamps[0])
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+	})
+	t.Run("previous versions older than max age removed", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp.Add(2 * time.Hour)}
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Versions: VersionRetention{MaxAge: 90 * time.Minute}})
+		require.NoError(t, err)
+		fs.j.setNow(clock.Now)
+
+		addVersions(t, fs, id, timestamps)
+
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, timestamps[1:], got)
+
+		clock.Advance(time.Hour)
+		fs.ApplyRetention()
+
+		got, err = fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, timestamps[2:], got)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamps[1]))
+	})
+	t.Run("delete removes all versions", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour)}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		addVersions(t, fs, id, timestamps)
+
+		fs.Delete(id)
+
+		_, err = fs.ListVersions(id)
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+		for _, timestamp := range timestamps {
+			assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+		}
+	})
+	t.Run("load restores history of versions", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		cfg := FileSystemConfig{Versions: VersionRetention{Keep: 5}}
+		writeFs, err := NewFileSystemWithConfig(path, cfg)
+		require.NoError(t, err)
+		addVersions(t, writeFs, id, timestamps)
+
+		fs, err := NewFileSystemWithConfig(path, cfg)
+		require.NoError(t, err)
+		err = fs.Load()
+
+		require.NoError(t, err)
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, len(timestamps), len(got))
+		for i := range timestamps {
+			assert.True(t, timestamps[i].Equal(got[i]))
+		}
+		assert.True(t, fs.Exists(id, timestamps[2]))
+	})
+	t.Run("repeated load keeps history of versions unchanged", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		timestamps := []time.Time{timestamp, timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}
+		cfg := FileSystemConfig{Versions: VersionRetention{Keep: 5}}
+		fs, err := NewFileSystemWithConfig(path, cfg)
+		require.NoError(t, err)
+		addVersions(t, fs, id, timestamps)
+		require.NoError(t, fs.Load())
+		exp, err := fs.ListVersions(id)
+		require.NoError(t, err)
+
+		err = fs.Load()
+
+		require.NoError(t, err)
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, exp, got)
+		assert.Equal(t, len(timestamps), len(got))
+		assert.True(t, fs.Exists(id, timestamps[2]))
+		for _, ts := range timestamps {
+			assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, ts))
+		}
+	})
+	t.Run("reconcile keeps previous versions", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		timestamp := time.Now()
+		clock := &testClock{now: timestamp.Add(time.Hour)}
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		addVersions(t, fs, id, []time.Time{timestamp, timestamp.Add(time.Hour)})
+		fs.j.setNow(clock.Now)
+		clock.Advance(2 * janitorOrphanGrace)
+
+		err = fs.Reconcile()
+
+		require.NoError(t, err)
+		assert.FileExists(t, fsEnsureTrailingSlash(path)+toFileName(id, timestamp))
+	})
+}
+
+func TestFileSystemReplaceVersion(t *testing.T) {
+	t.Run("overwrite previous version keeping its timestamp", func(t *testing.T) {
+		id := "00000000"
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(testDir(t), FileSystemConfig{Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		addVersions(t, fs, id, []time.Time{timestamp, timestamp.Add(time.Hour)})
+		before := fs.Stats().Bytes
+
+		err = fs.Replace(id, []byte("replaced previous version"), timestamp)
+
+		require.NoError(t, err)
+		got, err := fs.GetVersion(id, timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("replaced previous version"), got)
+		assert.Equal(t, before-uint64(len("version 0"))+uint64(len("replaced previous version")), fs.Stats().Bytes)
+		err = fs.Replace(id, []byte("missing"), timestamp.Add(-time.Hour))
+		assert.ErrorIs(t, err, CertificateFileNotFoundError)
+	})
+}
+
+func TestFileSystemVersionsQuota(t *testing.T) {
+	t.Run("previous versions counted towards quota", func(t *testing.T) {
+		path := testDir(t)
+		id := "00000000"
+		cert := bytes.Repeat([]byte{1}, 50)
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Quota: 100, Versions: VersionRetention{Keep: 100}})
+		require.NoError(t, err)
+
+		for i := 0; i < 20; i++ {
+			err = fs.Add(id, cert, timestamp.Add(time.Duration(i)*time.Hour))
+			require.NoError(t, err)
+		}
+
+		stats := fs.Stats()
+		assert.Equal(t, uint64(2), stats.Objects)
+		assert.Equal(t, uint64(100), stats.Bytes)
+		got, err := fs.ListVersions(id)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{timestamp.Add(18 * time.Hour), timestamp.Add(19 * time.Hour)}, got)
+		var onDisk int64
+		err = filepath.WalkDir(path, func(_ string, entry iofs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			info, err := entry.Info()
+			onDisk += info.Size()
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), onDisk)
+	})
+	t.Run("oldest previous versions removed before latest versions", func(t *testing.T) {
+		path := testDir(t)
+		timestamp := time.Now()
+		fs, err := NewFileSystemWithConfig(path, FileSystemConfig{Quota: 100, Versions: VersionRetention{Keep: 5}})
+		require.NoError(t, err)
+		cert := bytes.Repeat([]byte{1}, 30)
+		for i := 0; i < 3; i++ {
+			err = fs.Add("a", cert, timestamp.Add(time.Duration(i)*time.Hour))
+			require.NoError(t, err)
+		}
+		err = fs.Add("b", bytes.Repeat([]byte{1}, 40), timestamp)
+		require.NoError(t, err)
+
+		stats := fs.Stats()
+		assert.LessOrEqual(t, stats.Bytes, uint64(100))
+		assert.True(t, fs.Exists("a", timestamp.Add(2*time.Hour)))
+		assert.True(t, fs.Exists("b", timestamp))
+		got, err := fs.ListVersions("a")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{timestamp.Add(time.Hour), timestamp.Add(2 * time.Hour)}, got)
+		assert.NoFileExists(t, fsEnsureTrailingSlash(path)+toFileName("a", timestamp))
+	})
+}